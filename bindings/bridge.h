@@ -19,6 +19,19 @@ char* CreateWindowsService(const char* name,
                            const char* configPath);
 char* PerformAction(const char* action, const char* password);
 int32_t IsXrayDownloading(void);
+// Returns a JSON envelope {"ok","code","message","data"}.
+char* Call(const char* method, const char* paramsJson);
+// Returns JSON: abi, goVersion, commit, platform, xrayCore, capabilities.
+char* GetBridgeInfo(void);
+// Shows the tray icon; Linux and Windows only.
+void InitTray(void);
+// Returns and clears queued events as a JSON list.
+char* PollEvents(void);
+// behavior is "hide", "minimize" or "close"; Linux and Windows only.
+char* SetWindowBehavior(const char* behavior);
+// argsJson is a JSON list; returns 1 to go on, 0 when another instance
+// took the arguments. Linux and Windows only.
+int32_t AcquireInstance(const char* argsJson);
 void FreeCString(char* str);
 
 #endif // BRIDGE_H
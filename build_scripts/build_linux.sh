@@ -52,3 +52,11 @@ echo ">>> Building Go shared library"
 CC=$CC GOOS=$GOOS GOARCH=$GOARCH go build -buildmode=c-shared -o "$FLUTTER_LIB_DIR/libgo_native_bridge.so"
 
 echo ">>> Build complete: $FLUTTER_LIB_DIR/libgo_native_bridge.so"
+
+# 命令行工具不依赖 cgo，静态链接以便直接拷到服务器上使用
+CLI_DIR="$DIR/build/cli"
+mkdir -p "$CLI_DIR"
+CGO_ENABLED=0 GOOS=$GOOS GOARCH=$GOARCH go build -o "$CLI_DIR/xstreamctl" ./cmd/xstreamctl
+echo ">>> Build complete: $CLI_DIR/xstreamctl"
+CGO_ENABLED=0 GOOS=$GOOS GOARCH=$GOARCH go build -o "$CLI_DIR/xstreamd" ./cmd/xstreamd
+echo ">>> Build complete: $CLI_DIR/xstreamd"
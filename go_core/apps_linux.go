@@ -0,0 +1,200 @@
+//go:build linux
+
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go_core/internal/splittun"
+	"go_core/internal/xrayconf"
+)
+
+func init() {
+	splittun.Sys = system{}
+	register("apps.set", func(p json.RawMessage) (any, error) {
+		var c splittun.Config
+		if err := decode(p, &c); err != nil {
+			return nil, err
+		}
+		return nil, setAppRules(c)
+	})
+	register("apps.get", func(json.RawMessage) (any, error) {
+		return getAppRules()
+	})
+	register("apps.runProxied", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Argv []string `json:"argv"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return nil, runProxied(args.Argv)
+	})
+}
+
+// setAppRules saves c, refusing cgroup mode on a host without the TUN
+// device it routes through.
+func setAppRules(c splittun.Config) error {
+	if c.Mode == splittun.ModeCgroup && !splittun.TunExists(c) {
+		return fail(codeUnsupported, fmt.Errorf("%w: %s", splittun.ErrNoTun, c.Tun()))
+	}
+	return splittun.Save(c)
+}
+
+//export SetAppRules
+func SetAppRules(configC *C.char) *C.char {
+	var c splittun.Config
+	if err := json.Unmarshal([]byte(C.GoString(configC)), &c); err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(nil, setAppRules(c))
+}
+
+//export GetAppRules
+func GetAppRules() *C.char {
+	return legacy(getAppRules())
+}
+
+func getAppRules() (any, error) {
+	c, err := splittun.Load()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RunProxied launches argv (a JSON list) so that only its traffic goes
+// through the active node.
+//
+//export RunProxied
+func RunProxied(argvC *C.char) *C.char {
+	var argv []string
+	if err := json.Unmarshal([]byte(C.GoString(argvC)), &argv); err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(nil, runProxied(argv))
+}
+
+func runProxied(argv []string) error {
+	c, err := splittun.Load()
+	if err != nil {
+		return err
+	}
+	var p splittun.Ports
+	if c.Mode == splittun.ModeNetns {
+		service := runningNode()
+		if service == "" {
+			return errors.New("no node is running")
+		}
+		cfgPath, err := serviceManager.ConfigPath(service)
+		if err != nil {
+			return err
+		}
+		if p, err = appPorts(cfgPath); err != nil {
+			return err
+		}
+	}
+	_, err = splittun.RunProxied(c, p, argv)
+	return err
+}
+
+// appPorts reads the inbound ports programs in the namespace reach from
+// the node config at cfgPath, after any move at start. A node shared
+// with the LAN listens on every address instead of HostAddr.
+func appPorts(cfgPath string) (splittun.Ports, error) {
+	cfg, err := xrayconf.Load(cfgPath)
+	if err != nil {
+		return splittun.Ports{}, err
+	}
+	var p splittun.Ports
+	for _, in := range cfg.Inbounds() {
+		switch in.Listen {
+		case splittun.HostAddr, "0.0.0.0", "::":
+		default:
+			continue
+		}
+		switch in.Protocol {
+		case "socks":
+			if p.Socks == 0 {
+				p.Socks = in.Port
+			}
+		case "http":
+			if p.HTTP == 0 {
+				p.HTTP = in.Port
+			}
+		}
+	}
+	if p.Socks == 0 && p.HTTP == 0 {
+		return p, errors.New("node has no inbound for proxied apps")
+	}
+	return p, nil
+}
+
+// prepareAppRouting creates the network namespace before the node starts,
+// since xray listens on the host end of its veth. Its ruleset stays
+// closed until startAppRouting knows the ports. Without rules, or in
+// cgroup mode, nothing is touched.
+func prepareAppRouting() error {
+	c, err := splittun.Load()
+	if err != nil || len(c.Rules) == 0 || c.Mode != splittun.ModeNetns {
+		return nil
+	}
+	if err := splittun.Prepare(c); err != nil {
+		return fmt.Errorf("app routing: %w", err)
+	}
+	return nil
+}
+
+// startAppRouting opens the namespace to the inbound ports the node at
+// cfgPath ended up with, or sets up cgroup-based routing, which needs its
+// TUN interface up. Only a namespace failure fails the start, since its
+// programs would otherwise be cut off.
+func startAppRouting(cfgPath string) error {
+	c, err := splittun.Load()
+	if err != nil || len(c.Rules) == 0 {
+		return nil
+	}
+	if c.Mode == splittun.ModeNetns {
+		p, err := appPorts(cfgPath)
+		if err == nil {
+			err = splittun.Enable(c, p)
+		}
+		if err != nil {
+			return fmt.Errorf("app routing: %w", err)
+		}
+		return nil
+	}
+	if err := splittun.Enable(c, splittun.Ports{}); err != nil {
+		fmt.Println("Enable app routing failed:", err)
+		return nil
+	}
+	// The classifier keeps moving processes for the live node; a dry run
+	// has recorded the rules it would install.
+	if activePlan() == nil {
+		splittun.StartClassifier(c, 5*time.Second)
+	}
+	return nil
+}
+
+func stopAppRouting() {
+	if activePlan() == nil {
+		splittun.StopClassifier()
+	}
+	if err := splittun.Disable(); err != nil {
+		fmt.Println("Disable app routing failed:", err)
+	}
+}
+
+// extraListenAddrs lists addresses xray must listen on besides the inbound
+// model's own: the veth end proxied programs in the namespace connect to.
+func extraListenAddrs() []string {
+	c, err := splittun.Load()
+	if err != nil || len(c.Rules) == 0 || c.Mode != splittun.ModeNetns {
+		return nil
+	}
+	return []string{splittun.HostAddr}
+}
@@ -7,53 +7,26 @@ package main
 */
 import "C"
 import (
-	"bytes"
+	"encoding/json"
 	"errors"
 	"os"
-	"path/filepath"
-	"sync"
+	"runtime"
+	"runtime/debug"
+	"strconv"
 	"unsafe"
 
 	"github.com/xtls/xray-core/core"
-)
-
-var procMap sync.Map
-var singleInstance *xrayInstance
-var instMu sync.Mutex
 
-type xrayInstance struct {
-	server core.Server
-}
+	"go_core/internal/platform"
+	"go_core/internal/platform/embedded"
+)
 
-func startXrayInternal(cfgData []byte) error {
-	if singleInstance != nil {
-		return errors.New("already running")
-	}
-	cfg, err := core.LoadConfig("json", bytes.NewReader(cfgData))
-	if err != nil {
-		return err
-	}
-	srv, err := core.New(cfg)
-	if err != nil {
-		return err
-	}
-	if err := srv.Start(); err != nil {
-		return err
-	}
-	singleInstance = &xrayInstance{server: srv}
-	return nil
-}
+// engine runs the node services and the standalone instance of StartXray
+// inside the app; node configs are <tmp>/<node>.json.
+var engine = &embedded.Manager{Dir: os.TempDir()}
 
-func stopXrayInternal() error {
-	if singleInstance == nil {
-		return errors.New("not running")
-	}
-	if err := singleInstance.server.Close(); err != nil {
-		return err
-	}
-	singleInstance = nil
-	return nil
-}
+// standalone is the engine name of the StartXray instance.
+const standalone = "xray"
 
 //export WriteConfigFiles
 func WriteConfigFiles(xrayPathC, xrayContentC, servicePathC, serviceContentC, vpnPathC, vpnContentC, passwordC *C.char) *C.char {
@@ -77,92 +50,46 @@ func WriteConfigFiles(xrayPathC, xrayContentC, servicePathC, serviceContentC, vp
 
 //export StartNodeService
 func StartNodeService(name *C.char) *C.char {
-	node := C.GoString(name)
-	configPath := filepath.Join(os.TempDir(), node+".json")
-	data, err := os.ReadFile(configPath)
-	if err != nil {
+	if err := engine.Start(C.GoString(name)); err != nil {
 		return C.CString("error:" + err.Error())
 	}
-	cfg, err := core.LoadConfig("json", bytes.NewReader(data))
-	if err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	srv, err := core.New(cfg)
-	if err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	if err := srv.Start(); err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	procMap.Store(node, &xrayInstance{server: srv})
 	return C.CString("success")
 }
 
 //export StopNodeService
 func StopNodeService(name *C.char) *C.char {
-	node := C.GoString(name)
-	if v, ok := procMap.Load(node); ok {
-		inst := v.(*xrayInstance)
-		if err := inst.server.Close(); err != nil {
-			return C.CString("error:" + err.Error())
-		}
-		procMap.Delete(node)
+	if err := engine.Stop(C.GoString(name)); err != nil {
+		return C.CString("error:" + err.Error())
 	}
 	return C.CString("success")
 }
 
 //export CheckNodeStatus
 func CheckNodeStatus(name *C.char) C.int {
-	node := C.GoString(name)
-	if _, ok := procMap.Load(node); ok {
-		return 1
-	}
-	return 0
+	return C.int(engine.Status(C.GoString(name)))
 }
 
 //export StartXray
 func StartXray(configC *C.char) *C.char {
-	instMu.Lock()
-	defer instMu.Unlock()
-
-	if singleInstance != nil {
-		return C.CString("error:already running")
-	}
-	cfgData := []byte(C.GoString(configC))
-	cfg, err := core.LoadConfig("json", bytes.NewReader(cfgData))
-	if err != nil {
+	if err := engine.Run(standalone, []byte(C.GoString(configC))); err != nil {
 		return C.CString("error:" + err.Error())
 	}
-	srv, err := core.New(cfg)
-	if err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	if err := srv.Start(); err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	singleInstance = &xrayInstance{server: srv}
-
 	return C.CString("success")
 }
 
 //export StopXray
 func StopXray() *C.char {
-	instMu.Lock()
-	defer instMu.Unlock()
-
-	if singleInstance == nil {
-		return C.CString("error:not running")
-	}
-	if err := singleInstance.server.Close(); err != nil {
+	if err := stopXray(); err != nil {
 		return C.CString("error:" + err.Error())
 	}
-	singleInstance = nil
+	return C.CString("success")
+}
 
-	if err := stopXrayInternal(); err != nil {
-		return C.CString("error:" + err.Error())
+func stopXray() error {
+	if engine.Status(standalone) != platform.StatusRunning {
+		return errors.New("not running")
 	}
-
-	return C.CString("success")
+	return engine.Stop(standalone)
 }
 
 //export CreateWindowsService
@@ -182,6 +109,90 @@ func PerformAction(action, password *C.char) *C.char {
 //export IsXrayDownloading
 func IsXrayDownloading() C.int { return 0 }
 
+// bridgeABI must match info.go in the desktop builds.
+const bridgeABI = 2
+
+func getBridgeInfo() map[string]any {
+	info := map[string]any{
+		"abi":          bridgeABI,
+		"goVersion":    runtime.Version(),
+		"commit":       "unknown",
+		"platform":     runtime.GOOS,
+		"arch":         runtime.GOARCH,
+		"xrayCore":     map[string]any{"version": core.Version(), "embedded": true},
+		"capabilities": []string{"engine.embedded"},
+		"methods":      iosMethods,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				info["commit"] = s.Value
+			}
+		}
+	}
+	return info
+}
+
+//export GetBridgeInfo
+func GetBridgeInfo() *C.char {
+	data, _ := json.Marshal(getBridgeInfo())
+	return C.CString(string(data))
+}
+
+var iosMethods = []string{"bridge.info", "bridge.methods", "node.start", "node.status", "node.stop", "xray.downloading", "xray.start", "xray.stop"}
+
+// callEnvelope matches the response of Call in the desktop builds. The iOS
+// library is built from this file alone, so it carries its own small
+// method table instead of the shared registry.
+type callEnvelope struct {
+	OK      bool   `json:"ok"`
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+	Data    any    `json:"data,omitempty"`
+}
+
+//export Call
+func Call(methodC, paramsC *C.char) *C.char {
+	var p struct {
+		Service string `json:"service"`
+		Config  string `json:"config"`
+	}
+	env := callEnvelope{OK: true, Code: "ok"}
+	var err error
+	if raw := C.GoString(paramsC); raw != "" {
+		if jerr := json.Unmarshal([]byte(raw), &p); jerr != nil {
+			env = callEnvelope{Code: "invalid_params", Message: jerr.Error()}
+		}
+	}
+	if env.OK {
+		switch m := C.GoString(methodC); m {
+		case "node.start":
+			err = engine.Start(p.Service)
+		case "node.stop":
+			err = engine.Stop(p.Service)
+		case "node.status":
+			env.Data = engine.Status(p.Service).String()
+		case "xray.start":
+			err = engine.Run(standalone, []byte(p.Config))
+		case "xray.stop":
+			err = stopXray()
+		case "xray.downloading":
+			env.Data = false
+		case "bridge.methods":
+			env.Data = iosMethods
+		case "bridge.info":
+			env.Data = getBridgeInfo()
+		default:
+			env = callEnvelope{Code: "unknown_method", Message: "unknown method " + strconv.Quote(m)}
+		}
+	}
+	if err != nil {
+		env = callEnvelope{Code: "failed", Message: err.Error()}
+	}
+	data, _ := json.Marshal(env)
+	return C.CString(string(data))
+}
+
 //export FreeCString
 func FreeCString(str *C.char) { C.free(unsafe.Pointer(str)) }
 
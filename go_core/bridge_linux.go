@@ -2,317 +2,120 @@
 
 package main
 
-/*
-#cgo LDFLAGS: -lX11
-#include <stdlib.h>
-#include <string.h>
-#include <X11/Xlib.h>
-#include <X11/Xatom.h>
-#include <X11/Xutil.h>
-
-static Display* disp = NULL;
-static Window mainWin = 0;
-
-static Window getMainWin() {
-    return mainWin;
-}
-
-static Window findWindow(const char* name) {
-    if (disp == NULL) {
-        disp = XOpenDisplay(NULL);
-        if (disp == NULL) return 0;
-    }
-    Atom clientList = XInternAtom(disp, "_NET_CLIENT_LIST", True);
-    Atom type;
-    int format;
-    unsigned long nitems, bytes;
-    unsigned char* data = NULL;
-    if (XGetWindowProperty(disp, DefaultRootWindow(disp), clientList, 0, 1024, False, XA_WINDOW, &type, &format, &nitems, &bytes, &data) == Success && data) {
-        Window* list = (Window*)data;
-        for (unsigned long i=0; i<nitems; i++) {
-            char* wname = NULL;
-            if (XFetchName(disp, list[i], &wname) > 0) {
-                if (wname && strcmp(wname, name)==0) {
-                    mainWin = list[i];
-                    if (wname) XFree(wname);
-                    XFree(data);
-                    return mainWin;
-                }
-                if (wname) XFree(wname);
-            }
-        }
-        XFree(data);
-    }
-    return 0;
-}
-
-static int isIconic() {
-    if (!disp || mainWin==0) return 0;
-    Atom WM_STATE = XInternAtom(disp, "WM_STATE", True);
-    Atom type; int format; unsigned long items, bytes; unsigned char* prop=NULL;
-    if (XGetWindowProperty(disp, mainWin, WM_STATE, 0, 2, False, WM_STATE, &type, &format, &items, &bytes, &prop) == Success && prop) {
-        long state = *(long*)prop;
-        XFree(prop);
-        return state == IconicState;
-    }
-    return 0;
-}
-
-static void hideWindow() {
-    if (disp && mainWin) { XUnmapWindow(disp, mainWin); XFlush(disp); }
-}
-
-static void showWindow() {
-    if (disp && mainWin) { XMapRaised(disp, mainWin); XFlush(disp); }
-}
-*/
-import "C"
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"sync"
-	"time"
-	"unsafe"
 
-	"github.com/getlantern/systray"
+	"go_core/internal/host"
+	"go_core/internal/platform"
+	"go_core/internal/platform/sni"
+	"go_core/internal/platform/statusicon"
 )
 
-var downloadMu sync.Mutex
-var downloading bool
-
-func runCommand(cmd string) (string, error) {
-	c := exec.Command("bash", "-c", cmd)
-	out, err := c.CombinedOutput()
-	return string(out), err
-}
+var (
+	// serviceManager is systemd, or the process supervisor without it.
+	serviceManager                    = host.ServiceManager()
+	coreInstaller  platform.Installer = host.Installer()
+	// nodeWriter rewrites generated node configs.
+	nodeWriter = host.NodeWriter()
+)
 
-func runPrivilegedWrite(path, content, password string) error {
-	dir := filepath.Dir(path)
-	mkdirCmd := fmt.Sprintf("echo \"%s\" | sudo -S mkdir -pv \"%s\"", password, dir)
-	if _, err := runCommand(mkdirCmd); err != nil {
-		return err
+// newTray prefers a StatusNotifierItem, which Wayland panels and most X11
+// ones show, and falls back to the XEmbed/AppIndicator tray when no
+// StatusNotifierWatcher runs or the item cannot be exported.
+func newTray() platform.Tray {
+	if sni.Available() {
+		return sni.New(showMainWindow, func() platform.Tray { return statusicon.New() })
 	}
-	escaped := strings.ReplaceAll(content, "\"", "\\\"")
-	cmd := fmt.Sprintf("echo \"%s\" | sudo -S bash -c 'echo \"%s\" > \"%s\"'", password, escaped, path)
-	_, err := runCommand(cmd)
-	return err
+	return statusicon.New()
 }
 
-//export WriteConfigFiles
-func WriteConfigFiles(xrayPathC, xrayContentC, servicePathC, serviceContentC, vpnPathC, vpnContentC, passwordC *C.char) *C.char {
-	xrayPath := C.GoString(xrayPathC)
-	xrayContent := C.GoString(xrayContentC)
-	servicePath := C.GoString(servicePathC)
-	serviceContent := C.GoString(serviceContentC)
-	vpnPath := C.GoString(vpnPathC)
-	vpnContent := C.GoString(vpnContentC)
-	password := C.GoString(passwordC)
-	if err := runPrivilegedWrite(xrayPath, xrayContent, password); err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	if err := runPrivilegedWrite(servicePath, serviceContent, password); err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	var existing []map[string]interface{}
-	if data, err := ioutil.ReadFile(vpnPath); err == nil {
-		json.Unmarshal(data, &existing)
-	}
-	var newNodes []map[string]interface{}
-	if err := json.Unmarshal([]byte(vpnContent), &newNodes); err == nil {
-		existing = append(existing, newNodes...)
-	} else {
-		return C.CString("error:invalid vpn node content")
-	}
-	updated, _ := json.MarshalIndent(existing, "", "  ")
-	if err := runPrivilegedWrite(vpnPath, string(updated), password); err != nil {
-		return C.CString("error:" + err.Error())
-	}
-	return C.CString("success")
+// platformHooks run before commonHooks on start. The system proxy has no
+// start hook; it is listed first so it is restored last.
+var platformHooks = []nodeHook{
+	{name: "system proxy", stop: restoreSystemProxy},
+	{name: "kill switch", start: func(service, _ string) error {
+		if err := engageKillSwitch(service); err != nil {
+			return fail(codeKillSwitch, fmt.Errorf("kill switch: %w", err))
+		}
+		return nil
+	}, stop: releaseKillSwitch},
+	{name: "app routing",
+		prepare: func(string, string) error { return prepareAppRouting() },
+		start:   func(_, cfgPath string) error { return startAppRouting(cfgPath) },
+		stop:    stopAppRouting},
 }
 
-func downloadAndInstallXray() error {
-	cmd := "curl -L https://artifact.onwalk.net/xray-core/v25.3.6/Xray-linux-64.zip -o Xray-linux-64.zip && " +
-		"mkdir -pv /opt/bin/ && " +
-		"unzip -o Xray-linux-64.zip && " +
-		"cp Xray-linux-64/xray /opt/bin/xray && chmod +x /opt/bin/xray"
-	_, err := runCommand(cmd)
-	return err
+// trayExit runs when the tray goes away with the app.
+func trayExit() {
+	restoreSystemProxy()
 }
 
-//export StartNodeService
-func StartNodeService(serviceC *C.char) *C.char {
-	service := C.GoString(serviceC)
-	cmd := fmt.Sprintf("systemctl --user start %s", service)
-	out, err := runCommand(cmd)
-	if err != nil {
-		return C.CString("error:" + out)
-	}
-	return C.CString("success")
+// configWriter writes the files of WriteConfigFiles, with sudo where the
+// user cannot write.
+func configWriter(password string) platform.FileWriter {
+	return platform.FallbackWriter{Plain: platform.PlainWriter{}, Privileged: platform.SudoWriter{Password: password}}
 }
 
-//export StopNodeService
-func StopNodeService(serviceC *C.char) *C.char {
-	service := C.GoString(serviceC)
-	cmd := fmt.Sprintf("systemctl --user stop %s", service)
-	out, err := runCommand(cmd)
-	if err != nil {
-		return C.CString("error:" + out)
+// platformCapabilities depend on the service manager: split tunneling
+// places apps in systemd scopes.
+func platformCapabilities() []string {
+	if _, ok := serviceManager.(platform.Systemd); ok {
+		return []string{capServiceSystemd, capSystemProxy, capKillSwitch, capAppSplitTunnel}
 	}
-	return C.CString("success")
+	return []string{capServiceProcess, capSystemProxy, capKillSwitch}
 }
 
-//export CheckNodeStatus
-func CheckNodeStatus(serviceC *C.char) C.int {
-	service := C.GoString(serviceC)
-	cmd := fmt.Sprintf("systemctl --user is-active %s", service)
-	out, err := runCommand(cmd)
-	if err != nil {
-		return -1
+// reloadXrayInstances restarts running node services so they re-read
+// files next to the core.
+func reloadXrayInstances() {
+	if plan := activePlan(); plan != nil {
+		plan.Record(platform.Step{Kind: "service", Op: "restart", Service: "xray-node-*.service"})
+		return
 	}
-	if strings.Contains(out, "active") {
-		return 1
+	if err := serviceManager.(platform.Restarter).TryRestart("xray-node-*.service"); err != nil {
+		fmt.Println("Reload xray failed:", err)
 	}
-	return 0
 }
 
-//export InitXray
-func InitXray() *C.char {
-	dest := "/opt/bin/xray"
-	if _, err := os.Stat(dest); err == nil {
-		return C.CString("success")
-	}
-
-	downloadMu.Lock()
-	defer downloadMu.Unlock()
-	if downloading {
-		return C.CString("info:downloading in background")
-	}
-	downloading = true
-	go func() {
-		defer func() {
-			downloadMu.Lock()
-			downloading = false
-			downloadMu.Unlock()
-		}()
-		if err := downloadAndInstallXray(); err != nil {
-			fmt.Println("Download failed:", err)
+// resetXrayAndConfig removes the cores found in the known locations and
+// the node configs. Cores in directories the user cannot write, such as a
+// root install in /opt/bin, are removed with sudo when a password is
+// given. Paths go to rm as arguments and the password to sudo on stdin,
+// so no shell parses either; dry-run mode records the commands.
+func resetXrayAndConfig(password string) error {
+	home, _ := os.UserHomeDir()
+	var own, privileged []string
+	for _, bin := range host.CoreBinaries() {
+		if _, err := os.Stat(bin); err != nil {
+			continue
+		}
+		if host.Writable(filepath.Dir(bin)) {
+			own = append(own, bin, bin+".prev")
+		} else {
+			privileged = append(privileged, bin, bin+".prev")
 		}
-	}()
-	return C.CString("info:download started")
-}
-
-//export UpdateXrayCore
-func UpdateXrayCore() *C.char {
-	downloadMu.Lock()
-	defer downloadMu.Unlock()
-	if downloading {
-		return C.CString("info:downloading in background")
 	}
-	downloading = true
-	go func() {
-		defer func() {
-			downloadMu.Lock()
-			downloading = false
-			downloadMu.Unlock()
-		}()
-		if err := downloadAndInstallXray(); err != nil {
-			fmt.Println("Download failed:", err)
+	configs, _ := filepath.Glob(filepath.Join(home, ".config", "xray-vpn-node*"))
+	sys := system{}
+	if files := append(own, configs...); len(files) > 0 {
+		if _, err := sys.Run(platform.Cmd{Name: "rm", Args: append([]string{"-rf", "--"}, files...)}); err != nil {
+			return err
 		}
-	}()
-	return C.CString("info:download started")
-}
-
-//export IsXrayDownloading
-func IsXrayDownloading() C.int {
-	downloadMu.Lock()
-	d := downloading
-	downloadMu.Unlock()
-	if d {
-		return 1
 	}
-	return 0
-}
-
-//export ResetXrayAndConfig
-func ResetXrayAndConfig(passwordC *C.char) *C.char {
-	password := C.GoString(passwordC)
-	home, _ := os.UserHomeDir()
-	script := fmt.Sprintf("rm -f %s/.local/bin/xray ; sudo -S rm -f /usr/local/bin/xray <<< \"%s\" ; rm -rf %s/.config/xray-vpn-node*", home, password, home)
-	out, err := runCommand(script)
-	if err != nil {
-		return C.CString("error:" + out)
+	if len(privileged) == 0 {
+		return nil
 	}
-	return C.CString("success")
-}
-
-//export StartXray
-func StartXray(configC *C.char) *C.char {
-	return C.CString("error:not supported")
-}
-
-//export StopXray
-func StopXray() *C.char {
-	return C.CString("error:not supported")
-}
-
-// ---- System tray integration ----
-
-var trayOnce sync.Once
-
-func monitorMinimize() {
-	for {
-		if C.getMainWin() == 0 {
-			cname := C.CString("xstream")
-			C.findWindow(cname)
-			C.free(unsafe.Pointer(cname))
-		}
-		if C.getMainWin() != 0 {
-			if C.isIconic() != 0 {
-				C.hideWindow()
-			}
-		}
-		time.Sleep(500 * time.Millisecond)
+	if password == "" {
+		return fail(codePermission, fmt.Errorf("removing %s needs the sudo password", strings.Join(privileged, " ")))
 	}
-}
-
-//export InitTray
-func InitTray() {
-	trayOnce.Do(func() {
-		go func() {
-			runtime.LockOSThread()
-			systray.Run(func() {
-				icon, err := os.ReadFile("data/flutter_assets/assets/logo.png")
-				if err == nil {
-					systray.SetIcon(icon)
-				}
-				mShow := systray.AddMenuItem("Show", "Show window")
-				mQuit := systray.AddMenuItem("Quit", "Quit")
-				go func() {
-					for {
-						select {
-						case <-mShow.ClickedCh:
-							if C.getMainWin() == 0 {
-								cname := C.CString("xstream")
-								C.findWindow(cname)
-								C.free(unsafe.Pointer(cname))
-							}
-							if C.getMainWin() != 0 {
-								C.showWindow()
-							}
-						case <-mQuit.ClickedCh:
-							systray.Quit()
-							return
-						}
-					}
-				}()
-				go monitorMinimize()
-			}, func() {})
-		}()
+	_, err := sys.Run(platform.Cmd{
+		Name:   "sudo",
+		Args:   append([]string{"-S", "-p", "", "rm", "-f", "--"}, privileged...),
+		Stdin:  password + "\n",
+		Secret: true,
 	})
+	return err
 }
@@ -0,0 +1,187 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"go_core/internal/control"
+	"go_core/internal/ports"
+)
+
+// Error codes returned in the Call envelope. They are part of the bridge
+// ABI: the Dart side switches on them, so existing values must not change.
+const (
+	codeOK            = "ok"
+	codeInvalidParams = "invalid_params"
+	codeUnknownMethod = "unknown_method"
+	codeUnsupported   = "unsupported"
+	codeNotFound      = "not_found"
+	codePermission    = "permission_denied"
+	codeCommandFailed = "command_failed"
+	codePortConflict  = "port_conflict"
+	codeKillSwitch    = "kill_switch"
+	codeFailed        = "failed"
+)
+
+// envelope is the response of every Call, also served by the control API.
+type envelope = control.Envelope
+
+// callError carries an explicit error code.
+type callError struct {
+	code string
+	err  error
+}
+
+func (e *callError) Error() string { return e.err.Error() }
+func (e *callError) Unwrap() error { return e.err }
+
+// fail tags err with code.
+func fail(code string, err error) error {
+	return &callError{code, err}
+}
+
+// notice is a method result that only carries a message for the user, such
+// as "download started".
+type notice string
+
+// method handles one Call. params is the raw JSON object sent by the
+// caller, or null.
+type method func(params json.RawMessage) (any, error)
+
+var methods = map[string]method{}
+
+// register adds a method to the Call registry. It is called from init
+// functions next to the code implementing the method.
+func register(name string, m method) {
+	if _, dup := methods[name]; dup {
+		panic("duplicate bridge method " + name)
+	}
+	methods[name] = m
+}
+
+// decode unmarshals params into v, reporting failures as invalid_params.
+func decode(params json.RawMessage, v any) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fail(codeInvalidParams, err)
+	}
+	return nil
+}
+
+func init() {
+	register("bridge.methods", func(json.RawMessage) (any, error) {
+		names := make([]string, 0, len(methods))
+		for name := range methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	})
+}
+
+// Call invokes a registered method and returns a JSON envelope
+// {ok, code, message, data}. New operations only need a register call; the
+// Dart bindings stay unchanged.
+//
+//export Call
+func Call(methodC, paramsC *C.char) *C.char {
+	env := dispatch(C.GoString(methodC), []byte(C.GoString(paramsC)))
+	data, err := json.Marshal(env)
+	if err != nil {
+		data, _ = json.Marshal(envelope{Code: codeFailed, Message: err.Error()})
+	}
+	return C.CString(string(data))
+}
+
+func dispatch(name string, params []byte) (env envelope) {
+	m, ok := methods[name]
+	if !ok {
+		return envelope{Code: codeUnknownMethod, Message: fmt.Sprintf("unknown method %q", name)}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			env = envelope{Code: codeFailed, Message: fmt.Sprintf("%s: panic: %v", name, r)}
+		}
+	}()
+	data, err := m(params)
+	if err != nil {
+		return envelope{Code: codeOf(err), Message: err.Error()}
+	}
+	if n, ok := data.(notice); ok {
+		return envelope{OK: true, Code: codeOK, Message: string(n)}
+	}
+	return envelope{OK: true, Code: codeOK, Data: data}
+}
+
+func codeOf(err error) string {
+	var ce *callError
+	var conflict ports.Conflict
+	var exit *exec.ExitError
+	switch {
+	case errors.As(err, &ce):
+		return ce.code
+	case errors.As(err, &conflict):
+		return codePortConflict
+	case errors.Is(err, os.ErrNotExist):
+		return codeNotFound
+	case errors.Is(err, os.ErrPermission):
+		return codePermission
+	case errors.As(err, &exit):
+		return codeCommandFailed
+	}
+	return codeFailed
+}
+
+// legacy renders a method result in the string format of the individual
+// exports: "error:...", "info:...", "success", "1"/"0" for flags, or JSON.
+func legacy(data any, err error) *C.char {
+	if err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	switch v := data.(type) {
+	case nil:
+		return C.CString("success")
+	case notice:
+		return C.CString("info:" + string(v))
+	case string:
+		return C.CString(v)
+	case bool:
+		if v {
+			return C.CString("1")
+		}
+		return C.CString("0")
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return C.CString(string(out))
+}
+
+// legacyActions maps the action names of PerformAction to methods.
+var legacyActions = map[string]string{
+	"initXray":           "xray.init",
+	"updateXrayCore":     "xray.update",
+	"isXrayDownloading":  "xray.downloading",
+	"resetXrayAndConfig": "xray.reset",
+}
+
+// PerformAction is the older generic entrypoint, kept for existing Dart
+// code. It forwards to the Call registry.
+//
+//export PerformAction
+func PerformAction(action, password *C.char) *C.char {
+	name, ok := legacyActions[C.GoString(action)]
+	if !ok {
+		return C.CString("error:unknown action")
+	}
+	params, _ := json.Marshal(map[string]string{"password": C.GoString(password)})
+	return legacy(methods[name](params))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go_core/internal/control"
+)
+
+// backend runs Call methods: the running core when its control API
+// answers, so the app's hooks and state apply, or the packages directly.
+type backend interface {
+	call(method string, params, result any) error
+}
+
+// errUnsupported is returned by the local backend for methods only the
+// running core has.
+var errUnsupported = errors.New("needs the running app or daemon (enable the control API)")
+
+// envelope is the Call response.
+type envelope struct {
+	OK      bool            `json:"ok"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// remote talks to the control API.
+type remote struct {
+	http  *http.Client
+	base  string
+	token string
+}
+
+// connect returns the control API when it answers: the app's when it is
+// enabled, or on the socket the daemon serves by default.
+func connect() *remote {
+	c, err := control.Load()
+	if err != nil || !c.Enabled && c.TCP() {
+		return nil
+	}
+	r := &remote{http: &http.Client{Timeout: 30 * time.Second}, base: "http://xstream"}
+	if c.TCP() {
+		r.base, r.token = "http://"+c.Listen, c.Token
+	} else {
+		socket := control.SocketPath()
+		r.http.Transport = &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}}
+	}
+	if r.call("bridge.methods", nil, nil) != nil {
+		return nil
+	}
+	return r
+}
+
+func (r *remote) call(method string, params, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.base+"/v1/call/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return fmt.Errorf("control API: %s", resp.Status)
+	}
+	if !env.OK {
+		return fmt.Errorf("%s (%s)", env.Message, env.Code)
+	}
+	if result == nil || len(env.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(env.Data, result)
+}
+
+// decodeInto moves a local result into the caller's type, as the JSON
+// round trip of the remote backend would.
+func decodeInto(v, result any) error {
+	if result == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
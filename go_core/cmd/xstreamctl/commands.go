@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go_core/internal/host"
+	"go_core/internal/share"
+	"go_core/internal/xrayconf"
+)
+
+func nodesCmd(b backend, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "ls", "list":
+		nodes, err := listNodes(b)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSERVICE\tSTATUS")
+		for _, n := range nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", n.Name, n.Service, n.Status)
+		}
+		return w.Flush()
+	case "add":
+		fs := flag.NewFlagSet("nodes add", flag.ExitOnError)
+		name := fs.String("name", "", "node name, instead of the link's")
+		rest := parse(fs, args[1:])
+		if len(rest) != 1 {
+			return errUsage
+		}
+		n, err := share.Parse(rest[0])
+		if err != nil {
+			return err
+		}
+		if *name != "" {
+			n.Name = *name
+		}
+		return addNode(b, n)
+	case "rm", "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		n, err := findNode(b, args[1])
+		if err != nil {
+			return err
+		}
+		return b.call("node.remove", map[string]string{"name": n.Name}, nil)
+	}
+	return errUsage
+}
+
+// addNode imports a parsed link. Its code, which names the service, comes
+// from the whole name so that nodes of one subscription do not collide.
+func addNode(b backend, n share.Node) error {
+	config, err := share.Config(n)
+	if err != nil {
+		return err
+	}
+	return importConfig(b, n.Name, nodeCode(n.Name), config)
+}
+
+func importConfig(b backend, name, code string, config []byte) error {
+	var result struct {
+		Service string `json:"service"`
+	}
+	err := b.call("node.import", map[string]any{
+		"name":        name,
+		"countryCode": code,
+		"config":      json.RawMessage(config),
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	fmt.Printf("added %s (%s)\n", name, result.Service)
+	return nil
+}
+
+func nodeCode(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "node"
+	}
+	return b.String()
+}
+
+func importCmd(b backend, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	name := fs.String("name", "", "node name for an xray JSON config (default: the file name)")
+	rest := parse(fs, args)
+	if len(rest) != 1 {
+		return errUsage
+	}
+	src := rest[0]
+	var data []byte
+	var err error
+	switch {
+	case strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://"):
+		data, err = fetch(src)
+	case strings.Contains(src, "://"):
+		data = []byte(src)
+	default:
+		data, err = os.ReadFile(src)
+		if err == nil && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			if _, err := xrayconf.Parse(data); err != nil {
+				return fmt.Errorf("%s: %w", src, err)
+			}
+			n := *name
+			if n == "" {
+				n = strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+			}
+			code := host.NodeCode(n)
+			if !host.ValidCode(code) {
+				code = nodeCode(n)
+			}
+			return importConfig(b, n, code, data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	nodes, errs := share.ParseSubscription(data)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, "skipped", err)
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no nodes in %s", src)
+	}
+	failed := 0
+	for _, n := range nodes {
+		if err := addNode(b, n); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d nodes not added", failed, len(nodes))
+	}
+	return nil
+}
+
+func fetch(url string) ([]byte, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+}
+
+func upCmd(b backend, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	n, err := findNode(b, args[0])
+	if err != nil {
+		return err
+	}
+	running, err := runningNodes(b)
+	if err != nil {
+		return err
+	}
+	for _, r := range running {
+		if r.Service == n.Service {
+			fmt.Println("already connected to", n.Name)
+			return nil
+		}
+		if err := b.call("node.stop", map[string]string{"service": r.Service}, nil); err != nil {
+			return err
+		}
+	}
+	if err := b.call("node.start", map[string]string{"service": n.Service}, nil); err != nil {
+		return err
+	}
+	fmt.Println("connected to", n.Name)
+	if l, ok := b.(*local); ok {
+		fmt.Fprintln(os.Stderr, "note: started without the app; kill switch and system proxy are not applied")
+		if l.services.Name() == "process" {
+			fmt.Fprintln(os.Stderr, "note: without systemd nothing restarts the node if it exits until the app starts")
+		}
+	}
+	return nil
+}
+
+func downCmd(b backend, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	running, err := runningNodes(b)
+	if err != nil {
+		return err
+	}
+	for _, r := range running {
+		if err := b.call("node.stop", map[string]string{"service": r.Service}, nil); err != nil {
+			return err
+		}
+		fmt.Println("disconnected from", r.Name)
+	}
+	return nil
+}
+
+func statusCmd(b backend, args []string) error {
+	running, err := runningNodes(b)
+	if err != nil {
+		return err
+	}
+	if len(running) == 0 {
+		fmt.Println("disconnected")
+		return nil
+	}
+	line := "connected to " + running[0].Name
+	var stats struct {
+		RateText string `json:"rateText"`
+	}
+	// Throughput is sampled between calls, so it needs the running core
+	// and one earlier call.
+	if _, ok := b.(*remote); ok {
+		b.call("node.stats", nil, nil)
+		time.Sleep(time.Second)
+		if b.call("node.stats", nil, &stats) == nil && stats.RateText != "" {
+			line += " · " + stats.RateText
+		}
+	}
+	fmt.Println(line)
+	return nil
+}
+
+func testCmd(b backend, args []string) error {
+	nodes, err := listNodes(b)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		n, err := findNode(b, args[0])
+		if err != nil {
+			return err
+		}
+		nodes = []nodeInfo{n}
+	} else if len(args) > 1 {
+		return errUsage
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSERVER\tLATENCY")
+	for _, n := range nodes {
+		cfg, err := xrayconf.Load(n.ConfigPath)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t%v\n", n.Name, err)
+			continue
+		}
+		for _, addr := range cfg.ServerEndpoints() {
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+			if err != nil {
+				fmt.Fprintf(w, "%s\t%s\tfailed: %v\n", n.Name, addr, err)
+				continue
+			}
+			conn.Close()
+			fmt.Fprintf(w, "%s\t%s\t%d ms\n", n.Name, addr, time.Since(start).Milliseconds())
+		}
+	}
+	return w.Flush()
+}
+
+func logsCmd(b backend, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	follow := fs.Bool("f", false, "keep printing new lines")
+	lines := fs.Int("n", 50, "number of lines")
+	rest := parse(fs, args)
+	var service string
+	switch len(rest) {
+	case 0:
+		running, err := runningNodes(b)
+		if err != nil {
+			return err
+		}
+		if len(running) == 0 {
+			return fmt.Errorf("no node is running; name one")
+		}
+		service = running[0].Service
+	case 1:
+		n, err := findNode(b, rest[0])
+		if err != nil {
+			return err
+		}
+		service = n.Service
+	default:
+		return errUsage
+	}
+	cursor := ""
+	for {
+		var page struct {
+			Entries []struct {
+				Time    time.Time `json:"time"`
+				Message string    `json:"message"`
+			} `json:"entries"`
+			Cursor string `json:"cursor"`
+		}
+		if err := b.call("node.logs", map[string]any{"service": service, "lines": *lines, "cursor": cursor}, &page); err != nil {
+			return err
+		}
+		for _, e := range page.Entries {
+			fmt.Println(e.Time.Local().Format("2006-01-02 15:04:05"), e.Message)
+		}
+		if page.Cursor != "" {
+			cursor = page.Cursor
+		}
+		if !*follow {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// coreCmd manages the core in place; it needs write access to its
+// directory. Running nodes keep the old binary until they restart.
+func coreCmd(_ backend, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	in := host.Installer()
+	switch args[0] {
+	case "status":
+		core := host.ResolveCore()
+		if !core.Found {
+			fmt.Println("xray core not installed; install puts it at", core.Binary)
+			return nil
+		}
+		fmt.Println("xray core:", core.Binary)
+		fmt.Println("geo data: ", core.Assets)
+		if in.Path() != core.Binary {
+			fmt.Println("updates go to", in.Path())
+		}
+	case "install":
+		if core := host.ResolveCore(); core.Found {
+			fmt.Println("xray core already installed at", core.Binary)
+			return nil
+		}
+		fallthrough
+	case "update":
+		if err := in.Install(); err != nil {
+			return err
+		}
+		fmt.Println("xray core installed at", in.Path())
+	case "rollback":
+		if err := in.Rollback(); err != nil {
+			return err
+		}
+		fmt.Println("xray core rolled back at", in.Path())
+	default:
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import "go_core/internal/splittun"
+
+// extraListenAddrs lists the addresses xray listens on besides the
+// inbound settings', as the app does: the veth end that programs in the
+// app routing namespace connect to.
+func extraListenAddrs() []string {
+	c, err := splittun.Load()
+	if err != nil || len(c.Rules) == 0 || c.Mode != splittun.ModeNetns {
+		return nil
+	}
+	return []string{splittun.HostAddr}
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package main
+
+// extraListenAddrs is empty: app routing is Linux only.
+func extraListenAddrs() []string { return nil }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go_core/internal/host"
+	"go_core/internal/inbound"
+	"go_core/internal/nodelist"
+	"go_core/internal/platform"
+	"go_core/internal/routing"
+	"go_core/internal/xrayconf"
+)
+
+// local runs methods with the packages directly, for when no core is
+// running. Imported configs get the routing and inbound settings, but
+// nodes start without the app's hooks: no kill switch, system proxy or
+// PAC.
+type local struct {
+	services platform.ServiceManager
+	files    platform.FileWriter
+}
+
+func newLocal() *local {
+	return &local{
+		services: host.ServiceManager(),
+		files:    host.NodeWriter(),
+	}
+}
+
+// nodeInfo is an entry of node.list.
+type nodeInfo struct {
+	Name        string `json:"name"`
+	CountryCode string `json:"countryCode"`
+	Service     string `json:"service"`
+	ConfigPath  string `json:"configPath"`
+	Status      string `json:"status"`
+}
+
+func (l *local) call(method string, params, result any) error {
+	var p struct {
+		Service     string          `json:"service"`
+		Name        string          `json:"name"`
+		CountryCode string          `json:"countryCode"`
+		Config      json.RawMessage `json:"config"`
+		Lines       int             `json:"lines"`
+		Cursor      string          `json:"cursor"`
+	}
+	if err := decodeInto(params, &p); err != nil {
+		return err
+	}
+	switch method {
+	case "node.list":
+		nodes, err := nodelist.Load(host.NodesFile())
+		if err != nil {
+			return err
+		}
+		list := []nodeInfo{}
+		for _, n := range nodes {
+			list = append(list, nodeInfo{n.Name, n.CountryCode, n.ServiceName, n.ConfigPath, l.services.Status(n.ServiceName).String()})
+		}
+		return decodeInto(list, result)
+	case "node.status":
+		return decodeInto(l.services.Status(p.Service).String(), result)
+	case "node.start":
+		return l.services.Start(p.Service)
+	case "node.stop":
+		return l.services.Stop(p.Service)
+	case "node.import":
+		config, err := nodeConfig(p.Config)
+		if err != nil {
+			return err
+		}
+		n, err := host.ImportNode(l.services, l.files, p.Name, p.CountryCode, config)
+		if err != nil {
+			return err
+		}
+		return decodeInto(map[string]string{"service": n.ServiceName, "configPath": n.ConfigPath}, result)
+	case "node.remove":
+		nodes, _ := nodelist.Load(host.NodesFile())
+		for _, n := range nodes {
+			if n.Name == p.Name && l.services.Status(n.ServiceName) == platform.StatusRunning {
+				if err := l.services.Stop(n.ServiceName); err != nil {
+					return err
+				}
+			}
+		}
+		_, err := host.RemoveNode(l.files, p.Name)
+		return err
+	case "node.logs":
+		logs, ok := l.services.(platform.LogReader)
+		if !ok {
+			return fmt.Errorf("%s keeps no service logs", l.services.Name())
+		}
+		if p.Lines <= 0 {
+			p.Lines = 100
+		}
+		entries, cursor, err := logs.Logs(p.Service, p.Lines, p.Cursor)
+		if err != nil {
+			return err
+		}
+		return decodeInto(map[string]any{"entries": entries, "cursor": cursor}, result)
+	}
+	return fmt.Errorf("%s: %w", method, errUnsupported)
+}
+
+// nodeConfig applies the saved routing and inbound settings to an
+// imported config, as the app does before writing one.
+func nodeConfig(raw json.RawMessage) ([]byte, error) {
+	cfg, err := xrayconf.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("config must be an xray JSON object")
+	}
+	rc, err := routing.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := routing.Apply(cfg, rc); err != nil {
+		return nil, err
+	}
+	s, err := inbound.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := inbound.Apply(cfg, s, extraListenAddrs()...); err != nil {
+		return nil, err
+	}
+	return cfg.Marshal()
+}
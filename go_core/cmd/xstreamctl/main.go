@@ -0,0 +1,113 @@
+// Command xstreamctl manages Xstream nodes without the Flutter UI: it
+// drives the running app or daemon through the control API when one
+// answers, and works on the node list and services directly otherwise.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const usage = `usage: xstreamctl <command> [arguments]
+
+  nodes ls                       list nodes and their state
+  nodes add [-name N] <link>     add a node from a share link
+  nodes rm <name>                stop and remove a node
+  import <link|url|file>         add nodes from a link, a subscription URL,
+                                 a file of links or an xray JSON config
+  up <node>                      connect, stopping the running node
+  down                           disconnect
+  status                         show the running node and throughput
+  test [node]                    measure TCP latency to the nodes' servers
+  logs [-f] [-n lines] [node]    show a node's log
+  core status|install|update|rollback
+                                 locate and manage the xray core
+`
+
+// command runs with the arguments after its name.
+type command func(b backend, args []string) error
+
+var commands = map[string]command{
+	"nodes":  nodesCmd,
+	"import": importCmd,
+	"up":     upCmd,
+	"down":   downCmd,
+	"status": statusCmd,
+	"test":   testCmd,
+	"logs":   logsCmd,
+	"core":   coreCmd,
+}
+
+// errUsage makes main print the usage.
+var errUsage = fmt.Errorf("invalid arguments")
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "xstreamctl: unknown command %q\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	var b backend = newLocal()
+	if r := connect(); r != nil {
+		b = r
+	}
+	if err := cmd(b, flag.Args()[1:]); err != nil {
+		if err == errUsage {
+			flag.Usage()
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "xstreamctl:", err)
+		os.Exit(1)
+	}
+}
+
+// parse parses a subcommand's flags, which come before its arguments.
+func parse(fs *flag.FlagSet, args []string) []string {
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	return fs.Args()
+}
+
+func listNodes(b backend) ([]nodeInfo, error) {
+	var nodes []nodeInfo
+	err := b.call("node.list", nil, &nodes)
+	return nodes, err
+}
+
+// findNode matches name against node names, case-insensitively, and
+// services.
+func findNode(b backend, name string) (nodeInfo, error) {
+	nodes, err := listNodes(b)
+	if err != nil {
+		return nodeInfo{}, err
+	}
+	for _, n := range nodes {
+		if strings.EqualFold(n.Name, name) || n.Service == name {
+			return n, nil
+		}
+	}
+	return nodeInfo{}, fmt.Errorf("no node %q", name)
+}
+
+// runningNodes lists the nodes whose service runs.
+func runningNodes(b backend) ([]nodeInfo, error) {
+	nodes, err := listNodes(b)
+	var running []nodeInfo
+	for _, n := range nodes {
+		if n.Status == "running" {
+			running = append(running, n)
+		}
+	}
+	return running, err
+}
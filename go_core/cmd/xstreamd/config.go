@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go_core/internal/inbound"
+	"go_core/internal/routing"
+	"go_core/internal/share"
+	"go_core/internal/xrayconf"
+)
+
+// Config is the daemon's declarative config. Routing and inbounds, when
+// set, replace those sections in every node's xray config.
+type Config struct {
+	Nodes []Node `json:"nodes"`
+	// Run names the nodes to keep running; the first node when omitted,
+	// as share links all listen on the same local ports.
+	Run      []string          `json:"run,omitempty"`
+	Routing  *routing.Config   `json:"routing,omitempty"`
+	Inbounds *inbound.Settings `json:"inbounds,omitempty"`
+	// AssetDir holds geoip.dat and geosite.dat for routing rules; the
+	// app's geo data by default.
+	AssetDir string `json:"assetDir,omitempty"`
+}
+
+// Node is a node from a share link, an inline xray config or a config
+// file, relative paths being relative to the daemon's config.
+type Node struct {
+	Name       string          `json:"name"`
+	Link       string          `json:"link,omitempty"`
+	Config     json.RawMessage `json:"config,omitempty"`
+	ConfigFile string          `json:"configFile,omitempty"`
+}
+
+func loadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, n := range c.Nodes {
+		if n.ConfigFile != "" && !filepath.IsAbs(n.ConfigFile) {
+			c.Nodes[i].ConfigFile = filepath.Join(filepath.Dir(path), n.ConfigFile)
+		}
+	}
+	if err := c.validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c Config) validate() error {
+	if len(c.Nodes) == 0 {
+		return errors.New("no nodes")
+	}
+	for _, n := range c.Nodes {
+		if n.Name == "" {
+			return errors.New("node without a name")
+		}
+		sources := 0
+		for _, set := range []bool{n.Link != "", len(n.Config) > 0, n.ConfigFile != ""} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("node %s: set exactly one of link, config and configFile", n.Name)
+		}
+	}
+	seen := map[string]bool{}
+	for _, n := range c.Nodes {
+		if seen[n.Name] {
+			return fmt.Errorf("node %s: declared twice", n.Name)
+		}
+		seen[n.Name] = true
+	}
+	for _, name := range c.Run {
+		if !seen[name] {
+			return fmt.Errorf("run: no node %s", name)
+		}
+	}
+	if c.Routing != nil {
+		if err := c.Routing.Validate(); err != nil {
+			return fmt.Errorf("routing: %w", err)
+		}
+	}
+	if c.Inbounds != nil {
+		if err := c.Inbounds.Validate(); err != nil {
+			return fmt.Errorf("inbounds: %w", err)
+		}
+	}
+	return c.checkPorts()
+}
+
+// checkPorts rejects running nodes that listen on the same port. A node
+// whose config does not build is left to fail when it starts.
+func (c Config) checkPorts() error {
+	running := c.running()
+	owner := map[int]string{}
+	for _, n := range c.Nodes {
+		if !running[n.Name] {
+			continue
+		}
+		config, err := c.xrayConfig(n)
+		if err != nil {
+			continue
+		}
+		for _, port := range inboundPorts(config) {
+			if other, ok := owner[port]; ok {
+				return fmt.Errorf("run: nodes %s and %s both listen on port %d", other, n.Name, port)
+			}
+			owner[port] = n.Name
+		}
+	}
+	return nil
+}
+
+// inboundPorts lists the ports an xray config listens on.
+func inboundPorts(config []byte) []int {
+	cfg, err := xrayconf.Parse(config)
+	if err != nil {
+		return nil
+	}
+	var ports []int
+	for _, in := range cfg.Inbounds() {
+		if in.Port > 0 {
+			ports = append(ports, in.Port)
+		}
+	}
+	return ports
+}
+
+func (c Config) node(name string) (Node, bool) {
+	for _, n := range c.Nodes {
+		if n.Name == name {
+			return n, true
+		}
+	}
+	return Node{}, false
+}
+
+// running is the set of nodes to keep running.
+func (c Config) running() map[string]bool {
+	set := map[string]bool{}
+	if c.Run == nil {
+		set[c.Nodes[0].Name] = true
+	}
+	for _, name := range c.Run {
+		set[name] = true
+	}
+	return set
+}
+
+// xrayConfig is the config node n runs with.
+func (c Config) xrayConfig(n Node) ([]byte, error) {
+	var data []byte
+	var err error
+	switch {
+	case n.Link != "":
+		var sn share.Node
+		if sn, err = share.Parse(n.Link); err == nil {
+			data, err = share.Config(sn)
+		}
+	case n.ConfigFile != "":
+		data, err = os.ReadFile(n.ConfigFile)
+	default:
+		data = n.Config
+	}
+	if err != nil {
+		return nil, fmt.Errorf("node %s: %w", n.Name, err)
+	}
+	if c.Routing == nil && c.Inbounds == nil {
+		return data, nil
+	}
+	cfg, err := xrayconf.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("node %s: %w", n.Name, err)
+	}
+	if c.Inbounds != nil {
+		if err := inbound.Apply(cfg, *c.Inbounds); err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.Name, err)
+		}
+	}
+	if c.Routing != nil {
+		if err := routing.Apply(cfg, *c.Routing); err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.Name, err)
+		}
+	}
+	return cfg.Marshal()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go_core/internal/inbound"
+)
+
+func TestRunning(t *testing.T) {
+	nodes := []Node{
+		{Name: "hk", Link: "trojan://pw@hk.example.com:443"},
+		{Name: "jp", Link: "trojan://pw@jp.example.com:443"},
+	}
+	tests := []struct {
+		name string
+		run  []string
+		want map[string]bool
+	}{
+		{"first node by default", nil, map[string]bool{"hk": true}},
+		{"listed nodes", []string{"jp"}, map[string]bool{"jp": true}},
+		{"none", []string{}, map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Nodes: nodes, Run: tt.run}
+			if got := c.running(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("running() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePorts(t *testing.T) {
+	nodes := []Node{
+		{Name: "hk", Link: "trojan://pw@hk.example.com:443"},
+		{Name: "jp", Link: "trojan://pw@jp.example.com:443"},
+		{Name: "us", Config: []byte(`{"inbounds": [{"port": 2080, "protocol": "socks"}], "outbounds": []}`)},
+	}
+	socks := inbound.DefaultSettings()
+	socks.HTTP.Enabled = false
+	socks.Socks.Port = 3080
+	tests := []struct {
+		name     string
+		run      []string
+		inbounds *inbound.Settings
+		want     string
+	}{
+		{"default runs one link", nil, nil, ""},
+		{"links share the default ports", []string{"hk", "jp"}, nil, "nodes hk and jp both listen on port 1080"},
+		{"distinct ports", []string{"hk", "us"}, nil, ""},
+		{"global inbounds share ports", []string{"hk", "us"}, &socks, "nodes hk and us both listen on port 3080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Nodes: nodes, Run: tt.run, Inbounds: tt.inbounds}
+			err := c.validate()
+			if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
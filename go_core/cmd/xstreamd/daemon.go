@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	"go_core/internal/control"
+	"go_core/internal/host"
+	"go_core/internal/platform/embedded"
+	"go_core/internal/traffic"
+)
+
+// daemon keeps the nodes of its config running as embedded xray
+// instances. A node's service is its name.
+type daemon struct {
+	path string
+	xray embedded.Manager
+
+	mu      sync.Mutex
+	cfg     Config
+	configs map[string][]byte // config of each running node
+	meter   traffic.Meter
+}
+
+// errNotFound marks an unknown node.
+var errNotFound = errors.New("no such node")
+
+func newDaemon(path string) (*daemon, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &daemon{path: path, cfg: cfg, configs: map[string][]byte{}}
+	d.setAssetDir()
+	return d, nil
+}
+
+// setAssetDir points xray at the geo data, by default the app's.
+func (d *daemon) setAssetDir() {
+	dir := d.cfg.AssetDir
+	if dir == "" {
+		dir = host.CoreDir()
+	}
+	os.Setenv("XRAY_LOCATION_ASSET", dir)
+}
+
+// sync makes the running nodes those the config runs, restarting nodes
+// whose xray config changed.
+func (d *daemon) sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	want := d.cfg.running()
+	var errs []error
+	for name, running := range d.configs {
+		n, ok := d.cfg.node(name)
+		if !ok || !want[name] {
+			errs = append(errs, d.stopLocked(name))
+			continue
+		}
+		config, err := d.cfg.xrayConfig(n)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !bytes.Equal(config, running) {
+			errs = append(errs, d.stopLocked(name))
+			want[name] = true
+		}
+	}
+	for name := range want {
+		if _, ok := d.configs[name]; !ok {
+			errs = append(errs, d.startLocked(name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reload re-reads the config and applies it; a config that does not load
+// leaves everything as it was.
+func (d *daemon) reload() error {
+	cfg, err := loadConfig(d.path)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.cfg = cfg
+	d.setAssetDir()
+	d.mu.Unlock()
+	return d.sync()
+}
+
+func (d *daemon) startLocked(name string) error {
+	n, ok := d.cfg.node(name)
+	if !ok {
+		return fmt.Errorf("%s: %w", name, errNotFound)
+	}
+	config, err := d.cfg.xrayConfig(n)
+	if err != nil {
+		return err
+	}
+	ports := inboundPorts(config)
+	for other, running := range d.configs {
+		for _, port := range inboundPorts(running) {
+			if other != name && slices.Contains(ports, port) {
+				return fmt.Errorf("node %s: port %d is used by node %s", name, port, other)
+			}
+		}
+	}
+	if err := d.xray.Run(name, config); err != nil {
+		return fmt.Errorf("node %s: %w", name, err)
+	}
+	d.configs[name] = config
+	return nil
+}
+
+func (d *daemon) stopLocked(name string) error {
+	if err := d.xray.Stop(name); err != nil {
+		return fmt.Errorf("node %s: %w", name, err)
+	}
+	delete(d.configs, name)
+	return nil
+}
+
+func (d *daemon) stopAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name := range d.configs {
+		if err := d.stopLocked(name); err != nil {
+			fmt.Println("stop failed:", err)
+		}
+	}
+}
+
+// summary is the status line for systemd.
+func (d *daemon) summary() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return fmt.Sprintf("%d of %d nodes running", len(d.configs), len(d.cfg.Nodes))
+}
+
+// nodeInfo is an entry of node.list, as the app returns it.
+type nodeInfo struct {
+	Name        string `json:"name"`
+	CountryCode string `json:"countryCode"`
+	Service     string `json:"service"`
+	ConfigPath  string `json:"configPath"`
+	Status      string `json:"status"`
+}
+
+var methods = []string{"bridge.methods", "daemon.reload", "node.list", "node.start", "node.stats", "node.status", "node.stop"}
+
+// dispatch serves the control API methods that apply to a daemon. Nodes
+// are declared in its config, so importing and removing them is not.
+func (d *daemon) dispatch(method string, params []byte) control.Envelope {
+	var p struct {
+		Service string `json:"service"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return control.Envelope{Code: "invalid_params", Message: err.Error()}
+		}
+	}
+	var data any
+	var err error
+	switch method {
+	case "bridge.methods":
+		data = methods
+	case "daemon.reload":
+		err = d.reload()
+	case "node.list":
+		data = d.list()
+	case "node.status":
+		data, err = d.status(p.Service)
+	case "node.start":
+		d.mu.Lock()
+		if _, ok := d.configs[p.Service]; !ok {
+			err = d.startLocked(p.Service)
+		}
+		d.mu.Unlock()
+	case "node.stop":
+		d.mu.Lock()
+		err = d.stopLocked(p.Service)
+		d.mu.Unlock()
+	case "node.stats":
+		data = d.stats()
+	case "node.import", "node.remove":
+		return control.Envelope{Code: "unsupported", Message: fmt.Sprintf("%s: nodes are declared in %s", method, d.path)}
+	case "node.logs":
+		return control.Envelope{Code: "unsupported", Message: "node.logs: nodes log to the daemon's output"}
+	default:
+		return control.Envelope{Code: "unknown_method", Message: fmt.Sprintf("unknown method %q", method)}
+	}
+	if err != nil {
+		code := "failed"
+		if errors.Is(err, errNotFound) {
+			code = "not_found"
+		}
+		return control.Envelope{Code: code, Message: err.Error()}
+	}
+	return control.Envelope{OK: true, Code: "ok", Data: data}
+}
+
+func (d *daemon) list() []nodeInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]nodeInfo, 0, len(d.cfg.Nodes))
+	for _, n := range d.cfg.Nodes {
+		list = append(list, nodeInfo{
+			Name:       n.Name,
+			Service:    n.Name,
+			ConfigPath: n.ConfigFile,
+			Status:     d.xray.Status(n.Name).String(),
+		})
+	}
+	return list
+}
+
+func (d *daemon) status(service string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.cfg.node(service); !ok {
+		return "", fmt.Errorf("%s: %w", service, errNotFound)
+	}
+	return d.xray.Status(service).String(), nil
+}
+
+// stats reports the running nodes and the daemon's throughput, which is
+// theirs, since the last call.
+func (d *daemon) stats() map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var running []string
+	for name := range d.configs {
+		running = append(running, name)
+	}
+	sort.Strings(running)
+	stats := map[string]any{"connected": len(running) > 0, "services": running}
+	if len(running) > 0 {
+		stats["service"] = running[0]
+	}
+	if rate, err := d.meter.Sample(os.Getpid()); err == nil {
+		stats["rate"] = rate
+		stats["rateText"] = traffic.Format(rate)
+	}
+	return stats
+}
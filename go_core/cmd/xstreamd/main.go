@@ -0,0 +1,105 @@
+// Command xstreamd runs Xstream nodes without the app, for servers and CI
+// runners: it keeps the nodes of a declarative config running as embedded
+// xray instances, reloads the config on SIGHUP, reports readiness and
+// watchdog pings to systemd and serves the same control API as the app.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/xtls/xray-core/main/distro/all"
+
+	"go_core/internal/control"
+	"go_core/internal/sdnotify"
+	"go_core/internal/settings"
+)
+
+func main() {
+	path := flag.String("c", defaultConfig(), "daemon config")
+	flag.Parse()
+	if err := run(*path); err != nil {
+		fmt.Fprintln(os.Stderr, "xstreamd:", err)
+		os.Exit(1)
+	}
+}
+
+// defaultConfig is /etc/xstream/daemon.json for root and the user's
+// settings directory otherwise.
+func defaultConfig() string {
+	if os.Geteuid() == 0 {
+		return "/etc/xstream/daemon.json"
+	}
+	return settings.Path("daemon.json")
+}
+
+func run(path string) error {
+	d, err := newDaemon(path)
+	if err != nil {
+		return err
+	}
+	defer d.stopAll()
+	if err := d.sync(); err != nil {
+		// Nodes that failed stay stopped; the others serve.
+		fmt.Println("start failed:", err)
+	}
+	server, err := serveControl(d)
+	if err != nil {
+		return err
+	}
+	if server != nil {
+		defer server.Close()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	var watchdog <-chan time.Time
+	if interval := sdnotify.WatchdogInterval(); interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		watchdog = t.C
+	}
+	sdnotify.Notify(sdnotify.Ready, sdnotify.Status(d.summary()))
+	for {
+		select {
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				sdnotify.Notify(sdnotify.Stopping)
+				return nil
+			}
+			sdnotify.Notify(sdnotify.Reloading()...)
+			status := d.summary()
+			if err := d.reload(); err != nil {
+				fmt.Println("reload failed:", err)
+				status += "; reload failed: " + err.Error()
+			} else {
+				status = d.summary()
+			}
+			sdnotify.Notify(sdnotify.Ready, sdnotify.Status(status))
+		case <-watchdog:
+			sdnotify.Notify(sdnotify.Watchdog)
+		}
+	}
+}
+
+// serveControl serves the control API as control.json configures it,
+// the same file the app and xstreamctl read. Unlike the app, the daemon
+// serves it unless it is configured on TCP and disabled.
+func serveControl(d *daemon) (*control.Server, error) {
+	c, err := control.Load()
+	if err != nil {
+		return nil, err
+	}
+	if !c.Enabled && c.TCP() {
+		return nil, nil
+	}
+	s, err := control.Serve(c, control.Handler(d.dispatch))
+	if err != nil {
+		return nil, fmt.Errorf("control API: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"go_core/internal/control"
+	"go_core/internal/host"
+	"go_core/internal/nodelist"
+)
+
+// controlMethods are the methods the control API offers: listing,
+// driving and importing nodes. Settings, the system proxy, the kill
+// switch, resets and anything added later stay with the app, so a
+// script holding the socket or the token can do no more than this.
+var controlMethods = []string{"bridge.methods", "node.import", "node.list", "node.logs", "node.start", "node.stats", "node.status", "node.stop"}
+
+// controlNodeMethods take a service, which must be one of the nodes in
+// vpn_nodes.json: the API drives nodes, not arbitrary units or tasks.
+var controlNodeMethods = []string{"node.logs", "node.start", "node.status", "node.stop"}
+
+var controlServer struct {
+	sync.Mutex
+	server *control.Server
+}
+
+func init() {
+	register("control.get", func(json.RawMessage) (any, error) {
+		c, err := control.Load()
+		if err != nil {
+			return nil, err
+		}
+		return controlStatus(c), nil
+	})
+	register("control.set", func(p json.RawMessage) (any, error) {
+		var c control.Config
+		if err := decode(p, &c); err != nil {
+			return nil, err
+		}
+		if err := c.Validate(); err != nil {
+			return nil, fail(codeInvalidParams, err)
+		}
+		if c.Listen == "" {
+			c.Listen = control.Unix
+		}
+		if c.TCP() && c.Token == "" {
+			c.Token = control.NewToken()
+		}
+		if err := control.Save(c); err != nil {
+			return nil, err
+		}
+		if err := startControl(); err != nil {
+			return nil, err
+		}
+		return controlStatus(c), nil
+	})
+}
+
+// controlStatus is the config with where clients connect.
+func controlStatus(c control.Config) map[string]any {
+	status := map[string]any{"enabled": c.Enabled, "listen": c.Listen}
+	if c.TCP() {
+		status["token"] = c.Token
+		status["url"] = "http://" + c.Listen
+	} else {
+		status["socket"] = control.SocketPath()
+	}
+	return status
+}
+
+// startControl (re)starts the control API as configured. Only the running
+// instance serves it.
+func startControl() error {
+	c, err := control.Load()
+	if err != nil {
+		return err
+	}
+	controlServer.Lock()
+	defer controlServer.Unlock()
+	if controlServer.server != nil {
+		controlServer.server.Close()
+		controlServer.server = nil
+	}
+	if !c.Enabled {
+		return nil
+	}
+	s, err := control.Serve(c, controlHandler())
+	if err != nil {
+		return fmt.Errorf("control API: %w", err)
+	}
+	controlServer.server = s
+	return nil
+}
+
+// controlHandler serves the Call methods in controlMethods.
+func controlHandler() http.Handler {
+	return control.Handler(func(method string, params []byte) envelope {
+		switch {
+		case !slices.Contains(controlMethods, method):
+			return envelope{Code: codeUnknownMethod, Message: fmt.Sprintf("unknown method %q", method)}
+		case method == "bridge.methods":
+			return envelope{OK: true, Code: codeOK, Data: controlMethods}
+		case slices.Contains(controlNodeMethods, method):
+			var args serviceParams
+			// Params that do not decode are left to the method to reject.
+			if json.Unmarshal(params, &args) == nil && !isNode(args.Service) {
+				return envelope{Code: codeNotFound, Message: fmt.Sprintf("no node with service %q", args.Service)}
+			}
+		}
+		return dispatch(method, params)
+	})
+}
+
+// isNode reports whether service belongs to a node in vpn_nodes.json.
+func isNode(service string) bool {
+	nodes, _ := nodelist.Load(host.NodesFile())
+	for _, n := range nodes {
+		if n.ServiceName == service {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestControlHandlerAllowlist(t *testing.T) {
+	h := controlHandler()
+	call := func(method string) (int, envelope) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/call/"+method, strings.NewReader("{}"))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var env envelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+			t.Fatalf("%s: %v: %s", method, err, rec.Body)
+		}
+		return rec.Code, env
+	}
+
+	for _, method := range []string{"sysproxy.set", "killswitch.set", "xray.reset", "events.poll", "control.set"} {
+		if code, env := call(method); code != http.StatusNotFound || env.Code != codeUnknownMethod {
+			t.Errorf("%s: status %d, code %q; want 404 %s", method, code, env.Code, codeUnknownMethod)
+		}
+	}
+
+	// Node methods only reach the nodes of vpn_nodes.json.
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	for _, method := range []string{"node.start", "node.stop", "node.status", "node.logs"} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/call/"+method, strings.NewReader(`{"service": "sshd.service"}`))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var env envelope
+		json.Unmarshal(rec.Body.Bytes(), &env)
+		if rec.Code != http.StatusNotFound || env.Code != codeNotFound {
+			t.Errorf("%s of another service: status %d, code %q; want 404 %s", method, rec.Code, env.Code, codeNotFound)
+		}
+	}
+
+	_, env := call("bridge.methods")
+	var got []string
+	data, _ := json.Marshal(env.Data)
+	json.Unmarshal(data, &got)
+	if !reflect.DeepEqual(got, controlMethods) {
+		t.Errorf("bridge.methods = %q, want %q", got, controlMethods)
+	}
+}
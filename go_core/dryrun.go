@@ -0,0 +1,130 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"go_core/internal/geodata"
+	"go_core/internal/inbound"
+	"go_core/internal/platform"
+	"go_core/internal/settings"
+)
+
+// dryRun holds the plan while dry-run mode is on. Node operations, config
+// writes, core installs, resets and the subsystems' commands then record
+// into it instead of changing the system.
+var dryRun struct {
+	sync.Mutex
+	plan *platform.Plan
+}
+
+type dryRunPlan struct {
+	Enabled bool            `json:"enabled"`
+	Since   string          `json:"since,omitempty"`
+	Steps   []platform.Step `json:"steps"`
+}
+
+func init() {
+	inbound.Sys = system{}
+	geodata.Sys = system{}
+	settings.Sys = system{}
+	register("dryrun.set", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		setDryRun(args.Enabled)
+		return nil, nil
+	})
+	register("dryrun.plan", func(json.RawMessage) (any, error) {
+		return currentPlan(), nil
+	})
+}
+
+// SetDryRun turns dry-run mode on or off. Turning it on starts an empty
+// plan; turning it off discards the plan.
+//
+//export SetDryRun
+func SetDryRun(enabled C.int) *C.char {
+	setDryRun(enabled != 0)
+	return legacy(nil, nil)
+}
+
+func setDryRun(on bool) {
+	dryRun.Lock()
+	defer dryRun.Unlock()
+	dryRun.plan = nil
+	if on {
+		dryRun.plan = platform.NewPlan()
+	}
+}
+
+// GetDryRunPlan returns the steps recorded since dry-run mode was turned
+// on, as JSON: commands, file paths with diffs and service operations.
+//
+//export GetDryRunPlan
+func GetDryRunPlan() *C.char {
+	return legacy(currentPlan(), nil)
+}
+
+func currentPlan() dryRunPlan {
+	plan := activePlan()
+	if plan == nil {
+		return dryRunPlan{Steps: []platform.Step{}}
+	}
+	return dryRunPlan{Enabled: true, Since: plan.Started().Format(time.RFC3339), Steps: plan.Steps()}
+}
+
+func activePlan() *platform.Plan {
+	dryRun.Lock()
+	defer dryRun.Unlock()
+	return dryRun.plan
+}
+
+// services, writer and installer return the backends to use, wrapped by
+// the plan in dry-run mode.
+func services() platform.ServiceManager {
+	if plan := activePlan(); plan != nil {
+		return plan.Services(serviceManager)
+	}
+	return serviceManager
+}
+
+func writer(w platform.FileWriter) platform.FileWriter {
+	if plan := activePlan(); plan != nil {
+		return plan.Writer()
+	}
+	return w
+}
+
+func installer() platform.Installer {
+	if plan := activePlan(); plan != nil {
+		return plan.Installer(coreInstaller)
+	}
+	return coreInstaller
+}
+
+// system is the platform.System the subsystem packages use: the plan's
+// while dry-run mode is on, so their commands and file changes are
+// recorded, and the live one otherwise.
+type system struct{}
+
+func (system) current() platform.System {
+	if plan := activePlan(); plan != nil {
+		return plan.System()
+	}
+	return platform.Live{}
+}
+
+func (s system) Run(c platform.Cmd) (string, error) { return s.current().Run(c) }
+func (s system) Start(c platform.Cmd) (int, error)  { return s.current().Start(c) }
+func (s system) Remove(path string) error           { return s.current().Remove(path) }
+
+func (s system) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return s.current().WriteFile(path, data, perm)
+}
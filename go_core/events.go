@@ -0,0 +1,96 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// maxEvents bounds the queue when nobody polls; the oldest events are
+// dropped first.
+const maxEvents = 100
+
+// event is something the Go side tells the Flutter app about, e.g. a node
+// started from the tray. The app polls for them.
+type event struct {
+	Type string `json:"type"`
+	Time string `json:"time"`
+	Data any    `json:"data,omitempty"`
+}
+
+var events struct {
+	sync.Mutex
+	queue []event
+	// polled is closed and replaced on every poll, so emitters can wait
+	// for the app to pick an event up.
+	polled chan struct{}
+	// listeners see events as they are emitted, for in-process
+	// followers such as the tray.
+	listeners []func(typ string)
+}
+
+func init() {
+	register("events.poll", func(json.RawMessage) (any, error) {
+		return pollEvents(), nil
+	})
+}
+
+// PollEvents returns and clears the queued events as a JSON list.
+//
+//export PollEvents
+func PollEvents() *C.char {
+	return legacy(pollEvents(), nil)
+}
+
+func pollEvents() []event {
+	events.Lock()
+	defer events.Unlock()
+	out := events.queue
+	if out == nil {
+		out = []event{}
+	}
+	events.queue = nil
+	if events.polled != nil {
+		close(events.polled)
+		events.polled = nil
+	}
+	return out
+}
+
+func emit(typ string, data any) {
+	events.Lock()
+	events.queue = append(events.queue, event{Type: typ, Time: time.Now().Format(time.RFC3339), Data: data})
+	if n := len(events.queue); n > maxEvents {
+		events.queue = events.queue[n-maxEvents:]
+	}
+	listeners := events.listeners
+	events.Unlock()
+	for _, fn := range listeners {
+		fn(typ)
+	}
+}
+
+// listen calls fn with the type of every event emitted from now on, in
+// the emitting goroutine, so fn must not block.
+func listen(fn func(typ string)) {
+	events.Lock()
+	defer events.Unlock()
+	events.listeners = append(events.listeners, fn)
+}
+
+// waitPolled waits up to d for the app to poll, and reports whether it did.
+func waitPolled(d time.Duration) bool {
+	events.Lock()
+	if events.polled == nil {
+		events.polled = make(chan struct{})
+	}
+	ch := events.polled
+	events.Unlock()
+	select {
+	case <-ch:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
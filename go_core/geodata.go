@@ -0,0 +1,109 @@
+package main
+
+import "C"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go_core/internal/geodata"
+	"go_core/internal/host"
+	"go_core/internal/routing"
+)
+
+var geoOnce sync.Once
+
+// startGeoDataUpdates begins the periodic dataset refresh. Running nodes are
+// restarted after a change so xray picks up the new files.
+func startGeoDataUpdates() {
+	geodata.StartScheduler(host.CoreDir(), func(changed []string) {
+		fmt.Println("Geo data updated:", strings.Join(changed, ", "))
+		reloadXrayInstances()
+	}, func(err error) {
+		fmt.Println("Geo data update failed:", err)
+	})
+}
+
+func init() {
+	routing.Geo = &geodata.Lookup{Dir: host.CoreDir}
+	register("geodata.setSources", func(p json.RawMessage) (any, error) {
+		var c geodata.Config
+		if err := decode(p, &c); err != nil {
+			return nil, err
+		}
+		return nil, setGeoDataSources(c)
+	})
+	register("geodata.update", func(json.RawMessage) (any, error) {
+		return updateGeoData()
+	})
+	register("geodata.codes", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Kind string `json:"kind"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return geoDataCodes(args.Kind)
+	})
+}
+
+//export SetGeoDataSources
+func SetGeoDataSources(configC *C.char) *C.char {
+	var c geodata.Config
+	if err := json.Unmarshal([]byte(C.GoString(configC)), &c); err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(nil, setGeoDataSources(c))
+}
+
+func setGeoDataSources(c geodata.Config) error {
+	if err := geodata.SaveConfig(c); err != nil {
+		return err
+	}
+	startGeoDataUpdates()
+	return nil
+}
+
+//export UpdateGeoData
+func UpdateGeoData() *C.char {
+	return legacy(updateGeoData())
+}
+
+func updateGeoData() (any, error) {
+	c, err := geodata.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		changed, err := geodata.Update(context.Background(), host.CoreDir(), c)
+		if err != nil {
+			fmt.Println("Geo data update failed:", err)
+		}
+		if len(changed) > 0 {
+			reloadXrayInstances()
+		}
+	}()
+	return notice("download started"), nil
+}
+
+// GetGeoDataCodes lists the categories in geosite.dat or the country codes
+// in geoip.dat, depending on kind.
+//
+//export GetGeoDataCodes
+func GetGeoDataCodes(kindC *C.char) *C.char {
+	return legacy(geoDataCodes(C.GoString(kindC)))
+}
+
+func geoDataCodes(kind string) (any, error) {
+	if kind != "geoip" && kind != "geosite" {
+		return nil, fail(codeInvalidParams, fmt.Errorf("unknown dataset %s", kind))
+	}
+	codes, err := geodata.Codes(filepath.Join(host.CoreDir(), kind+".dat"))
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+
+	"go_core/internal/inbound"
+	"go_core/internal/xrayconf"
+)
+
+func init() {
+	register("inbound.set", func(p json.RawMessage) (any, error) {
+		s := inbound.DefaultSettings()
+		if err := decode(p, &s); err != nil {
+			return nil, err
+		}
+		return nil, setInboundSettings(s)
+	})
+	register("inbound.get", func(json.RawMessage) (any, error) {
+		return getInboundSettings()
+	})
+}
+
+// SetInboundSettings saves the inbound model and opens or closes the
+// firewall to match the LAN sharing toggle. It takes effect for node
+// configs generated afterwards.
+//
+//export SetInboundSettings
+func SetInboundSettings(settingsC *C.char) *C.char {
+	s := inbound.DefaultSettings()
+	if err := json.Unmarshal([]byte(C.GoString(settingsC)), &s); err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(nil, setInboundSettings(s))
+}
+
+func setInboundSettings(s inbound.Settings) error {
+	if err := s.Validate(); err != nil {
+		return fail(codeInvalidParams, err)
+	}
+	if err := inbound.Save(s); err != nil {
+		return err
+	}
+	if err := inbound.OpenFirewall(s, extraListenAddrs()); err != nil {
+		return fmt.Errorf("firewall: %w", err)
+	}
+	return nil
+}
+
+// GetInboundSettings returns the inbound model with the effective listen
+// address and the firewall backend in use.
+//
+//export GetInboundSettings
+func GetInboundSettings() *C.char {
+	return legacy(getInboundSettings())
+}
+
+func getInboundSettings() (any, error) {
+	s, err := inbound.Load()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		inbound.Settings
+		Listen   string `json:"listen"`
+		Firewall string `json:"firewall"`
+	}{s, s.ListenAddress(), inbound.Backend()}, nil
+}
+
+// applyInbounds replaces the socks/http inbounds of a generated xray config
+// with those of the saved model.
+func applyInbounds(content string) (string, error) {
+	s, err := inbound.Load()
+	if err != nil {
+		return "", err
+	}
+	cfg, err := xrayconf.Parse([]byte(content))
+	if err != nil {
+		return "", err
+	}
+	if err := inbound.Apply(cfg, s, extraListenAddrs()...); err != nil {
+		return "", err
+	}
+	out, err := cfg.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// openInboundFirewall re-applies the firewall rules when a node starts;
+// runtime rules do not survive a reboot or a firewalld reload. A failure
+// fails the start rather than leave the shared ports unrestricted.
+func openInboundFirewall() error {
+	s, err := inbound.Load()
+	if err != nil {
+		return err
+	}
+	if err := inbound.OpenFirewall(s, extraListenAddrs()); err != nil {
+		return fmt.Errorf("inbound firewall: %w", err)
+	}
+	return nil
+}
+
+func closeInboundFirewall() {
+	if err := inbound.CloseFirewall(); err != nil {
+		fmt.Println("Close inbound firewall failed:", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"go_core/internal/host"
+)
+
+// bridgeABI is bumped whenever an export changes signature or semantics in
+// a way the Dart side must know about. Additions do not bump it; they show
+// up in the method list and capabilities instead.
+//
+//	1: individual exports only
+//	2: Call entrypoint, GetBridgeInfo
+const bridgeABI = 2
+
+// Capabilities advertised by GetBridgeInfo. The Dart side hides features
+// whose capability is missing.
+const (
+	capServiceSystemd   = "service.systemd"
+	capServiceSchtasks  = "service.schtasks"
+	capServiceProcess   = "service.process"
+	capCoreDownload     = "core.download"
+	capRouting          = "routing"
+	capGeoData          = "geodata"
+	capPac              = "pac"
+	capInbound          = "inbound"
+	capPortCheck        = "ports"
+	capSystemProxy      = "sysproxy"
+	capKillSwitch       = "killswitch"
+	capAppSplitTunnel   = "apps"
+	capTray             = "tray"
+	capFirewallLANShare = "inbound.firewall"
+	capDryRun           = "dryrun"
+)
+
+// commonCapabilities are provided by the cross-platform files of every
+// desktop build. The platform files add theirs in platformCapabilities.
+var commonCapabilities = []string{
+	capCoreDownload, capRouting, capGeoData, capPac, capInbound, capPortCheck, capFirewallLANShare, capTray, capDryRun,
+}
+
+type xrayCoreInfo struct {
+	Version  string `json:"version,omitempty"`
+	Embedded bool   `json:"embedded"`
+	Path     string `json:"path,omitempty"`
+	// Assets is where the geo data lives; units pass it to xray.
+	Assets string `json:"assets,omitempty"`
+}
+
+type bridgeInfo struct {
+	ABI          int          `json:"abi"`
+	GoVersion    string       `json:"goVersion"`
+	Commit       string       `json:"commit"`
+	Modified     bool         `json:"modified,omitempty"`
+	BuildTime    string       `json:"buildTime,omitempty"`
+	Platform     string       `json:"platform"`
+	Arch         string       `json:"arch"`
+	XrayCore     xrayCoreInfo `json:"xrayCore"`
+	Capabilities []string     `json:"capabilities"`
+	Methods      []string     `json:"methods"`
+}
+
+func init() {
+	register("bridge.info", func(json.RawMessage) (any, error) {
+		return getBridgeInfo(), nil
+	})
+}
+
+// GetBridgeInfo describes this library: ABI version, toolchain, build
+// commit, platform, the xray core in use and the supported capabilities.
+//
+//export GetBridgeInfo
+func GetBridgeInfo() *C.char {
+	return legacy(getBridgeInfo(), nil)
+}
+
+func getBridgeInfo() bridgeInfo {
+	info := bridgeInfo{
+		ABI:          bridgeABI,
+		GoVersion:    runtime.Version(),
+		Commit:       "unknown",
+		Platform:     runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		XrayCore:     installedXray(),
+		Capabilities: append(append([]string(nil), commonCapabilities...), platformCapabilities()...),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.BuildTime = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	names, _ := methods["bridge.methods"](nil)
+	info.Methods, _ = names.([]string)
+	return info
+}
+
+// installedXray reports the xray binary the desktop builds run as a
+// separate process, or where it will be installed. Its version is read
+// from "xray version".
+func installedXray() xrayCoreInfo {
+	core := host.ResolveCore()
+	x := xrayCoreInfo{Path: core.Binary, Assets: core.Assets}
+	out, err := exec.Command(x.Path, "version").Output()
+	if err != nil {
+		return x
+	}
+	// "Xray 25.3.6 (Xray, Penetrates Everything.) ..."
+	if f := strings.Fields(string(out)); len(f) > 1 {
+		x.Version = f[1]
+	}
+	return x
+}
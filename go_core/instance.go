@@ -0,0 +1,82 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go_core/internal/instance"
+	"go_core/internal/platform"
+)
+
+var singleInstance struct {
+	sync.Mutex
+	server *instance.Server
+}
+
+func init() {
+	register("instance.acquire", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Args []string `json:"args"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return map[string]bool{"primary": acquireInstance(args.Args)}, nil
+	})
+}
+
+// AcquireInstance makes this process the running instance, or hands args
+// (a JSON list) to the instance already running. It returns 1 when this
+// process should go on and 0 when it should exit.
+//
+//export AcquireInstance
+func AcquireInstance(args *C.char) C.int {
+	var list []string
+	if err := json.Unmarshal([]byte(C.GoString(args)), &list); err != nil {
+		fmt.Println("Parse instance args failed:", err)
+	}
+	if acquireInstance(list) {
+		return 1
+	}
+	return 0
+}
+
+// acquireInstance reports whether this process is the instance, and
+// starts the network rules and the control API if so. When the lock
+// cannot be taken for another reason, the process goes on rather than
+// refusing to start.
+func acquireInstance(args []string) bool {
+	singleInstance.Lock()
+	defer singleInstance.Unlock()
+	if singleInstance.server != nil {
+		return true
+	}
+	server, err := instance.Acquire("xstream", args, onHandoff)
+	if errors.Is(err, instance.ErrRunning) {
+		return false
+	}
+	if err != nil {
+		fmt.Println("Acquire instance lock failed:", err)
+	}
+	singleInstance.server = server
+	// Nodes the supervisor ran in an earlier session are restarted again
+	// when they exit.
+	if p, ok := serviceManager.(platform.Process); ok {
+		p.Adopt()
+	}
+	startNetRules()
+	if err := startControl(); err != nil {
+		fmt.Println("Start control API failed:", err)
+	}
+	return true
+}
+
+// onHandoff raises the window for a later launch and passes its arguments,
+// e.g. an xstream:// link, on to the app.
+func onHandoff(args []string) {
+	showMainWindow()
+	emit("instance.args", map[string][]string{"args": args})
+}
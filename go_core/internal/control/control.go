@@ -0,0 +1,245 @@
+// Package control serves the local control API: HTTP with JSON bodies on a
+// Unix socket only the user can open, or on a loopback port with a bearer
+// token, so scripts and widgets can drive the same core as the app.
+package control
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_core/internal/settings"
+)
+
+// Unix is the Listen value for the default socket.
+const Unix = "unix"
+
+// Config selects where the API listens. Listen is Unix or a loopback
+// "host:port"; Token is required on TCP and generated when missing.
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+	Token   string `json:"token,omitempty"`
+}
+
+// Validate rejects addresses reachable from other machines.
+func (c Config) Validate() error {
+	if c.Listen == "" || c.Listen == Unix {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("listen: %s is not a loopback address", host)
+	}
+	return nil
+}
+
+// TCP reports whether c listens on a port rather than the socket.
+func (c Config) TCP() bool {
+	return c.Listen != "" && c.Listen != Unix
+}
+
+// NewToken returns a random bearer token.
+func NewToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SocketPath is the default socket: under XDG_RUNTIME_DIR when set, which
+// is private to the user, else next to the settings.
+func SocketPath() string {
+	if rt := os.Getenv("XDG_RUNTIME_DIR"); rt != "" {
+		return filepath.Join(rt, "xstream", "control.sock")
+	}
+	return settings.Path("control.sock")
+}
+
+const file = "control.json"
+
+// Load returns the saved config; without one the API is off.
+func Load() (Config, error) {
+	var c Config
+	err := settings.Load(file, &c)
+	if errors.Is(err, os.ErrNotExist) {
+		return Config{Listen: Unix}, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	return c, c.Validate()
+}
+
+// Save persists c readable by the user only, since it holds the token.
+func Save(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return settings.Save(file, c, 0600)
+}
+
+// Envelope is the response of every method, as the bridge's Call returns
+// it.
+type Envelope struct {
+	OK      bool   `json:"ok"`
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Dispatcher runs a method with its JSON params.
+type Dispatcher func(method string, params []byte) Envelope
+
+// Handler serves the API on d: /v1/call/{method} takes any method with the
+// JSON body as params, the other routes are shorthands for the common
+// ones. The app and the daemon serve the same routes.
+func Handler(d Dispatcher) http.Handler {
+	mux := http.NewServeMux()
+	write := func(w http.ResponseWriter, method string, params []byte) {
+		env := d(method, params)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(httpStatus(env.Code))
+		json.NewEncoder(w).Encode(env)
+	}
+	body := func(method func(r *http.Request) string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			params, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			write(w, method(r), params)
+		}
+	}
+	route := func(pattern, method string, params func(r *http.Request) any) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			var data []byte
+			if params != nil {
+				data, _ = json.Marshal(params(r))
+			}
+			write(w, method, data)
+		})
+	}
+	service := func(r *http.Request) any { return map[string]string{"service": r.PathValue("service")} }
+	mux.HandleFunc("POST /v1/call/{method}", body(func(r *http.Request) string { return r.PathValue("method") }))
+	route("GET /v1/nodes", "node.list", nil)
+	route("GET /v1/nodes/{service}", "node.status", service)
+	route("POST /v1/nodes/{service}/start", "node.start", service)
+	route("POST /v1/nodes/{service}/stop", "node.stop", service)
+	route("GET /v1/nodes/{service}/logs", "node.logs", func(r *http.Request) any {
+		lines, _ := strconv.Atoi(r.URL.Query().Get("lines"))
+		return map[string]any{"service": r.PathValue("service"), "lines": lines, "cursor": r.URL.Query().Get("cursor")}
+	})
+	route("GET /v1/stats", "node.stats", nil)
+	mux.HandleFunc("POST /v1/import", body(func(*http.Request) string { return "node.import" }))
+	return mux
+}
+
+// httpStatus maps the envelope's error codes.
+func httpStatus(code string) int {
+	switch code {
+	case "ok":
+		return http.StatusOK
+	case "invalid_params":
+		return http.StatusBadRequest
+	case "unknown_method", "not_found":
+		return http.StatusNotFound
+	case "permission_denied":
+		return http.StatusForbidden
+	case "port_conflict":
+		return http.StatusConflict
+	case "unsupported":
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+// Server is a running control API.
+type Server struct {
+	http   *http.Server
+	socket string
+}
+
+// Serve starts serving h as c describes. On the socket, access is limited
+// by the file mode; on TCP every request needs the token.
+func Serve(c Config, h http.Handler) (*Server, error) {
+	s := &Server{}
+	var ln net.Listener
+	var err error
+	if c.TCP() {
+		if c.Token == "" {
+			return nil, fmt.Errorf("listen %s: a token is required", c.Listen)
+		}
+		ln, err = net.Listen("tcp", c.Listen)
+		h = requireToken(c.Token, h)
+	} else {
+		s.socket = SocketPath()
+		ln, err = listenSocket(s.socket)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.http = &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go s.http.Serve(ln)
+	return s, nil
+}
+
+// listenSocket binds path in a directory only the user can enter. A socket
+// left by a crashed process is replaced; one that answers is not.
+func listenSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func requireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Close stops the server and removes its socket.
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := s.http.Shutdown(ctx)
+	if s.socket != "" {
+		os.Remove(s.socket)
+	}
+	return err
+}
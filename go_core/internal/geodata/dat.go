@@ -0,0 +1,239 @@
+package geodata
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Code is one category in geosite.dat or one country code in geoip.dat.
+type Code struct {
+	Code  string `json:"code"`
+	Count int    `json:"count"`
+}
+
+// Domain types as defined in xray's router.proto.
+const (
+	domainPlain  = 0
+	domainRegex  = 1
+	domainSuffix = 2
+	domainFull   = 3
+)
+
+type siteDomain struct {
+	typ   uint64
+	value string
+}
+
+type ipNet struct {
+	ip     []byte
+	prefix uint64
+}
+
+// forEachEntry walks the repeated field 1 of a GeoSiteList or GeoIPList and
+// hands each entry's country_code and raw body to fn.
+func forEachEntry(data []byte, fn func(code string, body []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num != 1 || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		body, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		code, err := entryCode(body)
+		if err != nil {
+			return err
+		}
+		if err := fn(code, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func entryCode(body []byte) (string, error) {
+	var code string
+	err := forEachField(body, func(num protowire.Number, v []byte, _ uint64) {
+		if num == 1 {
+			code = string(v)
+		}
+	})
+	return strings.ToLower(code), err
+}
+
+// forEachField calls fn for every bytes or varint field of a message.
+func forEachField(msg []byte, fn func(num protowire.Number, b []byte, v uint64)) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		switch typ {
+		case protowire.BytesType:
+			b, n := protowire.ConsumeBytes(msg)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			fn(num, b, 0)
+			msg = msg[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(msg)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			fn(num, nil, v)
+			msg = msg[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, msg)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			msg = msg[n:]
+		}
+	}
+	return nil
+}
+
+// countRepeated counts occurrences of field 2 (domain or cidr) in an entry.
+func countRepeated(body []byte) int {
+	count := 0
+	forEachField(body, func(num protowire.Number, b []byte, _ uint64) {
+		if num == 2 && b != nil {
+			count++
+		}
+	})
+	return count
+}
+
+// Codes lists the categories or country codes in a dataset file, sorted.
+func Codes(path string) ([]Code, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var codes []Code
+	err = forEachEntry(data, func(code string, body []byte) error {
+		codes = append(codes, Code{Code: code, Count: countRepeated(body)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes, nil
+}
+
+// validate checks that data parses as a dataset with at least one entry.
+func validate(data []byte) error {
+	entries := 0
+	if err := forEachEntry(data, func(string, []byte) error { entries++; return nil }); err != nil {
+		return err
+	}
+	if entries == 0 {
+		return fmt.Errorf("dataset has no entries")
+	}
+	return nil
+}
+
+func loadSite(path, code string) ([]siteDomain, error) {
+	var out []siteDomain
+	err := loadEntry(path, code, func(b []byte) {
+		var d siteDomain
+		forEachField(b, func(num protowire.Number, v []byte, n uint64) {
+			switch num {
+			case 1:
+				d.typ = n
+			case 2:
+				d.value = strings.ToLower(string(v))
+			}
+		})
+		out = append(out, d)
+	})
+	return out, err
+}
+
+func loadIP(path, code string) ([]ipNet, error) {
+	var out []ipNet
+	err := loadEntry(path, code, func(b []byte) {
+		var c ipNet
+		forEachField(b, func(num protowire.Number, v []byte, n uint64) {
+			switch num {
+			case 1:
+				c.ip = append([]byte(nil), v...)
+			case 2:
+				c.prefix = n
+			}
+		})
+		out = append(out, c)
+	})
+	return out, err
+}
+
+// loadEntry calls fn with each field-2 item of the entry named code.
+func loadEntry(path, code string, fn func([]byte)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	code = strings.ToLower(code)
+	found := false
+	err = forEachEntry(data, func(c string, body []byte) error {
+		if c != code {
+			return nil
+		}
+		found = true
+		return forEachField(body, func(num protowire.Number, b []byte, _ uint64) {
+			if num == 2 && b != nil {
+				fn(b)
+			}
+		})
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("%s: no entry %q", path, code)
+	}
+	return err
+}
+
+func (d siteDomain) matches(domain string) bool {
+	switch d.typ {
+	case domainPlain:
+		return strings.Contains(domain, d.value)
+	case domainRegex:
+		re, err := regexp.Compile(d.value)
+		return err == nil && re.MatchString(domain)
+	case domainSuffix:
+		return domain == d.value || strings.HasSuffix(domain, "."+d.value)
+	case domainFull:
+		return domain == d.value
+	}
+	return false
+}
+
+func (c ipNet) contains(ip net.IP) bool {
+	bits := len(c.ip) * 8
+	if v4 := ip.To4(); v4 != nil && len(c.ip) == net.IPv4len {
+		ip = v4
+	} else if len(c.ip) != net.IPv6len || ip.To4() != nil {
+		return false
+	}
+	n := net.IPNet{IP: c.ip, Mask: net.CIDRMask(int(c.prefix), bits)}
+	return n.Contains(ip)
+}
@@ -0,0 +1,381 @@
+// Package geodata keeps geoip.dat and geosite.dat next to the xray core up
+// to date and answers questions about their contents.
+package geodata
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go_core/internal/platform"
+	"go_core/internal/settings"
+)
+
+// Sys writes the downloaded datasets. The bridge swaps it for a dry-run
+// plan's System, which records the writes.
+var Sys platform.System = platform.Live{}
+
+// Source is where one dataset file is fetched from.
+type Source struct {
+	// File is the name xray looks for, geoip.dat or geosite.dat.
+	File string `json:"file"`
+	URL  string `json:"url"`
+	// ChecksumURL points at a sha256sum-style file. Without it the download
+	// is only checked for being a parseable dataset.
+	ChecksumURL string `json:"checksumUrl,omitempty"`
+}
+
+// Config is the persisted update configuration.
+type Config struct {
+	Sources       []Source `json:"sources"`
+	IntervalHours int      `json:"intervalHours"`
+	LastUpdated   string   `json:"lastUpdated,omitempty"`
+}
+
+const releaseBase = "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/"
+
+// DefaultConfig refreshes both files daily from v2ray-rules-dat, which
+// carries the categories the routing presets refer to.
+func DefaultConfig() Config {
+	return Config{
+		Sources: []Source{
+			{File: "geoip.dat", URL: releaseBase + "geoip.dat", ChecksumURL: releaseBase + "geoip.dat.sha256sum"},
+			{File: "geosite.dat", URL: releaseBase + "geosite.dat", ChecksumURL: releaseBase + "geosite.dat.sha256sum"},
+		},
+		IntervalHours: 24,
+	}
+}
+
+const configFile = "geodata.json"
+
+// LoadConfig returns the saved config or DefaultConfig.
+func LoadConfig() (Config, error) {
+	c := DefaultConfig()
+	err := settings.Load(configFile, &c)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	return c, err
+}
+
+// SaveConfig persists c.
+func SaveConfig(c Config) error {
+	for _, s := range c.Sources {
+		if s.File != "geoip.dat" && s.File != "geosite.dat" {
+			return fmt.Errorf("unknown dataset %q", s.File)
+		}
+		if s.URL == "" {
+			return fmt.Errorf("%s: empty url", s.File)
+		}
+	}
+	return settings.Save(configFile, c, 0644)
+}
+
+var updateMu sync.Mutex
+
+// client bounds each download, so a stalled server cannot hold updateMu
+// indefinitely.
+var client = &http.Client{Timeout: 5 * time.Minute}
+
+// Update downloads every source and replaces the file in dir through Sys.
+// Downloads are verified in the temporary directory first, so xray never
+// sees a partial dataset and a dry run leaves dir alone. It returns the
+// names of the files that changed.
+func Update(ctx context.Context, dir string, c Config) ([]string, error) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	var changed []string
+	var errs []error
+	for _, s := range c.Sources {
+		ok, err := fetch(ctx, dir, s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.File, err))
+			continue
+		}
+		if ok {
+			changed = append(changed, s.File)
+		}
+	}
+	if len(errs) == 0 {
+		// A dry run records the timestamp like the files it replaced.
+		c.LastUpdated = time.Now().UTC().Format(time.RFC3339)
+		if err := SaveConfig(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+func fetch(ctx context.Context, dir string, s Source) (bool, error) {
+	var want string
+	if s.ChecksumURL != "" {
+		sum, err := fetchChecksum(ctx, s.ChecksumURL)
+		if err != nil {
+			return false, err
+		}
+		want = sum
+	}
+
+	resp, err := get(ctx, s.URL)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GET %s: %s", s.URL, resp.Status)
+	}
+	tmp, err := os.CreateTemp("", "xstream-"+s.File+"-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if want != "" && !strings.EqualFold(got, want) {
+		return false, fmt.Errorf("checksum mismatch: got %s, want %s", got, want)
+	}
+
+	dest := filepath.Join(dir, s.File)
+	if cur, err := fileSHA256(dest); err == nil && cur == got {
+		return false, nil
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	if err := validate(data); err != nil {
+		return false, err
+	}
+	return true, Sys.WriteFile(dest, data, 0644)
+}
+
+func fetchChecksum(ctx context.Context, url string) (string, error) {
+	resp, err := get(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	sc := bufio.NewScanner(io.LimitReader(resp.Body, 4096))
+	if sc.Scan() {
+		if f := strings.Fields(sc.Text()); len(f) > 0 && len(f[0]) == sha256.Size*2 {
+			return f[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum in %s", url)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var (
+	schedMu   sync.Mutex
+	schedStop context.CancelFunc
+)
+
+// retryMin and retryMax bound the wait after a failed update, which doubles
+// from retryMin on each further failure. The regular interval is used
+// when it is shorter.
+const (
+	retryMin = 5 * time.Minute
+	retryMax = 2 * time.Hour
+)
+
+// StartScheduler runs Update every IntervalHours, starting with an
+// immediate check when the data is older than that. A failed update is
+// retried sooner. onChange is called after any file was replaced. Calling
+// it again restarts the schedule.
+func StartScheduler(dir string, onChange func(changed []string), onError func(error)) {
+	StopScheduler()
+	schedMu.Lock()
+	defer schedMu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	schedStop = cancel
+	go func() {
+		retry := retryMin
+		for {
+			c, err := LoadConfig()
+			if err != nil {
+				onError(err)
+			}
+			interval := time.Duration(c.IntervalHours) * time.Hour
+			if interval <= 0 {
+				interval = 24 * time.Hour
+			}
+			wait := interval
+			if last, err := time.Parse(time.RFC3339, c.LastUpdated); err != nil || time.Since(last) >= interval {
+				changed, err := Update(ctx, dir, c)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					onError(err)
+					wait = min(retry, interval)
+					retry = min(retry*2, retryMax)
+				} else {
+					retry = retryMin
+				}
+				if len(changed) > 0 {
+					onChange(changed)
+				}
+			} else {
+				wait = interval - time.Since(last)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+}
+
+// StopScheduler stops the loop started by StartScheduler.
+func StopScheduler() {
+	schedMu.Lock()
+	defer schedMu.Unlock()
+	if schedStop != nil {
+		schedStop()
+		schedStop = nil
+	}
+}
+
+// Lookup implements routing.GeoLookup over the files in the directory
+// Dir returns, which is asked on every lookup since the core may move.
+// Parsed entries are cached until the file changes.
+type Lookup struct {
+	Dir func() string
+
+	mu    sync.Mutex
+	sites map[string]cached[[]siteDomain]
+	ips   map[string]cached[[]ipNet]
+}
+
+type cached[T any] struct {
+	mod  time.Time
+	data T
+}
+
+// SiteContains reports whether domain is in geosite category code.
+func (l *Lookup) SiteContains(code, domain string) (bool, error) {
+	path := filepath.Join(l.Dir(), "geosite.dat")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sites == nil {
+		l.sites = map[string]cached[[]siteDomain]{}
+	}
+	entries, err := getCached(l.sites, path, code, loadSite)
+	if err != nil {
+		return false, err
+	}
+	domain = strings.ToLower(domain)
+	for _, d := range entries {
+		if d.matches(domain) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IPContains reports whether ip is in geoip code.
+func (l *Lookup) IPContains(code string, ip net.IP) (bool, error) {
+	path := filepath.Join(l.Dir(), "geoip.dat")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ips == nil {
+		l.ips = map[string]cached[[]ipNet]{}
+	}
+	entries, err := getCached(l.ips, path, code, loadIP)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range entries {
+		if n.contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func getCached[T any](m map[string]cached[T], path, code string, load func(string, string) (T, error)) (T, error) {
+	var zero T
+	st, err := os.Stat(path)
+	if err != nil {
+		return zero, err
+	}
+	if c, ok := m[code]; ok && c.mod.Equal(st.ModTime()) {
+		return c.data, nil
+	}
+	data, err := load(path, code)
+	if err != nil {
+		return zero, err
+	}
+	m[code] = cached[T]{mod: st.ModTime(), data: data}
+	return data, nil
+}
+
+// SiteDomains expands a geosite category into plain domain lists, for
+// consumers such as PAC files that cannot read the dataset themselves.
+// Keyword and regex entries are returned in other.
+func (l *Lookup) SiteDomains(code string) (suffix, full, other []string, err error) {
+	path := filepath.Join(l.Dir(), "geosite.dat")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sites == nil {
+		l.sites = map[string]cached[[]siteDomain]{}
+	}
+	entries, err := getCached(l.sites, path, code, loadSite)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, d := range entries {
+		switch d.typ {
+		case domainSuffix:
+			suffix = append(suffix, d.value)
+		case domainFull:
+			full = append(full, d.value)
+		default:
+			other = append(other, d.value)
+		}
+	}
+	return suffix, full, other, nil
+}
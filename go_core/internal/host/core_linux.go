@@ -0,0 +1,103 @@
+package host
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// systemDir is the system-wide install location, used when running as
+// root.
+const systemDir = "/opt/bin"
+
+// userDir is the per-user install location, under XDG_DATA_HOME.
+func userDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "xstream", "bin")
+}
+
+// installDir is where a new core goes: installing never needs sudo.
+func installDir() string {
+	if os.Geteuid() == 0 {
+		return systemDir
+	}
+	return userDir()
+}
+
+// CoreBinaries are the locations checked for an installed core, in order:
+// the two install locations, then where earlier versions and manual
+// installs put xray. PATH is searched after them.
+func CoreBinaries() []string {
+	home, _ := os.UserHomeDir()
+	return []string{
+		filepath.Join(userDir(), "xray"),
+		filepath.Join(systemDir, "xray"),
+		filepath.Join(home, ".local", "bin", "xray"),
+		"/usr/local/bin/xray",
+	}
+}
+
+// ResolveCore finds the installed core, or picks where to install one.
+func ResolveCore() Core {
+	for _, path := range CoreBinaries() {
+		if executable(path) {
+			return foundCore(path)
+		}
+	}
+	if path, err := exec.LookPath("xray"); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			return foundCore(abs)
+		}
+	}
+	dir := installDir()
+	return Core{Binary: filepath.Join(dir, "xray"), Assets: dir, System: dir == systemDir}
+}
+
+func foundCore(path string) Core {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Dir(path)
+	c := Core{Binary: path, Assets: dir, Found: true, System: home == "" || !strings.HasPrefix(path, home+"/")}
+	if !Writable(dir) {
+		c.Assets = installDir()
+	}
+	return c
+}
+
+func executable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && unix.Access(path, unix.X_OK) == nil
+}
+
+// armVersion reads the ARM architecture version from /proc/cpuinfo.
+// 64-bit CPUs report 8 and run the v7 builds in 32-bit userlands.
+func armVersion() int {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return 7
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) != "CPU architecture" {
+			continue
+		}
+		// "7", or "AArch64" on some 64-bit kernels.
+		if v, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return v
+		}
+		return 8
+	}
+	return 7
+}
+
+// Writable reports whether the user can create files in dir.
+func Writable(dir string) bool {
+	return unix.Access(dir, unix.W_OK) == nil
+}
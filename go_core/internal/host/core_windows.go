@@ -0,0 +1,18 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// armVersion is 7: Windows on 32-bit ARM is ARMv7.
+func armVersion() int { return 7 }
+
+// ResolveCore is xray.exe in the install directory.
+func ResolveCore() Core {
+	dir := filepath.Join(os.Getenv("ProgramFiles"), "Xstream")
+	c := Core{Binary: filepath.Join(dir, "xray.exe"), Assets: dir, System: true}
+	_, err := os.Stat(c.Binary)
+	c.Found = err == nil
+	return c
+}
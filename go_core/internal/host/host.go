@@ -0,0 +1,92 @@
+// Package host holds what the library and xstreamctl must agree on about
+// this machine: where the node list and the xray core live, how node
+// services are named and run, and where imported nodes are written.
+package host
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"go_core/internal/settings"
+)
+
+// coreRelease is where the core archives are downloaded from.
+const coreRelease = "https://artifact.onwalk.net/xray-core/v25.3.6/"
+
+var (
+	coreOS = map[string]string{
+		"linux":   "linux",
+		"windows": "windows",
+		"darwin":  "macos",
+		"freebsd": "freebsd",
+		"openbsd": "openbsd",
+	}
+	coreArch = map[string]string{
+		"amd64":    "64",
+		"386":      "32",
+		"arm64":    "arm64-v8a",
+		"riscv64":  "riscv64",
+		"loong64":  "loong64",
+		"mips":     "mips32",
+		"mipsle":   "mips32le",
+		"mips64":   "mips64",
+		"mips64le": "mips64le",
+		"ppc64":    "ppc64",
+		"ppc64le":  "ppc64le",
+		"s390x":    "s390x",
+	}
+)
+
+// CoreAsset names the release archive for a platform, e.g.
+// "Xray-linux-arm64-v8a.zip". arm is the ARM version of 32-bit ARM hosts,
+// which have builds for v5, v6 and v7.
+func CoreAsset(goos, goarch string, arm int) (string, error) {
+	system, ok := coreOS[goos]
+	arch := coreArch[goarch]
+	if goarch == "arm" {
+		v := min(max(arm, 5), 7)
+		arch = "arm32-v" + strconv.Itoa(v)
+		if v == 7 {
+			arch += "a"
+		}
+	}
+	if !ok || arch == "" {
+		return "", fmt.Errorf("no xray core release for %s/%s", goos, goarch)
+	}
+	return "Xray-" + system + "-" + arch + ".zip", nil
+}
+
+// coreURL is the archive for this host, or empty when there is none.
+func coreURL() string {
+	asset, err := CoreAsset(runtime.GOOS, runtime.GOARCH, armVersion())
+	if err != nil {
+		return ""
+	}
+	return coreRelease + asset
+}
+
+// Core is the resolved xray core.
+type Core struct {
+	// Binary is the xray to run or, when not Found, where to install it.
+	Binary string `json:"binary"`
+	// Assets holds geoip.dat and geosite.dat: the binary's directory
+	// unless the user cannot write there.
+	Assets string `json:"assets"`
+	Found  bool   `json:"found"`
+	// System is set for locations shared by all users.
+	System bool `json:"system"`
+}
+
+// CoreDir is where the geo data files live, next to the core when
+// possible.
+func CoreDir() string {
+	return ResolveCore().Assets
+}
+
+// NodeConfigPath is where the config of a node imported outside the app
+// is written when its service does not name one yet.
+func NodeConfigPath(code string) string {
+	return filepath.Join(settings.Dir(), "nodes", "xray-vpn-node-"+code+".json")
+}
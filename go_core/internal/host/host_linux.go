@@ -0,0 +1,63 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+
+	"go_core/internal/platform"
+)
+
+// ServiceManager runs nodes as systemd user units, or under the process
+// supervisor where no systemd user manager runs. The supervisor takes the
+// services from the units the app generates.
+func ServiceManager() platform.ServiceManager {
+	if platform.SystemdAvailable() {
+		return platform.Systemd{}
+	}
+	home, _ := os.UserHomeDir()
+	return platform.Process{
+		State: filepath.Join(stateDir(), "services"),
+		Units: filepath.Join(home, ".config", "systemd", "user"),
+	}
+}
+
+// stateDir follows XDG_STATE_HOME.
+func stateDir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "xstream")
+}
+
+// Installer downloads the xray core over the resolved one when the user
+// can write there, and to the per-user or system location otherwise.
+func Installer() platform.ZipInstaller {
+	dir := installDir()
+	if c := ResolveCore(); c.Found && Writable(filepath.Dir(c.Binary)) {
+		dir = filepath.Dir(c.Binary)
+	}
+	return platform.ZipInstaller{
+		URL:    coreURL(),
+		Dir:    dir,
+		Binary: "xray",
+	}
+}
+
+// NodeWriter writes node configs. They may live in a root-owned
+// directory, so without write access sudo is used without a prompt.
+func NodeWriter() platform.FileWriter {
+	return platform.FallbackWriter{Plain: platform.PlainWriter{}, Privileged: platform.SudoWriter{}}
+}
+
+// NodesFile is the node list the app maintains.
+func NodesFile() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "xstream", "vpn_nodes.json")
+}
+
+// NodeServiceName is the unit of the node with the given country code.
+func NodeServiceName(code string) string {
+	return "xray-node-" + code + ".service"
+}
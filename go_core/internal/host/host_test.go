@@ -0,0 +1,34 @@
+package host
+
+import "testing"
+
+func TestCoreAsset(t *testing.T) {
+	tests := []struct {
+		goos, goarch string
+		arm          int
+		want         string
+	}{
+		{"linux", "amd64", 0, "Xray-linux-64.zip"},
+		{"linux", "arm64", 8, "Xray-linux-arm64-v8a.zip"},
+		{"linux", "arm", 5, "Xray-linux-arm32-v5.zip"},
+		{"linux", "arm", 6, "Xray-linux-arm32-v6.zip"},
+		{"linux", "arm", 7, "Xray-linux-arm32-v7a.zip"},
+		// A 64-bit CPU in a 32-bit userland runs the v7 build.
+		{"linux", "arm", 8, "Xray-linux-arm32-v7a.zip"},
+		{"linux", "arm", 4, "Xray-linux-arm32-v5.zip"},
+		{"linux", "mipsle", 0, "Xray-linux-mips32le.zip"},
+		{"windows", "386", 0, "Xray-windows-32.zip"},
+		{"windows", "arm", 7, "Xray-windows-arm32-v7a.zip"},
+		{"darwin", "arm64", 0, "Xray-macos-arm64-v8a.zip"},
+		{"freebsd", "amd64", 0, "Xray-freebsd-64.zip"},
+		{"linux", "sparc64", 0, ""},
+		{"android", "arm64", 0, ""},
+		{"plan9", "arm", 7, ""},
+	}
+	for _, tt := range tests {
+		got, err := CoreAsset(tt.goos, tt.goarch, tt.arm)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("CoreAsset(%s, %s, %d) = %q, %v, want %q", tt.goos, tt.goarch, tt.arm, got, err, tt.want)
+		}
+	}
+}
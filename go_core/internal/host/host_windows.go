@@ -0,0 +1,36 @@
+package host
+
+import (
+	"path/filepath"
+
+	"go_core/internal/platform"
+)
+
+// ServiceManager runs nodes as scheduled tasks.
+func ServiceManager() platform.ServiceManager {
+	return platform.Schtasks{Dir: CoreDir()}
+}
+
+// Installer downloads the xray core into the install directory.
+func Installer() platform.ZipInstaller {
+	return platform.ZipInstaller{
+		URL:    coreURL(),
+		Dir:    filepath.Dir(ResolveCore().Binary),
+		Binary: "xray.exe",
+	}
+}
+
+// NodeWriter writes node configs.
+func NodeWriter() platform.FileWriter {
+	return platform.PlainWriter{}
+}
+
+// NodesFile is the node list the app maintains.
+func NodesFile() string {
+	return filepath.Join(CoreDir(), "vpn_nodes.json")
+}
+
+// NodeServiceName is the task of the node with the given country code.
+func NodeServiceName(code string) string {
+	return "ray-node-" + code + ".schtasks"
+}
@@ -0,0 +1,108 @@
+package host
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go_core/internal/nodelist"
+	"go_core/internal/platform"
+)
+
+var codePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// NodeCode is the country code the app derives from a node name: its
+// first dash-separated part, lowercased.
+func NodeCode(name string) string {
+	return strings.ToLower(strings.Split(name, "-")[0])
+}
+
+// ValidCode reports whether code can name a service and a config file.
+func ValidCode(code string) bool {
+	return codePattern.MatchString(code)
+}
+
+// ImportNode adds a node the way the app's generator does: config is
+// written where the node's service expects it, or to NodeConfigPath for a
+// new service, the service is created and the node list entry of the same
+// name is replaced. When another node already has the service for code, a
+// number is appended to the code so that node's config is left alone.
+func ImportNode(sm platform.ServiceManager, w platform.FileWriter, name, code string, config []byte) (nodelist.Node, error) {
+	if !ValidCode(code) {
+		return nodelist.Node{}, fmt.Errorf("invalid country code %q", code)
+	}
+	nodes, err := nodelist.Load(NodesFile())
+	if err != nil {
+		return nodelist.Node{}, err
+	}
+	code = freeCode(nodes, name, code)
+	service := NodeServiceName(code)
+	cfgPath, err := sm.ConfigPath(service)
+	if err != nil {
+		cfgPath = NodeConfigPath(code)
+	}
+	if err := w.WriteFile(cfgPath, config); err != nil {
+		return nodelist.Node{}, err
+	}
+	core := ResolveCore()
+	if err := sm.Create(platform.Service{Name: service, Exec: core.Binary, Config: cfgPath, Assets: core.Assets}); err != nil {
+		return nodelist.Node{}, err
+	}
+	enabled := true
+	n := nodelist.Node{Name: name, CountryCode: code, ServiceName: service, ConfigPath: cfgPath, Enabled: &enabled}
+	return n, updateNodes(w, func(data []byte) ([]byte, error) {
+		return nodelist.Upsert(data, n)
+	})
+}
+
+// freeCode returns code, or code followed by the lowest number from 2 up,
+// such that no node other than the one named name uses its service.
+func freeCode(nodes []nodelist.Node, name, code string) string {
+	taken := map[string]bool{}
+	for _, n := range nodes {
+		if n.Name != name {
+			taken[n.ServiceName] = true
+		}
+	}
+	free := code
+	for i := 2; taken[NodeServiceName(free)]; i++ {
+		free = code + strconv.Itoa(i)
+	}
+	return free
+}
+
+// RemoveNode drops the node named name from the list, and its config when
+// it was imported to NodeConfigPath. The caller stops it first.
+func RemoveNode(w platform.FileWriter, name string) (*nodelist.Node, error) {
+	var removed *nodelist.Node
+	err := updateNodes(w, func(data []byte) ([]byte, error) {
+		out, n, err := nodelist.Remove(data, name)
+		removed = n
+		return out, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if removed == nil {
+		return nil, fmt.Errorf("node %q: %w", name, os.ErrNotExist)
+	}
+	if filepath.Dir(removed.ConfigPath) == filepath.Dir(NodeConfigPath("x")) {
+		os.Remove(removed.ConfigPath)
+	}
+	return removed, nil
+}
+
+func updateNodes(w platform.FileWriter, fn func([]byte) ([]byte, error)) error {
+	path := NodesFile()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if data, err = fn(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return w.WriteFile(path, data)
+}
@@ -0,0 +1,30 @@
+package host
+
+import (
+	"testing"
+
+	"go_core/internal/nodelist"
+)
+
+func TestFreeCode(t *testing.T) {
+	nodes := []nodelist.Node{
+		{Name: "US-West", ServiceName: NodeServiceName("us")},
+		{Name: "US-East", ServiceName: NodeServiceName("us2")},
+		{Name: "JP-Tokyo", ServiceName: NodeServiceName("jp")},
+	}
+	tests := []struct {
+		name, code, want string
+	}{
+		{"CA-Toronto", "ca", "ca"},
+		{"US-Central", "us", "us3"},
+		// Re-importing a node keeps its own service.
+		{"US-West", "us", "us"},
+		{"US-East", "us", "us2"},
+		{"JP-Tokyo", "jp", "jp"},
+	}
+	for _, tt := range tests {
+		if got := freeCode(nodes, tt.name, tt.code); got != tt.want {
+			t.Errorf("freeCode(%q, %q) = %q, want %q", tt.name, tt.code, got, tt.want)
+		}
+	}
+}
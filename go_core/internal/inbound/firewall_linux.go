@@ -0,0 +1,209 @@
+//go:build linux
+
+package inbound
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go_core/internal/platform"
+	"go_core/internal/settings"
+)
+
+// nftTable is used when neither firewalld nor ufw manages the host.
+const nftTable = "xstream_lan"
+
+// opened records what OpenFirewall changed so CloseFirewall can undo
+// exactly that, even after the settings were edited.
+type opened struct {
+	Backend string     `json:"backend"`
+	Rules   [][]string `json:"rules,omitempty"`
+}
+
+func statePath() string {
+	return settings.Path("inbound-firewall.json")
+}
+
+// Backend names the firewall manager in charge of the host.
+func Backend() string {
+	if _, err := Sys.Run(platform.Cmd{Name: "firewall-cmd", Args: []string{"--state"}, Query: true}); err == nil {
+		return "firewalld"
+	}
+	if out, err := query("ufw", "status"); err == nil && strings.Contains(out, "Status: active") {
+		return "ufw"
+	}
+	return "nftables"
+}
+
+// OpenFirewall admits the allowed clients to the inbound ports. It is a
+// no-op unless s shares with the LAN. With plain nftables, connections to
+// the ports from anyone else are dropped; local lists destination addresses
+// that stay reachable regardless, such as the split tunnel veth.
+func OpenFirewall(s Settings, local []string) error {
+	if err := CloseFirewall(); err != nil {
+		return err
+	}
+	if !s.ShareWithLAN {
+		return nil
+	}
+	st := opened{Backend: Backend()}
+	switch st.Backend {
+	case "firewalld":
+		for _, src := range s.ClientRanges() {
+			family := "ipv4"
+			if isV6(src) {
+				family = "ipv6"
+			}
+			for _, p := range s.protoPorts() {
+				rule := fmt.Sprintf("rule family=%s source address=%s port port=%d protocol=%s accept", family, src, p.port, p.proto)
+				st.Rules = append(st.Rules, []string{"firewall-cmd", "--add-rich-rule=" + rule})
+			}
+		}
+	case "ufw":
+		for _, src := range s.ClientRanges() {
+			for _, p := range s.protoPorts() {
+				st.Rules = append(st.Rules, []string{"ufw", "allow", "from", src, "to", "any", "port", strconv.Itoa(p.port), "proto", p.proto, "comment", "xstream"})
+			}
+		}
+	default:
+		if err := nft(rulesetFor(s, local), "-f", "-"); err != nil {
+			return err
+		}
+	}
+	for i, r := range st.Rules {
+		if err := privileged(r...); err != nil {
+			st.Rules = st.Rules[:i]
+			saveState(st)
+			return err
+		}
+	}
+	return saveState(st)
+}
+
+// CloseFirewall undoes the last OpenFirewall.
+func CloseFirewall() error {
+	data, err := os.ReadFile(statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var st opened
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	var errs []error
+	switch st.Backend {
+	case "firewalld":
+		for _, r := range st.Rules {
+			errs = append(errs, privileged("firewall-cmd", strings.Replace(r[1], "--add-", "--remove-", 1)))
+		}
+	case "ufw":
+		for _, r := range st.Rules {
+			errs = append(errs, privileged(append([]string{"ufw", "delete"}, r[1:]...)...))
+		}
+	default:
+		if _, err := query("nft", "list", "table", "inet", nftTable); err == nil {
+			errs = append(errs, nft("", "delete", "table", "inet", nftTable))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return Sys.Remove(statePath())
+}
+
+type protoPort struct {
+	proto string
+	port  int
+}
+
+func (s Settings) protoPorts() []protoPort {
+	var out []protoPort
+	for _, p := range s.Ports() {
+		out = append(out, protoPort{"tcp", p})
+	}
+	if s.Socks.Enabled && s.UDP {
+		out = append(out, protoPort{"udp", s.Socks.Port})
+	}
+	return out
+}
+
+func rulesetFor(s Settings, local []string) string {
+	var ports []string
+	for _, p := range s.Ports() {
+		ports = append(ports, strconv.Itoa(p))
+	}
+	var v4, v6 []string
+	for _, c := range s.ClientRanges() {
+		if isV6(c) {
+			v6 = append(v6, c)
+		} else {
+			v4 = append(v4, c)
+		}
+	}
+	set := strings.Join(ports, ", ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\n", nftTable)
+	fmt.Fprintf(&b, "delete table inet %s\n", nftTable)
+	fmt.Fprintf(&b, "table inet %s {\n", nftTable)
+	b.WriteString("\tchain input {\n")
+	b.WriteString("\t\ttype filter hook input priority -10; policy accept;\n")
+	b.WriteString("\t\tiifname \"lo\" accept\n")
+	for _, addr := range local {
+		fmt.Fprintf(&b, "\t\tip daddr %s accept\n", addr)
+	}
+	if len(v4) > 0 {
+		fmt.Fprintf(&b, "\t\tmeta l4proto { tcp, udp } th dport { %s } ip saddr { %s } accept\n", set, strings.Join(v4, ", "))
+	}
+	if len(v6) > 0 {
+		fmt.Fprintf(&b, "\t\tmeta l4proto { tcp, udp } th dport { %s } ip6 saddr { %s } accept\n", set, strings.Join(v6, ", "))
+	}
+	fmt.Fprintf(&b, "\t\tmeta l4proto { tcp, udp } th dport { %s } drop\n", set)
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func saveState(st opened) error {
+	data, _ := json.Marshal(st)
+	return Sys.WriteFile(statePath(), data, 0644)
+}
+
+func nft(stdin string, args ...string) error {
+	c := command(append([]string{"nft"}, args...))
+	c.Stdin = stdin
+	if _, err := Sys.Run(c); err != nil {
+		return fmt.Errorf("nft %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func privileged(args ...string) error {
+	if _, err := Sys.Run(command(args)); err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// query runs a privileged command that only reads state.
+func query(args ...string) (string, error) {
+	c := command(args)
+	c.Query = true
+	return Sys.Run(c)
+}
+
+// command runs args as root. -n: never prompt; a sudoers rule is required
+// when the app itself is not root.
+func command(args []string) platform.Cmd {
+	if os.Geteuid() == 0 {
+		return platform.Cmd{Name: args[0], Args: args[1:]}
+	}
+	return platform.Cmd{Name: "sudo", Args: append([]string{"-n"}, args...)}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !windows
+
+package inbound
+
+// Backend names the firewall manager in charge of the host.
+func Backend() string { return "" }
+
+// OpenFirewall is not supported on this platform; LAN clients rely on the
+// listen address and inbound accounts alone.
+func OpenFirewall(s Settings, local []string) error { return nil }
+
+// CloseFirewall is a no-op on this platform.
+func CloseFirewall() error { return nil }
@@ -0,0 +1,63 @@
+//go:build windows
+
+package inbound
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go_core/internal/platform"
+)
+
+const ruleName = "Xstream inbound"
+
+// Backend names the firewall manager in charge of the host.
+func Backend() string { return "netsh" }
+
+// OpenFirewall adds Windows Firewall rules admitting the allowed clients to
+// the inbound ports. It is a no-op unless s shares with the LAN. local is
+// unused on Windows.
+func OpenFirewall(s Settings, local []string) error {
+	if err := CloseFirewall(); err != nil {
+		return err
+	}
+	if !s.ShareWithLAN {
+		return nil
+	}
+	remote := "LocalSubnet"
+	if len(s.AllowedClients) > 0 {
+		remote = strings.Join(s.AllowedClients, ",")
+	}
+	var ports []string
+	for _, p := range s.Ports() {
+		ports = append(ports, strconv.Itoa(p))
+	}
+	if err := netsh("add", "TCP", strings.Join(ports, ","), remote); err != nil {
+		return err
+	}
+	if s.Socks.Enabled && s.UDP {
+		return netsh("add", "UDP", strconv.Itoa(s.Socks.Port), remote)
+	}
+	return nil
+}
+
+// CloseFirewall removes the rules added by OpenFirewall.
+func CloseFirewall() error {
+	out, _ := Sys.Run(platform.Cmd{Name: "netsh", Args: []string{"advfirewall", "firewall", "show", "rule", "name=" + ruleName}, Query: true})
+	if !strings.Contains(out, ruleName) {
+		return nil
+	}
+	return netsh("delete")
+}
+
+func netsh(op string, args ...string) error {
+	full := []string{"advfirewall", "firewall", op, "rule", "name=" + ruleName}
+	if op == "add" {
+		full = append(full, "dir=in", "action=allow", "protocol="+args[0], "localport="+args[1], "remoteip="+args[2])
+	}
+	if _, err := Sys.Run(platform.Cmd{Name: "netsh", Args: full}); err != nil {
+		return fmt.Errorf("netsh %s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Package inbound models the local socks/http listeners xray exposes and
+// generates the xray "inbounds" section from that model.
+package inbound
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"go_core/internal/platform"
+	"go_core/internal/settings"
+	"go_core/internal/xrayconf"
+)
+
+// Sys applies the firewall rules and their record. The bridge points it
+// at the dry-run plan while one is active.
+var Sys platform.System = platform.Live{}
+
+// Tags of the generated inbounds. Routing and firewall rules refer to them.
+const (
+	SocksTag = "socks-in"
+	HTTPTag  = "http-in"
+)
+
+// Account is a username/password pair accepted by an inbound.
+type Account struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+// Listener is one protocol's inbound.
+type Listener struct {
+	Enabled  bool      `json:"enabled"`
+	Port     int       `json:"port"`
+	Accounts []Account `json:"accounts,omitempty"`
+}
+
+// Settings is the persisted inbound model.
+type Settings struct {
+	// ShareWithLAN listens on LANAddress (all interfaces when empty) and
+	// opens the ports in the firewall. Otherwise only loopback is bound.
+	ShareWithLAN bool   `json:"shareWithLan"`
+	LANAddress   string `json:"lanAddress,omitempty"`
+	// AllowedClients limits which LAN sources the firewall lets connect
+	// when sharing, on top of the accounts. Empty means any address on the
+	// local network.
+	AllowedClients []string `json:"allowedClients,omitempty"`
+	Socks          Listener `json:"socks"`
+	HTTP           Listener `json:"http"`
+	UDP            bool     `json:"udp"`
+	Sniffing       bool     `json:"sniffing"`
+	// AutoPorts moves inbounds to free ports when their configured port is
+	// taken at node start, instead of failing.
+	AutoPorts bool `json:"autoPorts"`
+}
+
+// DefaultSettings matches the ports of the Dart template but binds to
+// loopback only.
+func DefaultSettings() Settings {
+	return Settings{
+		Socks:    Listener{Enabled: true, Port: 1080},
+		HTTP:     Listener{Enabled: true, Port: 1081},
+		UDP:      true,
+		Sniffing: true,
+	}
+}
+
+// Validate checks ports, addresses and accounts.
+func (s Settings) Validate() error {
+	if !s.Socks.Enabled && !s.HTTP.Enabled {
+		return errors.New("at least one inbound must be enabled")
+	}
+	for name, l := range map[string]Listener{"socks": s.Socks, "http": s.HTTP} {
+		if !l.Enabled {
+			continue
+		}
+		if l.Port < 1 || l.Port > 65535 {
+			return fmt.Errorf("%s: invalid port %d", name, l.Port)
+		}
+		for _, a := range l.Accounts {
+			if a.User == "" || a.Pass == "" {
+				return fmt.Errorf("%s: account needs both user and password", name)
+			}
+		}
+	}
+	if s.Socks.Enabled && s.HTTP.Enabled && s.Socks.Port == s.HTTP.Port {
+		return errors.New("socks and http inbounds share a port")
+	}
+	if s.LANAddress != "" && net.ParseIP(s.LANAddress) == nil {
+		return fmt.Errorf("invalid LAN address %q", s.LANAddress)
+	}
+	for _, c := range s.AllowedClients {
+		if _, _, err := net.ParseCIDR(c); err != nil && net.ParseIP(c) == nil {
+			return fmt.Errorf("invalid client range %q", c)
+		}
+	}
+	if s.ShareWithLAN && !s.hasAuth() {
+		// Rejected: the client list is only enforced by the host firewall,
+		// and a firewall that could not be set up would leave an open proxy
+		// on whatever network the machine is on.
+		return errors.New("sharing with LAN needs accounts on every enabled inbound")
+	}
+	return nil
+}
+
+func (s Settings) hasAuth() bool {
+	return (!s.Socks.Enabled || len(s.Socks.Accounts) > 0) && (!s.HTTP.Enabled || len(s.HTTP.Accounts) > 0)
+}
+
+// ListenAddress is the address the inbounds bind to.
+func (s Settings) ListenAddress() string {
+	if !s.ShareWithLAN {
+		return "127.0.0.1"
+	}
+	if s.LANAddress != "" {
+		return s.LANAddress
+	}
+	return "0.0.0.0"
+}
+
+// Ports returns the enabled inbound ports.
+func (s Settings) Ports() []int {
+	var ports []int
+	if s.Socks.Enabled {
+		ports = append(ports, s.Socks.Port)
+	}
+	if s.HTTP.Enabled {
+		ports = append(ports, s.HTTP.Port)
+	}
+	return ports
+}
+
+const file = "inbounds.json"
+
+// Load returns the saved settings or DefaultSettings.
+func Load() (Settings, error) {
+	s := DefaultSettings()
+	err := settings.Load(file, &s)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	return s, s.Validate()
+}
+
+// Save validates and persists s. The file holds proxy passwords, so it is
+// only readable by the user.
+func Save(s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	return settings.Save(file, s, 0600)
+}
+
+// Generate returns the xray inbounds for s. Each extra address gets its own
+// copy of the listeners, tagged with a numeric suffix and without accounts;
+// the split tunnel namespace uses this to reach xray without opening it to
+// the LAN. Extras are dropped when s already listens on all interfaces.
+func Generate(s Settings, extraListen ...string) []map[string]any {
+	var out []map[string]any
+	addrs := []string{s.ListenAddress()}
+	if addrs[0] != "0.0.0.0" {
+		addrs = append(addrs, extraListen...)
+	}
+	for i, addr := range addrs {
+		suffix := ""
+		socks, http := s.Socks.Accounts, s.HTTP.Accounts
+		if i > 0 {
+			suffix = fmt.Sprintf("-%d", i)
+			socks, http = nil, nil
+		}
+		if s.Socks.Enabled {
+			settings := map[string]any{"auth": "noauth", "udp": s.UDP}
+			if len(socks) > 0 {
+				settings["auth"] = "password"
+				settings["accounts"] = socks
+			}
+			if s.UDP && addr != "0.0.0.0" {
+				settings["ip"] = addr
+			}
+			out = append(out, s.inbound(SocksTag+suffix, addr, s.Socks.Port, "socks", settings))
+		}
+		if s.HTTP.Enabled {
+			settings := map[string]any{}
+			if len(http) > 0 {
+				settings["accounts"] = http
+			}
+			out = append(out, s.inbound(HTTPTag+suffix, addr, s.HTTP.Port, "http", settings))
+		}
+	}
+	return out
+}
+
+func (s Settings) inbound(tag, listen string, port int, protocol string, settings map[string]any) map[string]any {
+	in := map[string]any{
+		"tag":      tag,
+		"listen":   listen,
+		"port":     port,
+		"protocol": protocol,
+		"settings": settings,
+	}
+	if s.Sniffing {
+		in["sniffing"] = map[string]any{
+			"enabled":      true,
+			"destOverride": []string{"http", "tls", "quic"},
+		}
+	}
+	return in
+}
+
+// Apply replaces the inbounds of cfg with the generated ones. Inbounds the
+// model does not manage, such as dokodemo-door or tun, are kept.
+func Apply(cfg xrayconf.Config, s Settings, extraListen ...string) error {
+	var existing []map[string]any
+	if err := cfg.Section("inbounds", &existing); err != nil {
+		return err
+	}
+	inbounds := make([]any, 0, len(existing)+2)
+	for _, in := range Generate(s, extraListen...) {
+		inbounds = append(inbounds, in)
+	}
+	for _, in := range existing {
+		p, _ := in["protocol"].(string)
+		if p == "socks" || p == "http" {
+			continue
+		}
+		inbounds = append(inbounds, in)
+	}
+	return cfg.SetSection("inbounds", inbounds)
+}
+
+// ClientRanges returns the sources the firewall should admit when sharing.
+func (s Settings) ClientRanges() []string {
+	if len(s.AllowedClients) > 0 {
+		return s.AllowedClients
+	}
+	return []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7", "fe80::/10"}
+}
+
+func isV6(cidr string) bool {
+	return strings.Contains(cidr, ":")
+}
@@ -0,0 +1,129 @@
+// Package instance keeps a single app instance per user. The first process
+// listens on a per-user socket; a later launch sends its arguments there
+// and is told to exit.
+package instance
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrRunning is returned by Acquire when another instance took the
+// arguments.
+var ErrRunning = errors.New("another instance is running")
+
+// handoffTimeout bounds a handoff on both ends, so a stuck peer cannot
+// block a launch or the accept loop.
+const handoffTimeout = 3 * time.Second
+
+type handoff struct {
+	Args []string `json:"args"`
+}
+
+type reply struct {
+	OK bool `json:"ok"`
+}
+
+// Server is the running instance's end of the socket.
+type Server struct {
+	ln     net.Listener
+	handle func(args []string)
+	wg     sync.WaitGroup
+}
+
+// Acquire makes this process the instance for name. If another instance
+// already runs, args are handed to it and ErrRunning is returned. handle
+// is called with the arguments of every later launch.
+func Acquire(name string, args []string, handle func(args []string)) (*Server, error) {
+	addr, err := address(name)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := listen(addr)
+	if err != nil {
+		if serr := send(addr, args); serr == nil {
+			return nil, ErrRunning
+		}
+		return nil, err
+	}
+	s := &Server{ln: ln, handle: handle}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting handoffs and releases the socket.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.receive(conn)
+	}
+}
+
+func (s *Server) receive(conn net.Conn) {
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		fmt.Println("Reject instance handoff:", err)
+		return
+	}
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+	var h handoff
+	if err := json.NewDecoder(conn).Decode(&h); err != nil {
+		return
+	}
+	json.NewEncoder(conn).Encode(reply{OK: true})
+	if s.handle != nil {
+		go s.handle(h.Args)
+	}
+}
+
+// send hands args to the instance listening on addr.
+func send(addr string, args []string) error {
+	conn, err := net.DialTimeout("unix", addr, handoffTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Anyone can bind the name first; the arguments may carry a link
+	// with credentials, so they only go to our own user.
+	if err := checkPeer(conn); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(handoffTimeout))
+	if args == nil {
+		args = []string{}
+	}
+	if err := json.NewEncoder(conn).Encode(handoff{Args: args}); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var r reply
+	if err := json.Unmarshal(line, &r); err != nil {
+		return err
+	}
+	if !r.OK {
+		return fmt.Errorf("instance refused handoff")
+	}
+	return nil
+}
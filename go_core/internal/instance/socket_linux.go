@@ -0,0 +1,50 @@
+//go:build linux
+
+package instance
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// address is an abstract socket: it needs no file and goes away with the
+// process, so a crash leaves nothing stale behind. Abstract names are not
+// per user, hence the uid in the name and the peer check.
+func address(name string) (string, error) {
+	return fmt.Sprintf("@%s-%d", name, os.Getuid()), nil
+}
+
+// listen binds addr; binding fails while another instance holds it.
+func listen(addr string) (net.Listener, error) {
+	return net.Listen("unix", addr)
+}
+
+// checkPeer accepts only processes of the same user. Both ends check: an
+// abstract name is not protected by file permissions.
+func checkPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("not a unix socket")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return err
+	}
+	if credErr != nil {
+		return credErr
+	}
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("peer uid %d is not %d", cred.Uid, os.Getuid())
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build !linux
+
+package instance
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// address is a socket file in the user's cache directory, which only that
+// user can reach.
+func address(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "instance.sock"), nil
+}
+
+// listen binds addr unless an instance answers there. A file nobody
+// answers on was left by a crashed instance and is replaced.
+func listen(addr string) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", addr, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: in use", addr)
+	}
+	os.Remove(addr)
+	return net.Listen("unix", addr)
+}
+
+// checkPeer trusts the directory permissions.
+func checkPeer(net.Conn) error {
+	return nil
+}
@@ -0,0 +1,245 @@
+//go:build linux
+
+// Package killswitch keeps traffic from leaving the machine outside the
+// tunnel while a node is active. It installs an nftables table whose output
+// chain drops everything except loopback, the TUN interface, the proxy
+// servers and, optionally, the local network.
+//
+// The table lives in the kernel, so if the app or xray dies the machine
+// stays blocked rather than silently falling back to clear traffic. Recover
+// cleans up after a crash once the owning node is known to be gone.
+package killswitch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"go_core/internal/platform"
+	"go_core/internal/settings"
+)
+
+// Table is the nftables table owned by Xstream.
+const Table = "xstream_killswitch"
+
+// DefaultTun is the interface name assumed when Options.TunInterface is empty.
+const DefaultTun = "xstream0"
+
+// Sys applies the ruleset and the owner record. The bridge points it at
+// the dry-run plan while one is active.
+var Sys platform.System = platform.Live{}
+
+// Options is the persisted user configuration.
+type Options struct {
+	Enabled      bool   `json:"enabled"`
+	AllowLAN     bool   `json:"allowLan"`
+	TunInterface string `json:"tunInterface,omitempty"`
+	// Netns runs nft inside the named network namespace. It exists so the
+	// ruleset can be exercised without touching the host's firewall.
+	Netns string `json:"netns,omitempty"`
+}
+
+// Rules is everything needed to render the ruleset for one node.
+type Rules struct {
+	AllowLAN bool
+	Tun      string
+	Servers  []net.IP
+	// Cgroup is the cgroup v2 path of the xray service, relative to the
+	// cgroup root. Its sockets may talk to anything, which covers routing
+	// rules that send traffic out through the "direct" outbound.
+	Cgroup string
+}
+
+type state struct {
+	Service   string    `json:"service"`
+	EngagedAt time.Time `json:"engagedAt"`
+}
+
+var lanV4 = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "224.0.0.0/4", "255.255.255.255"}
+var lanV6 = []string{"fc00::/7", "fe80::/10", "ff00::/8"}
+
+const optionsFile = "killswitch.json"
+
+func statePath() string { return settings.Path("killswitch-state.json") }
+
+// LoadOptions returns the saved options, or the zero value (disabled) when
+// nothing has been saved yet.
+func LoadOptions() (Options, error) {
+	var o Options
+	err := settings.Load(optionsFile, &o)
+	if errors.Is(err, os.ErrNotExist) {
+		return Options{}, nil
+	}
+	return o, err
+}
+
+// SaveOptions persists o.
+func SaveOptions(o Options) error {
+	return settings.Save(optionsFile, o, 0644)
+}
+
+// Ruleset renders the nft script for r. Loading it replaces any previous
+// Xstream table atomically.
+func Ruleset(r Rules) string {
+	tun := r.Tun
+	if tun == "" {
+		tun = DefaultTun
+	}
+	var v4, v6 []string
+	seen := map[string]bool{}
+	for _, ip := range r.Servers {
+		if seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		if ip4 := ip.To4(); ip4 != nil {
+			v4 = append(v4, ip4.String())
+		} else {
+			v6 = append(v6, ip.String())
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\n", Table)
+	fmt.Fprintf(&b, "delete table inet %s\n", Table)
+	fmt.Fprintf(&b, "table inet %s {\n", Table)
+	b.WriteString("\tchain output {\n")
+	b.WriteString("\t\ttype filter hook output priority 0; policy drop;\n")
+	b.WriteString("\t\toifname \"lo\" accept\n")
+	fmt.Fprintf(&b, "\t\toifname %q accept\n", tun)
+	if len(v4) > 0 {
+		fmt.Fprintf(&b, "\t\tip daddr { %s } accept\n", strings.Join(v4, ", "))
+	}
+	if len(v6) > 0 {
+		fmt.Fprintf(&b, "\t\tip6 daddr { %s } accept\n", strings.Join(v6, ", "))
+	}
+	if r.Cgroup != "" {
+		level := len(strings.Split(strings.Trim(r.Cgroup, "/"), "/"))
+		fmt.Fprintf(&b, "\t\tsocket cgroupv2 level %d %q accept\n", level, strings.Trim(r.Cgroup, "/"))
+	}
+	// DHCP and neighbour discovery keep the link itself alive.
+	b.WriteString("\t\tudp sport 68 udp dport 67 accept\n")
+	b.WriteString("\t\ticmpv6 type { nd-router-solicit, nd-neighbor-solicit, nd-neighbor-advert } accept\n")
+	if r.AllowLAN {
+		fmt.Fprintf(&b, "\t\tip daddr { %s } accept\n", strings.Join(lanV4, ", "))
+		fmt.Fprintf(&b, "\t\tip6 daddr { %s } accept\n", strings.Join(lanV6, ", "))
+	}
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Resolve turns server host names into addresses. It must run before the
+// table is loaded, since DNS is blocked afterwards.
+func Resolve(hosts []string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		found, err := net.LookupIP(h)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", h, err)
+		}
+		ips = append(ips, found...)
+	}
+	return ips, nil
+}
+
+// Engage loads the ruleset for service and records it as the owner.
+func Engage(o Options, service string, r Rules) error {
+	if r.Tun == "" {
+		r.Tun = o.TunInterface
+	}
+	r.AllowLAN = o.AllowLAN
+	if err := nft(o, Ruleset(r), false, "-f", "-"); err != nil {
+		return err
+	}
+	data, _ := json.Marshal(state{Service: service, EngagedAt: time.Now()})
+	return Sys.WriteFile(statePath(), data, 0644)
+}
+
+// Release removes the table. It succeeds when no table is loaded.
+func Release(o Options) error {
+	engaged, err := Engaged(o)
+	if err != nil {
+		return err
+	}
+	if engaged {
+		if err := nft(o, "", false, "delete", "table", "inet", Table); err != nil {
+			return err
+		}
+	}
+	return Sys.Remove(statePath())
+}
+
+// Engaged reports whether the table is currently loaded. It fails when nft
+// cannot tell, such as when sudo is not allowed to run it, so that a table
+// which may still be loaded is not taken for gone.
+func Engaged(o Options) (bool, error) {
+	err := nft(o, "", true, "list", "table", "inet", Table)
+	if errors.Is(err, errNoTable) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Owner returns the service recorded by the last Engage, if any.
+func Owner() string {
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		return ""
+	}
+	var s state
+	json.Unmarshal(data, &s)
+	return s.Service
+}
+
+// Recover releases a table left behind by a crashed app: one whose owner is
+// no longer active, or one with no recorded owner at all. It reports
+// whether anything was removed.
+func Recover(o Options, active func(service string) bool) (bool, error) {
+	engaged, err := Engaged(o)
+	if err != nil {
+		return false, err
+	}
+	if !engaged {
+		return false, Sys.Remove(statePath())
+	}
+	if owner := Owner(); owner != "" && active(owner) {
+		return false, nil
+	}
+	return true, Release(o)
+}
+
+// errNoTable is returned by nft when the table it was given is not loaded.
+var errNoTable = errors.New("no such table")
+
+// nft runs nft with args, feeding it stdin. query marks a command that
+// only reads the ruleset.
+func nft(o Options, stdin string, query bool, args ...string) error {
+	var name string
+	var full []string
+	switch {
+	case o.Netns != "":
+		name, full = "ip", append([]string{"netns", "exec", o.Netns, "nft"}, args...)
+	case os.Geteuid() == 0:
+		name, full = "nft", args
+	default:
+		// -n: never prompt. A sudoers rule or CAP_NET_ADMIN is required.
+		name, full = "sudo", append([]string{"-n", "nft"}, args...)
+	}
+	out, err := Sys.Run(platform.Cmd{Name: name, Args: full, Stdin: stdin, Query: query})
+	if err != nil && strings.HasPrefix(out, "Error: No such file or directory") {
+		return fmt.Errorf("nft %s: %w", strings.Join(args, " "), errNoTable)
+	}
+	if err != nil {
+		return fmt.Errorf("nft %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package killswitch
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRuleset(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		want  string
+	}{
+		{
+			name:  "defaults",
+			rules: Rules{},
+			want: `table inet xstream_killswitch
+delete table inet xstream_killswitch
+table inet xstream_killswitch {
+	chain output {
+		type filter hook output priority 0; policy drop;
+		oifname "lo" accept
+		oifname "xstream0" accept
+		udp sport 68 udp dport 67 accept
+		icmpv6 type { nd-router-solicit, nd-neighbor-solicit, nd-neighbor-advert } accept
+	}
+}
+`,
+		},
+		{
+			name: "servers, cgroup and LAN",
+			rules: Rules{
+				AllowLAN: true,
+				Tun:      "tun9",
+				Servers: []net.IP{
+					net.ParseIP("203.0.113.7"),
+					net.ParseIP("2001:db8::1"),
+					net.ParseIP("203.0.113.7"),
+					net.ParseIP("198.51.100.2"),
+				},
+				Cgroup: "/system.slice/xray-us.service/",
+			},
+			want: `table inet xstream_killswitch
+delete table inet xstream_killswitch
+table inet xstream_killswitch {
+	chain output {
+		type filter hook output priority 0; policy drop;
+		oifname "lo" accept
+		oifname "tun9" accept
+		ip daddr { 203.0.113.7, 198.51.100.2 } accept
+		ip6 daddr { 2001:db8::1 } accept
+		socket cgroupv2 level 2 "system.slice/xray-us.service" accept
+		udp sport 68 udp dport 67 accept
+		icmpv6 type { nd-router-solicit, nd-neighbor-solicit, nd-neighbor-advert } accept
+		ip daddr { 10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, 169.254.0.0/16, 224.0.0.0/4, 255.255.255.255 } accept
+		ip6 daddr { fc00::/7, fe80::/10, ff00::/8 } accept
+	}
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Ruleset(tt.rules); got != tt.want {
+				t.Errorf("Ruleset() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+//go:build linux
+
+// Package netmon reports network changes: route and address updates from
+// netlink, and resume from suspend from logind. Changes are debounced, so
+// a Wi-Fi roam or a resume that brings several links up is one change.
+package netmon
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+// Reasons for a change.
+const (
+	ReasonRoute   = "route"
+	ReasonAddress = "address"
+	ReasonResume  = "resume"
+)
+
+// Route is the default route: where traffic leaves the machine.
+type Route struct {
+	Interface string `json:"interface"`
+	Gateway   string `json:"gateway,omitempty"`
+}
+
+// Change is reported once the network has been quiet for the debounce
+// period. Reason is that of the last event.
+type Change struct {
+	Reason string `json:"reason"`
+	Route
+}
+
+// Watch listens for changes and calls fn after each settles. It returns
+// an error only when netlink cannot be opened; without logind, resume is
+// not noticed.
+func Watch(debounce time.Duration, fn func(Change)) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	groups := uint32(unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR)
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: groups}); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	d := &debouncer{delay: debounce, fn: fn}
+	go watchLogind(d)
+	go func() {
+		defer unix.Close(fd)
+		buf := make([]byte, 1<<16)
+		for {
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err == unix.EINTR {
+				continue
+			}
+			if err == unix.ENOBUFS {
+				// Messages were dropped; there were changes all the same.
+				d.kick(ReasonRoute)
+				continue
+			}
+			if err != nil {
+				return
+			}
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, m := range msgs {
+				switch m.Header.Type {
+				case unix.RTM_NEWROUTE, unix.RTM_DELROUTE:
+					d.kick(ReasonRoute)
+				case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+					d.kick(ReasonAddress)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// watchLogind kicks on resume: PrepareForSleep(false).
+func watchLogind(d *debouncer) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.login1.Manager"),
+		dbus.WithMatchMember("PrepareForSleep"),
+	); err != nil {
+		conn.Close()
+		return
+	}
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	for sig := range signals {
+		if len(sig.Body) == 1 && sig.Body[0] == false {
+			d.kick(ReasonResume)
+		}
+	}
+}
+
+type debouncer struct {
+	delay  time.Duration
+	fn     func(Change)
+	mu     sync.Mutex
+	timer  *time.Timer
+	reason string
+}
+
+// kick (re)starts the quiet period. A resume is kept as the reason even if
+// route events follow, since it calls for a reset regardless.
+func (d *debouncer) kick(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.reason != ReasonResume {
+		d.reason = reason
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.delay, d.fire)
+}
+
+func (d *debouncer) fire() {
+	d.mu.Lock()
+	reason := d.reason
+	d.reason = ""
+	d.timer = nil
+	d.mu.Unlock()
+	route, _ := DefaultRoute()
+	d.fn(Change{Reason: reason, Route: route})
+}
+
+// DefaultRoute returns the IPv4 default route with the lowest metric, or
+// the IPv6 one when there is none. It is empty when offline. Routes over
+// TUN/TAP devices are skipped: in TUN mode the node's own device is the
+// default route, and the physical link under it is what changes.
+func DefaultRoute() (Route, error) {
+	if r, err := defaultRoute4(); err != nil || r.Interface != "" {
+		return r, err
+	}
+	return defaultRoute6()
+}
+
+// defaultRoute4 reads /proc/net/route: Iface Destination Gateway Flags
+// RefCnt Use Metric Mask …, addresses in little-endian hex.
+func defaultRoute4() (Route, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return Route{}, err
+	}
+	defer f.Close()
+	var best Route
+	bestMetric := -1
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" || isTun(fields[0]) {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		if flags&unix.RTF_UP == 0 {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+		if bestMetric >= 0 && metric >= bestMetric {
+			continue
+		}
+		bestMetric = metric
+		best = Route{Interface: fields[0]}
+		if gw, err := hex.DecodeString(fields[2]); err == nil && len(gw) == 4 {
+			if ip := net.IPv4(gw[3], gw[2], gw[1], gw[0]); !ip.IsUnspecified() {
+				best.Gateway = ip.String()
+			}
+		}
+	}
+	return best, sc.Err()
+}
+
+// defaultRoute6 reads /proc/net/ipv6_route: destination, prefix length,
+// source, source prefix, next hop, metric, refcount, use, flags, device.
+func defaultRoute6() (Route, error) {
+	f, err := os.Open("/proc/net/ipv6_route")
+	if err != nil {
+		return Route{}, err
+	}
+	defer f.Close()
+	var best Route
+	var bestMetric uint64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 || fields[1] != "00" || strings.Trim(fields[0], "0") != "" || fields[9] == "lo" || isTun(fields[9]) {
+			continue
+		}
+		metric, _ := strconv.ParseUint(fields[5], 16, 32)
+		if best.Interface != "" && metric >= bestMetric {
+			continue
+		}
+		bestMetric = metric
+		best = Route{Interface: fields[9]}
+		if gw, err := hex.DecodeString(fields[4]); err == nil && len(gw) == 16 {
+			if ip := net.IP(gw); !ip.IsUnspecified() {
+				best.Gateway = ip.String()
+			}
+		}
+	}
+	return best, sc.Err()
+}
+
+func isTun(iface string) bool {
+	_, err := os.Stat("/sys/class/net/" + iface + "/tun_flags")
+	return err == nil
+}
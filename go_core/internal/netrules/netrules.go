@@ -0,0 +1,228 @@
+// Package netrules decides which node should run for the current network
+// and time: user rules such as "connect on untrusted Wi-Fi" or "disconnect
+// on the office network" are matched in order, and the first match wins.
+package netrules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go_core/internal/settings"
+)
+
+// Actions a rule can take.
+const (
+	ActionConnect    = "connect"
+	ActionDisconnect = "disconnect"
+)
+
+// State is the network the machine is on. NetworkManager provides the
+// connection fields; NetworkManager is false when it could not be asked.
+type State struct {
+	Interface      string `json:"interface"`
+	SSID           string `json:"ssid"`
+	ConnectionID   string `json:"connectionId"`
+	Type           string `json:"type"`
+	Metered        bool   `json:"metered"`
+	GatewayMAC     string `json:"gatewayMac"`
+	NetworkManager bool   `json:"networkManager"`
+}
+
+// Connection types, normalized from NetworkManager's.
+const (
+	TypeWifi     = "wifi"
+	TypeEthernet = "ethernet"
+	TypeVPN      = "vpn"
+)
+
+// Match is what a rule applies to. Empty fields match anything; a rule
+// without any field always matches, as a fallback at the end of the list.
+type Match struct {
+	SSID         []string `json:"ssid,omitempty"`
+	ConnectionID []string `json:"connectionId,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Metered      *bool    `json:"metered,omitempty"`
+	GatewayMAC   []string `json:"gatewayMac,omitempty"`
+	Schedule     *Window  `json:"schedule,omitempty"`
+}
+
+// Window is a time window on some days of the week. From after To spans
+// midnight; the days are those the window starts on.
+type Window struct {
+	Days []string `json:"days,omitempty"` // "mon" … "sun"; empty is every day
+	From string   `json:"from"`           // "15:04"
+	To   string   `json:"to"`
+}
+
+// Rule runs Action when Match holds. Node is the service to connect to.
+type Rule struct {
+	Name   string `json:"name"`
+	Match  Match  `json:"match"`
+	Action string `json:"action"`
+	Node   string `json:"node,omitempty"`
+}
+
+// Config holds the rules and the switch for all of them.
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Rules   []Rule `json:"rules"`
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Validate checks names, actions and schedules.
+func (c Config) Validate() error {
+	names := map[string]bool{}
+	for i, r := range c.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("rule %q: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+		switch r.Action {
+		case ActionConnect:
+			if r.Node == "" {
+				return fmt.Errorf("rule %q: connect needs a node", r.Name)
+			}
+		case ActionDisconnect:
+		default:
+			return fmt.Errorf("rule %q: unknown action %q", r.Name, r.Action)
+		}
+		if w := r.Match.Schedule; w != nil {
+			if _, err := time.Parse("15:04", w.From); err != nil {
+				return fmt.Errorf("rule %q: from: %w", r.Name, err)
+			}
+			if _, err := time.Parse("15:04", w.To); err != nil {
+				return fmt.Errorf("rule %q: to: %w", r.Name, err)
+			}
+			for _, d := range w.Days {
+				if weekday(d) < 0 {
+					return fmt.Errorf("rule %q: unknown day %q", r.Name, d)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// HasSchedule reports whether any rule depends on the time.
+func (c Config) HasSchedule() bool {
+	for _, r := range c.Rules {
+		if r.Match.Schedule != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns the first rule matching s at now, or nil.
+func (c Config) Evaluate(s State, now time.Time) *Rule {
+	for i := range c.Rules {
+		if c.Rules[i].Match.matches(s, now) {
+			return &c.Rules[i]
+		}
+	}
+	return nil
+}
+
+func (m Match) matches(s State, now time.Time) bool {
+	if len(m.SSID) > 0 && !contains(m.SSID, s.SSID, false) {
+		return false
+	}
+	if len(m.ConnectionID) > 0 && !contains(m.ConnectionID, s.ConnectionID, false) {
+		return false
+	}
+	if m.Type != "" && m.Type != s.Type {
+		return false
+	}
+	if m.Metered != nil && *m.Metered != s.Metered {
+		return false
+	}
+	if len(m.GatewayMAC) > 0 && !contains(m.GatewayMAC, s.GatewayMAC, true) {
+		return false
+	}
+	if m.Schedule != nil && !m.Schedule.contains(now) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, v string, fold bool) bool {
+	if v == "" {
+		return false
+	}
+	for _, x := range list {
+		if x == v || (fold && strings.EqualFold(x, v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Window) contains(now time.Time) bool {
+	from, _ := time.Parse("15:04", w.From)
+	to, _ := time.Parse("15:04", w.To)
+	minute := now.Hour()*60 + now.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+	day := int(now.Weekday())
+	switch {
+	case start <= end:
+		return minute >= start && minute < end && w.onDay(day)
+	case minute >= start:
+		return w.onDay(day)
+	case minute < end:
+		// The part after midnight belongs to the previous day's window.
+		return w.onDay((day + 6) % 7)
+	}
+	return false
+}
+
+func (w Window) onDay(day int) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+func weekday(name string) int {
+	for i, d := range weekdays {
+		if strings.EqualFold(d, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+const file = "netrules.json"
+
+// Load returns the saved config; without one automation is off.
+func Load() (Config, error) {
+	var c Config
+	err := settings.Load(file, &c)
+	if errors.Is(err, os.ErrNotExist) {
+		return Config{Rules: []Rule{}}, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	return c, c.Validate()
+}
+
+// Save validates and persists c.
+func Save(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return settings.Save(file, c, 0644)
+}
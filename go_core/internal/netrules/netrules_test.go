@@ -0,0 +1,91 @@
+package netrules
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns 2026-10-19 (a Monday) plus dayOffset days at hh:mm local time.
+func at(dayOffset, hh, mm int) time.Time {
+	return time.Date(2026, 10, 19+dayOffset, hh, mm, 0, 0, time.Local)
+}
+
+func TestWindowContains(t *testing.T) {
+	tests := []struct {
+		name string
+		w    Window
+		now  time.Time
+		want bool
+	}{
+		{"inside", Window{From: "09:00", To: "18:00"}, at(0, 12, 0), true},
+		{"at start", Window{From: "09:00", To: "18:00"}, at(0, 9, 0), true},
+		{"end is exclusive", Window{From: "09:00", To: "18:00"}, at(0, 18, 0), false},
+		{"before", Window{From: "09:00", To: "18:00"}, at(0, 8, 59), false},
+		{"on a listed day", Window{Days: []string{"mon"}, From: "09:00", To: "18:00"}, at(0, 10, 0), true},
+		{"day names fold case", Window{Days: []string{"Mon"}, From: "09:00", To: "18:00"}, at(0, 10, 0), true},
+		{"on another day", Window{Days: []string{"tue"}, From: "09:00", To: "18:00"}, at(0, 10, 0), false},
+		{"wrap before midnight", Window{From: "22:00", To: "06:00"}, at(0, 23, 30), true},
+		{"wrap after midnight", Window{From: "22:00", To: "06:00"}, at(1, 5, 59), true},
+		{"wrap end is exclusive", Window{From: "22:00", To: "06:00"}, at(1, 6, 0), false},
+		{"wrap outside", Window{From: "22:00", To: "06:00"}, at(0, 12, 0), false},
+		// Past midnight the window belongs to the day it started on.
+		{"after midnight of a listed day", Window{Days: []string{"mon"}, From: "22:00", To: "06:00"}, at(1, 2, 0), true},
+		{"after midnight into a listed day", Window{Days: []string{"tue"}, From: "22:00", To: "06:00"}, at(1, 2, 0), false},
+		{"sunday wraps into monday", Window{Days: []string{"sun"}, From: "22:00", To: "06:00"}, at(0, 2, 0), true},
+		{"evening of a listed day", Window{Days: []string{"tue"}, From: "22:00", To: "06:00"}, at(1, 23, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.w.contains(tt.now); got != tt.want {
+				t.Errorf("%+v.contains(%s) = %v, want %v", tt.w, tt.now.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	metered := true
+	c := Config{Enabled: true, Rules: []Rule{
+		{Name: "office", Match: Match{SSID: []string{"corp"}}, Action: ActionDisconnect},
+		{Name: "night", Match: Match{Schedule: &Window{From: "23:00", To: "07:00"}}, Action: ActionDisconnect},
+		{Name: "phone", Match: Match{Metered: &metered}, Action: ActionDisconnect},
+		{Name: "home router", Match: Match{GatewayMAC: []string{"aa:bb:cc:dd:ee:ff"}}, Action: ActionConnect, Node: "home"},
+		{Name: "wifi", Match: Match{Type: TypeWifi}, Action: ActionConnect, Node: "jp"},
+	}}
+	tests := []struct {
+		name  string
+		state State
+		now   time.Time
+		want  string
+	}{
+		{"first match wins", State{SSID: "corp", Type: TypeWifi}, at(0, 23, 30), "office"},
+		{"schedule before later rules", State{SSID: "cafe", Type: TypeWifi, Metered: true}, at(0, 23, 30), "night"},
+		{"metered", State{SSID: "cafe", Type: TypeWifi, Metered: true}, at(0, 12, 0), "phone"},
+		{"gateway mac folds case", State{Type: TypeEthernet, GatewayMAC: "AA:BB:CC:DD:EE:FF"}, at(0, 12, 0), "home router"},
+		{"type", State{SSID: "cafe", Type: TypeWifi}, at(0, 12, 0), "wifi"},
+		{"no match", State{Type: TypeEthernet}, at(0, 12, 0), ""},
+		{"empty ssid never matches a list", State{Type: TypeEthernet, SSID: ""}, at(0, 12, 0), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if r := c.Evaluate(tt.state, tt.now); r != nil {
+				got = r.Name
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate(%+v) = %q, want %q", tt.state, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasSchedule(t *testing.T) {
+	c := Config{Rules: []Rule{{Name: "a", Match: Match{SSID: []string{"x"}}}}}
+	if c.HasSchedule() {
+		t.Error("HasSchedule() = true without a schedule")
+	}
+	c.Rules = append(c.Rules, Rule{Name: "b", Match: Match{Schedule: &Window{From: "09:00", To: "17:00"}}})
+	if !c.HasSchedule() {
+		t.Error("HasSchedule() = false with a schedule")
+	}
+}
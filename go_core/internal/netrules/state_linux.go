@@ -0,0 +1,113 @@
+//go:build linux
+
+package netrules
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+
+	"go_core/internal/netmon"
+)
+
+const nmName = "org.freedesktop.NetworkManager"
+
+// Current reads the network state: the default route and the gateway's
+// MAC from the kernel, the connection from NetworkManager's primary
+// connection.
+func Current() State {
+	var s State
+	route, _ := netmon.DefaultRoute()
+	s.Interface = route.Interface
+	if route.Gateway != "" {
+		s.GatewayMAC = arpLookup(route.Gateway, route.Interface)
+	}
+	if err := fromNetworkManager(&s); err == nil {
+		s.NetworkManager = true
+	}
+	return s
+}
+
+func fromNetworkManager(s *State) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return err
+	}
+	nm := conn.Object(nmName, "/org/freedesktop/NetworkManager")
+	var primary dbus.ObjectPath
+	if err := property(nm, nmName+".PrimaryConnection", &primary); err != nil {
+		return err
+	}
+	var metered uint32
+	if err := property(nm, nmName+".Metered", &metered); err == nil {
+		// NM_METERED_YES and NM_METERED_GUESS_YES.
+		s.Metered = metered == 1 || metered == 3
+	}
+	if primary == "/" {
+		return nil
+	}
+	active := conn.Object(nmName, primary)
+	property(active, nmName+".Connection.Active.Id", &s.ConnectionID)
+	var typ string
+	property(active, nmName+".Connection.Active.Type", &typ)
+	s.Type = normalizeType(typ)
+	var devices []dbus.ObjectPath
+	if err := property(active, nmName+".Connection.Active.Devices", &devices); err != nil || len(devices) == 0 {
+		return err
+	}
+	device := conn.Object(nmName, devices[0])
+	if s.Interface == "" {
+		property(device, nmName+".Device.Interface", &s.Interface)
+	}
+	if s.Type == TypeWifi {
+		var ap dbus.ObjectPath
+		if err := property(device, nmName+".Device.Wireless.ActiveAccessPoint", &ap); err == nil && ap != "/" {
+			var ssid []byte
+			if property(conn.Object(nmName, ap), nmName+".AccessPoint.Ssid", &ssid) == nil {
+				s.SSID = string(ssid)
+			}
+		}
+	}
+	return nil
+}
+
+func property(obj dbus.BusObject, name string, v any) error {
+	p, err := obj.GetProperty(name)
+	if err != nil {
+		return err
+	}
+	return p.Store(v)
+}
+
+func normalizeType(nm string) string {
+	switch nm {
+	case "802-11-wireless":
+		return TypeWifi
+	case "802-3-ethernet":
+		return TypeEthernet
+	case "vpn", "wireguard":
+		return TypeVPN
+	}
+	return nm
+}
+
+// arpLookup finds ip's MAC in /proc/net/arp: IP address, HW type, Flags,
+// HW address, Mask, Device.
+func arpLookup(ip, iface string) string {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 6 && fields[0] == ip && fields[5] == iface && fields[3] != "00:00:00:00:00:00" {
+			return strings.ToLower(fields[3])
+		}
+	}
+	return ""
+}
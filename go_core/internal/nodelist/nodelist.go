@@ -0,0 +1,110 @@
+// Package nodelist reads vpn_nodes.json, the node list the Flutter app
+// maintains.
+package nodelist
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Node is an entry of vpn_nodes.json.
+type Node struct {
+	Name        string `json:"name"`
+	CountryCode string `json:"countryCode"`
+	ConfigPath  string `json:"configPath"`
+	ServiceName string `json:"serviceName"`
+	// PlistName is the service field of lists written by older versions.
+	PlistName string `json:"plistName,omitempty"`
+	Enabled   *bool  `json:"enabled,omitempty"`
+}
+
+// Load reads the nodes at path, skipping disabled entries and entries
+// without a service. A missing file is an empty list.
+func Load(path string) ([]Node, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var all []Node
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	nodes := all[:0]
+	for _, n := range all {
+		if n.ServiceName == "" {
+			n.ServiceName = n.PlistName
+		}
+		if n.ServiceName == "" || n.Enabled != nil && !*n.Enabled {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// Upsert returns the list in data with the entry named like n replaced by
+// n, or n appended. Other entries are kept as they are.
+func Upsert(data []byte, n Node) ([]byte, error) {
+	nodes, err := raw(data)
+	if err != nil {
+		return nil, err
+	}
+	entry, _ := json.Marshal(n)
+	replaced := false
+	for i, e := range nodes {
+		if entryName(e) == n.Name {
+			nodes[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		nodes = append(nodes, entry)
+	}
+	return json.MarshalIndent(nodes, "", "  ")
+}
+
+// Remove returns the list in data without the entry named name, and that
+// entry.
+func Remove(data []byte, name string) ([]byte, *Node, error) {
+	nodes, err := raw(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var removed *Node
+	kept := nodes[:0]
+	for _, e := range nodes {
+		if entryName(e) != name {
+			kept = append(kept, e)
+			continue
+		}
+		var n Node
+		json.Unmarshal(e, &n)
+		if n.ServiceName == "" {
+			n.ServiceName = n.PlistName
+		}
+		removed = &n
+	}
+	out, err := json.MarshalIndent(kept, "", "  ")
+	return out, removed, err
+}
+
+// raw splits the list into entries, keeping fields Node does not know.
+func raw(data []byte) ([]json.RawMessage, error) {
+	var nodes []json.RawMessage
+	if len(data) == 0 {
+		return nodes, nil
+	}
+	err := json.Unmarshal(data, &nodes)
+	return nodes, err
+}
+
+func entryName(e json.RawMessage) string {
+	var n struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(e, &n)
+	return n.Name
+}
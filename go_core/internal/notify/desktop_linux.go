@@ -0,0 +1,107 @@
+//go:build linux
+
+package notify
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busName = "org.freedesktop.Notifications"
+	busPath = "/org/freedesktop/Notifications"
+)
+
+// Desktop sends notifications to the freedesktop notification server over
+// the session bus and dispatches its ActionInvoked signals.
+type Desktop struct {
+	mu       sync.Mutex
+	conn     *dbus.Conn
+	handlers map[uint32]func(string)
+	tags     map[string]uint32
+}
+
+// New returns the notifier for this platform.
+func New() Notifier {
+	return &Desktop{}
+}
+
+// connect opens a private connection and starts listening for actions;
+// d.mu is held.
+func (d *Desktop) connect() error {
+	if d.conn != nil && d.conn.Connected() {
+		return nil
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	for _, member := range []string{"ActionInvoked", "NotificationClosed"} {
+		if err := conn.AddMatchSignal(
+			dbus.WithMatchInterface(busName),
+			dbus.WithMatchMember(member),
+			dbus.WithMatchObjectPath(busPath),
+		); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	signals := make(chan *dbus.Signal, 8)
+	conn.Signal(signals)
+	go d.dispatch(signals)
+	d.conn = conn
+	d.handlers = map[uint32]func(string){}
+	d.tags = map[string]uint32{}
+	return nil
+}
+
+func (d *Desktop) dispatch(signals <-chan *dbus.Signal) {
+	for sig := range signals {
+		if len(sig.Body) < 2 {
+			continue
+		}
+		id, _ := sig.Body[0].(uint32)
+		d.mu.Lock()
+		handler := d.handlers[id]
+		// A notification is done once an action is taken or it closes.
+		delete(d.handlers, id)
+		d.mu.Unlock()
+		if key, ok := sig.Body[1].(string); ok && sig.Name == busName+".ActionInvoked" && handler != nil {
+			handler(key)
+		}
+	}
+}
+
+func (d *Desktop) Send(n Notification, onAction func(string)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.connect(); err != nil {
+		return err
+	}
+	actions := []string{"default", ""}
+	for _, a := range n.Actions {
+		actions = append(actions, a.Key, a.Label)
+	}
+	urgency := byte(1)
+	if n.Urgent {
+		urgency = 2
+	}
+	hints := map[string]dbus.Variant{
+		"urgency":       dbus.MakeVariant(urgency),
+		"desktop-entry": dbus.MakeVariant("xstream"),
+	}
+	var id uint32
+	err := d.conn.Object(busName, busPath).Call(busName+".Notify", 0,
+		"XStream", d.tags[n.Tag], "network-vpn", n.Summary, n.Body, actions, hints, int32(-1)).Store(&id)
+	if err != nil {
+		return err
+	}
+	if n.Tag != "" {
+		d.tags[n.Tag] = id
+	}
+	if onAction != nil {
+		d.handlers[id] = onAction
+	}
+	return nil
+}
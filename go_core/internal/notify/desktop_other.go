@@ -0,0 +1,14 @@
+//go:build !linux
+
+package notify
+
+type unsupported struct{}
+
+// New returns the notifier for this platform; only Linux has one so far.
+func New() Notifier {
+	return unsupported{}
+}
+
+func (unsupported) Send(Notification, func(string)) error {
+	return ErrUnsupported
+}
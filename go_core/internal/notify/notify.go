@@ -0,0 +1,115 @@
+// Package notify shows desktop notifications for connection events and
+// failures, with action buttons that call back into the app, and keeps the
+// per-event opt-out.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"go_core/internal/settings"
+)
+
+// Events that can be notified. They are all enabled unless turned off.
+const (
+	NodeConnected        = "node.connected"
+	NodeDisconnected     = "node.disconnected"
+	NodeFailed           = "node.failed"
+	CoreUpdated          = "core.updated"
+	CoreUpdateFailed     = "core.updateFailed"
+	SubscriptionExpiring = "subscription.expiring"
+)
+
+// Events lists the known events in the order settings show them.
+var Events = []string{NodeConnected, NodeDisconnected, NodeFailed, CoreUpdated, CoreUpdateFailed, SubscriptionExpiring}
+
+// ErrUnsupported is returned by Send where there is no notification
+// service.
+var ErrUnsupported = errors.New("notifications not supported")
+
+// Action is a button on a notification. Key is passed back when it is
+// clicked.
+type Action struct {
+	Key   string
+	Label string
+}
+
+// Notification is one message. A notification with the same Tag replaces
+// the previous one instead of stacking, e.g. connected after disconnected.
+type Notification struct {
+	Event   string
+	Tag     string
+	Summary string
+	Body    string
+	Urgent  bool
+	Actions []Action
+}
+
+// Notifier shows notifications. onAction is called with the key of the
+// clicked action, or "default" when the notification itself is clicked.
+type Notifier interface {
+	Send(n Notification, onAction func(key string)) error
+}
+
+// Config is the per-event opt-out.
+type Config struct {
+	Events map[string]bool `json:"events"`
+}
+
+// Enabled reports whether event is notified; events not in the config are.
+func (c Config) Enabled(event string) bool {
+	on, ok := c.Events[event]
+	return !ok || on
+}
+
+// Validate rejects unknown events.
+func (c Config) Validate() error {
+	for name := range c.Events {
+		if !known(name) {
+			return fmt.Errorf("unknown notification event %q", name)
+		}
+	}
+	return nil
+}
+
+// Complete returns c with every known event listed.
+func (c Config) Complete() Config {
+	out := Config{Events: map[string]bool{}}
+	for _, name := range Events {
+		out.Events[name] = c.Enabled(name)
+	}
+	return out
+}
+
+func known(event string) bool {
+	for _, name := range Events {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+const file = "notifications.json"
+
+// Load returns the saved config; without one every event is enabled.
+func Load() (Config, error) {
+	var c Config
+	err := settings.Load(file, &c)
+	if errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// Save validates and persists c.
+func Save(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return settings.Save(file, c, 0644)
+}
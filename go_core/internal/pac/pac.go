@@ -0,0 +1,242 @@
+// Package pac renders the routing rules as a proxy auto-config file and
+// serves it on loopback for tools that only accept a PAC URL.
+package pac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"go_core/internal/routing"
+	"go_core/internal/settings"
+)
+
+// blackhole is a discard endpoint used for rules targeting "block".
+const blackhole = "PROXY 127.0.0.1:9"
+
+// Options controls how rules are rendered.
+type Options struct {
+	// SocksAddr and HTTPAddr are host:port of the xray inbounds. Either may
+	// be empty.
+	SocksAddr string
+	HTTPAddr  string
+	// ExpandSite turns a geosite category into domain lists. Without it,
+	// geosite rules are left out of the PAC file.
+	ExpandSite func(code string) (suffix, full []string, err error)
+}
+
+func (o Options) proxy() string {
+	var parts []string
+	if o.SocksAddr != "" {
+		parts = append(parts, "SOCKS5 "+o.SocksAddr, "SOCKS "+o.SocksAddr)
+	}
+	if o.HTTPAddr != "" {
+		parts = append(parts, "PROXY "+o.HTTPAddr)
+	}
+	if len(parts) == 0 {
+		return "DIRECT"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (o Options) result(t routing.Target) string {
+	switch t {
+	case routing.TargetDirect:
+		return "DIRECT"
+	case routing.TargetBlock:
+		return blackhole
+	}
+	return o.proxy()
+}
+
+// Generate renders c as a PAC script. Rules are checked in the same order
+// xray evaluates them, honouring the domain strategy: with IPIfNonMatch the
+// host is only resolved once no rule matched by name. Anything unmatched
+// goes to the proxy. GeoIP codes other than "private", and process and port
+// rules, have no PAC equivalent and are skipped.
+func Generate(c routing.Config, o Options) string {
+	var tables, byName, byIP strings.Builder
+	for i, r := range routing.Effective(c) {
+		result := jsString(o.result(r.Target))
+		names, nets := condition(r, o, i, &tables)
+		var conds []string
+		if names != "" {
+			conds = append(conds, names)
+		}
+		if nets != "" {
+			switch c.DomainStrategy {
+			case "IPOnDemand":
+				conds = append(conds, fmt.Sprintf("inNets(ip || (ip = dnsResolve(host)), %s)", nets))
+			case "IPIfNonMatch":
+				conds = append(conds, fmt.Sprintf("inNets(ip, %s)", nets))
+				fmt.Fprintf(&byIP, "  if (inNets(ip, %s)) return %s;\n", nets, result)
+			default:
+				conds = append(conds, fmt.Sprintf("inNets(ip, %s)", nets))
+			}
+		}
+		if len(conds) > 0 {
+			fmt.Fprintf(&byName, "  if (%s) return %s;\n", strings.Join(conds, " || "), result)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("// Generated by Xstream from the routing rules. Do not edit.\n")
+	b.WriteString(helpers)
+	b.WriteString(tables.String())
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  host = host.toLowerCase();\n")
+	b.WriteString("  var ip = /^\\d{1,3}(\\.\\d{1,3}){3}$/.test(host) ? host : null;\n")
+	b.WriteString(byName.String())
+	if byIP.Len() > 0 {
+		b.WriteString("  if (!ip) ip = dnsResolve(host);\n")
+		b.WriteString(byIP.String())
+	}
+	fmt.Fprintf(&b, "  return %s;\n", jsString(o.proxy()))
+	b.WriteString("}\n")
+	return b.String()
+}
+
+const helpers = `function suffixIn(host, set) {
+  for (var h = host; ; ) {
+    if (set.hasOwnProperty(h)) return true;
+    var i = h.indexOf(".");
+    if (i < 0) return false;
+    h = h.substring(i + 1);
+  }
+}
+function inNets(ip, nets) {
+  if (!ip) return false;
+  for (var i = 0; i < nets.length; i++) {
+    if (isInNet(ip, nets[i][0], nets[i][1])) return true;
+  }
+  return false;
+}
+`
+
+// condition returns the JS expression matching r by host name and the name
+// of its network table, if any. Lookup tables are written to tables, which
+// end up at the top level of the script.
+func condition(r routing.Rule, o Options, idx int, tables *strings.Builder) (string, string) {
+	var conds []string
+	var suffix, full []string
+	var nets [][2]string
+	for _, v := range r.Values {
+		v = strings.TrimSpace(v)
+		switch r.Type {
+		case routing.TypeDomain:
+			suffix = append(suffix, strings.ToLower(v))
+		case routing.TypeFull:
+			full = append(full, strings.ToLower(v))
+		case routing.TypeRegexp:
+			conds = append(conds, fmt.Sprintf("new RegExp(%s).test(host)", jsString(v)))
+		case routing.TypeGeosite:
+			if o.ExpandSite == nil {
+				continue
+			}
+			s, f, err := o.ExpandSite(v)
+			if err != nil {
+				continue
+			}
+			suffix = append(suffix, s...)
+			full = append(full, f...)
+		case routing.TypeCIDR:
+			if n := ipv4Net(v); n != nil {
+				nets = append(nets, *n)
+			}
+		case routing.TypeGeoIP:
+			if v == "private" {
+				for _, p := range routing.PrivateNets {
+					if n := ipv4Net(p); n != nil {
+						nets = append(nets, *n)
+					}
+				}
+			}
+		}
+	}
+	if len(suffix) > 0 {
+		fmt.Fprintf(tables, "var suffix%d = %s;\n", idx, jsSet(suffix))
+		conds = append(conds, fmt.Sprintf("suffixIn(host, suffix%d)", idx))
+	}
+	if len(full) > 0 {
+		fmt.Fprintf(tables, "var full%d = %s;\n", idx, jsSet(full))
+		conds = append(conds, fmt.Sprintf("full%d.hasOwnProperty(host)", idx))
+	}
+	var netsName string
+	if len(nets) > 0 {
+		data, _ := json.Marshal(nets)
+		netsName = fmt.Sprintf("nets%d", idx)
+		fmt.Fprintf(tables, "var %s = %s;\n", netsName, data)
+	}
+	return strings.Join(conds, " || "), netsName
+}
+
+func ipv4Net(s string) *[2]string {
+	if !strings.Contains(s, "/") {
+		s += "/32"
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil || n.IP.To4() == nil {
+		return nil
+	}
+	return &[2]string{n.IP.String(), net.IP(n.Mask).String()}
+}
+
+func jsSet(items []string) string {
+	sort.Strings(items)
+	var b strings.Builder
+	b.WriteString("{")
+	for i, it := range items {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(jsString(it))
+		b.WriteString(":1")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// Settings is the persisted PAC server configuration.
+type Settings struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+}
+
+// DefaultSettings serves on a fixed loopback port so the URL handed to the
+// system proxy stays valid across restarts.
+func DefaultSettings() Settings {
+	return Settings{Enabled: true, Listen: "127.0.0.1:1089"}
+}
+
+const settingsFile = "pac.json"
+
+// LoadSettings returns the saved settings or DefaultSettings.
+func LoadSettings() (Settings, error) {
+	s := DefaultSettings()
+	err := settings.Load(settingsFile, &s)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	return s, err
+}
+
+// SaveSettings persists s. The listen address must be loopback.
+func SaveSettings(s Settings) error {
+	host, _, err := net.SplitHostPort(s.Listen)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("PAC server must listen on loopback, got %s", host)
+	}
+	return settings.Save(settingsFile, s, 0644)
+}
@@ -0,0 +1,78 @@
+package pac
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server serves one PAC script at /proxy.pac.
+type Server struct {
+	mu      sync.RWMutex
+	script  string
+	srv     *http.Server
+	addr    string
+	updated time.Time
+}
+
+// Start listens on addr, which should be a loopback address. Starting a
+// running server is a no-op.
+func (s *Server) Start(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/proxy.pac", s.serve)
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	s.addr = ln.Addr().String()
+	go s.srv.Serve(ln)
+	return nil
+}
+
+// Stop shuts the server down.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv, s.addr = nil, ""
+	s.mu.Unlock()
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+}
+
+// Set replaces the served script.
+func (s *Server) Set(script string) {
+	s.mu.Lock()
+	s.script, s.updated = script, time.Now()
+	s.mu.Unlock()
+}
+
+// URL returns the PAC URL, or "" when the server is not running.
+func (s *Server) URL() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.addr == "" {
+		return ""
+	}
+	return "http://" + s.addr + "/proxy.pac"
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	script, updated := s.script, s.updated
+	s.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "proxy.pac", updated, strings.NewReader(script))
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package platform
+
+import "syscall"
+
+// alive reports whether a process exists.
+func alive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
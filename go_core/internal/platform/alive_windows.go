@@ -0,0 +1,18 @@
+package platform
+
+import "golang.org/x/sys/windows"
+
+// alive reports whether a process exists and has not exited.
+func alive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if windows.GetExitCodeProcess(h, &code) != nil {
+		return false
+	}
+	const stillActive = 259
+	return code == stillActive
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+// Package appwindow shows and hides the main window through the D-Bus
+// interface the Linux runner exports (linux/my_application.cc). Unlike
+// looking the window up through X11, this works on Wayland.
+package appwindow
+
+import "github.com/godbus/dbus/v5"
+
+// The names must match linux/my_application.cc.
+const (
+	Name  = "com.xstream.Window"
+	Path  = "/com/xstream/Window"
+	Iface = "com.xstream.Window"
+)
+
+// Available reports whether the runner owns its window interface on the
+// session bus.
+func Available() bool {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return false
+	}
+	var has bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, Name).Store(&has)
+	return err == nil && has
+}
+
+// Show shows, deiconifies and raises the window.
+func Show() error { return call("Show") }
+
+// Hide hides the window; the app keeps running in the tray.
+func Hide() error { return call("Hide") }
+
+// Toggle hides a visible window and shows a hidden one.
+func Toggle() error { return call("Toggle") }
+
+// Quit ends the runner's main loop, so the app exits the way it does when
+// its window is closed.
+func Quit() error { return call("Quit") }
+
+// SetBehavior sets what minimizing and closing the window do: "hide",
+// "minimize" or "close".
+func SetBehavior(behavior string) error { return call("SetBehavior", behavior) }
+
+// Visible reports whether the window is shown.
+func Visible() (bool, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return false, err
+	}
+	v, err := conn.Object(Name, Path).GetProperty(Iface + ".Visible")
+	if err != nil {
+		return false, err
+	}
+	visible, _ := v.Value().(bool)
+	return visible, nil
+}
+
+func call(method string, args ...any) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	return conn.Object(Name, Path).Call(Iface+"."+method, 0, args...).Err
+}
@@ -0,0 +1,92 @@
+package platform
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// checkHost verifies that the executable at path is built for this host,
+// so a wrong download never replaces a working core.
+func checkHost(path string) error {
+	got, err := binaryPlatform(path)
+	if err != nil {
+		return fmt.Errorf("downloaded core: %w", err)
+	}
+	if want := runtime.GOOS + "/" + runtime.GOARCH; got != want {
+		return fmt.Errorf("downloaded core is for %s, this system is %s", got, want)
+	}
+	return nil
+}
+
+// binaryPlatform reads the GOOS/GOARCH of an executable from its ELF, PE
+// or Mach-O header.
+func binaryPlatform(path string) (string, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		system := "linux"
+		switch f.OSABI {
+		case elf.ELFOSABI_FREEBSD:
+			system = "freebsd"
+		case elf.ELFOSABI_OPENBSD:
+			system = "openbsd"
+		}
+		return system + "/" + elfArch(f), nil
+	}
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		arch := map[uint16]string{
+			pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+			pe.IMAGE_FILE_MACHINE_I386:  "386",
+			pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+			pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+		}[f.Machine]
+		return "windows/" + arch, nil
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		arch := map[macho.Cpu]string{macho.CpuAmd64: "amd64", macho.CpuArm64: "arm64"}[f.Cpu]
+		return "darwin/" + arch, nil
+	}
+	return "", errors.New("not an executable")
+}
+
+func elfArch(f *elf.File) string {
+	le := f.ByteOrder == binary.LittleEndian
+	is64 := f.Class == elf.ELFCLASS64
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_RISCV:
+		return "riscv64"
+	case elf.EM_LOONGARCH:
+		return "loong64"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_PPC64:
+		if le {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_MIPS:
+		arch := "mips"
+		if is64 {
+			arch = "mips64"
+		}
+		if le {
+			arch += "le"
+		}
+		return arch
+	}
+	return f.Machine.String()
+}
@@ -0,0 +1,92 @@
+package platform
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// elfHeader is the header of an ELF file without sections, enough for
+// binaryPlatform.
+func elfHeader(class elf.Class, order binary.ByteOrder, abi elf.OSABI, machine elf.Machine) []byte {
+	ident := [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(class), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT), byte(abi)}
+	if order == binary.BigEndian {
+		ident[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	}
+	var buf bytes.Buffer
+	if class == elf.ELFCLASS64 {
+		binary.Write(&buf, order, elf.Header64{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Ehsize: 64})
+	} else {
+		binary.Write(&buf, order, elf.Header32{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Ehsize: 52})
+	}
+	return buf.Bytes()
+}
+
+// peHeader is a DOS stub pointing at a PE file header without sections.
+func peHeader(machine uint16) []byte {
+	dos := make([]byte, 0x80)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x80)
+	buf := bytes.NewBuffer(dos)
+	buf.WriteString("PE\x00\x00")
+	binary.Write(buf, binary.LittleEndian, pe.FileHeader{Machine: machine})
+	return buf.Bytes()
+}
+
+// machoHeader is a 64-bit Mach-O header without load commands.
+func machoHeader(cpu macho.Cpu) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec})
+	buf.Write(make([]byte, 4)) // reserved
+	return buf.Bytes()
+}
+
+func TestBinaryPlatform(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"linux amd64", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_NONE, elf.EM_X86_64), "linux/amd64"},
+		{"linux 386", elfHeader(elf.ELFCLASS32, le, elf.ELFOSABI_NONE, elf.EM_386), "linux/386"},
+		{"linux arm64", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_NONE, elf.EM_AARCH64), "linux/arm64"},
+		{"linux arm", elfHeader(elf.ELFCLASS32, le, elf.ELFOSABI_NONE, elf.EM_ARM), "linux/arm"},
+		{"linux riscv64", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_NONE, elf.EM_RISCV), "linux/riscv64"},
+		{"linux mips", elfHeader(elf.ELFCLASS32, be, elf.ELFOSABI_NONE, elf.EM_MIPS), "linux/mips"},
+		{"linux mipsle", elfHeader(elf.ELFCLASS32, le, elf.ELFOSABI_NONE, elf.EM_MIPS), "linux/mipsle"},
+		{"linux mips64le", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_NONE, elf.EM_MIPS), "linux/mips64le"},
+		{"linux ppc64", elfHeader(elf.ELFCLASS64, be, elf.ELFOSABI_NONE, elf.EM_PPC64), "linux/ppc64"},
+		{"linux ppc64le", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_NONE, elf.EM_PPC64), "linux/ppc64le"},
+		{"linux s390x", elfHeader(elf.ELFCLASS64, be, elf.ELFOSABI_NONE, elf.EM_S390), "linux/s390x"},
+		{"gnu abi is linux", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_LINUX, elf.EM_X86_64), "linux/amd64"},
+		{"freebsd", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_FREEBSD, elf.EM_X86_64), "freebsd/amd64"},
+		{"openbsd", elfHeader(elf.ELFCLASS64, le, elf.ELFOSABI_OPENBSD, elf.EM_AARCH64), "openbsd/arm64"},
+		{"unknown machine", elfHeader(elf.ELFCLASS64, be, elf.ELFOSABI_NONE, elf.EM_SPARCV9), "linux/EM_SPARCV9"},
+		{"windows amd64", peHeader(pe.IMAGE_FILE_MACHINE_AMD64), "windows/amd64"},
+		{"windows 386", peHeader(pe.IMAGE_FILE_MACHINE_I386), "windows/386"},
+		{"windows arm64", peHeader(pe.IMAGE_FILE_MACHINE_ARM64), "windows/arm64"},
+		{"windows arm", peHeader(pe.IMAGE_FILE_MACHINE_ARMNT), "windows/arm"},
+		{"darwin arm64", machoHeader(macho.CpuArm64), "darwin/arm64"},
+		{"darwin amd64", machoHeader(macho.CpuAmd64), "darwin/amd64"},
+		{"not an executable", []byte("<html>404 Not Found</html>"), ""},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "xray")
+			if err := os.WriteFile(path, tt.data, 0755); err != nil {
+				t.Fatal(err)
+			}
+			got, err := binaryPlatform(path)
+			if got != tt.want || (err != nil) != (tt.want == "") {
+				t.Errorf("binaryPlatform() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
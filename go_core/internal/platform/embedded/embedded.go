@@ -0,0 +1,94 @@
+// Package embedded implements platform.ServiceManager with xray instances
+// running inside the app process, for iOS where the app may not spawn
+// processes.
+package embedded
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/xtls/xray-core/core"
+
+	"go_core/internal/platform"
+)
+
+// Manager runs one xray instance per service. A service's config is
+// <Dir>/<name>.json.
+type Manager struct {
+	Dir string
+
+	mu      sync.Mutex
+	servers map[string]core.Server
+}
+
+func (*Manager) Name() string { return "embedded" }
+
+// Create is a no-op: configs are written by WriteConfigFiles and there is
+// nothing to register.
+func (*Manager) Create(platform.Service) error { return nil }
+
+func (m *Manager) ConfigPath(name string) (string, error) {
+	return filepath.Join(m.Dir, name+".json"), nil
+}
+
+func (m *Manager) Start(name string) error {
+	path, _ := m.ConfigPath(name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return m.Run(name, data)
+}
+
+// Run starts an instance from config content under name.
+func (m *Manager) Run(name string, config []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.servers[name]; ok {
+		return errors.New("already running")
+	}
+	cfg, err := core.LoadConfig("json", bytes.NewReader(config))
+	if err != nil {
+		return err
+	}
+	srv, err := core.New(cfg)
+	if err != nil {
+		return err
+	}
+	if err := srv.Start(); err != nil {
+		return err
+	}
+	if m.servers == nil {
+		m.servers = map[string]core.Server{}
+	}
+	m.servers[name] = srv
+	return nil
+}
+
+// Stop closes the instance of name. Stopping a service that is not
+// running is not an error.
+func (m *Manager) Stop(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	srv, ok := m.servers[name]
+	if !ok {
+		return nil
+	}
+	if err := srv.Close(); err != nil {
+		return err
+	}
+	delete(m.servers, name)
+	return nil
+}
+
+func (m *Manager) Status(name string) platform.Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.servers[name]; ok {
+		return platform.StatusRunning
+	}
+	return platform.StatusStopped
+}
@@ -0,0 +1,39 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// PlainWriter writes files as the current user.
+type PlainWriter struct {
+	// Perm defaults to 0644.
+	Perm os.FileMode
+}
+
+func (w PlainWriter) WriteFile(path string, data []byte) error {
+	perm := w.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// FallbackWriter writes directly when it can and falls back to Privileged
+// on permission errors, e.g. for generated configs in a root-owned
+// directory the user may or may not have been given access to.
+type FallbackWriter struct {
+	Plain      FileWriter
+	Privileged FileWriter
+}
+
+func (w FallbackWriter) WriteFile(path string, data []byte) error {
+	err := w.Plain.WriteFile(path, data)
+	if err == nil || !os.IsPermission(err) {
+		return err
+	}
+	return w.Privileged.WriteFile(path, data)
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package platform
+
+import "os"
+
+// SudoWriter writes files in root-owned locations through sudo. The data
+// is staged in a private temp file and copied into place, so the content
+// never goes through a shell or shares stdin with the password.
+type SudoWriter struct {
+	// Password is fed to sudo -S. When empty, sudo -n is used and the write
+	// fails instead of prompting.
+	Password string
+	Runner   Runner
+}
+
+func (w SudoWriter) WriteFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp("", "xstream-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	c := Cmd{Name: "sudo", Args: []string{"-n"}}
+	if w.Password != "" {
+		c = Cmd{Name: "sudo", Args: []string{"-S", "-p", ""}, Stdin: w.Password + "\n", Secret: true}
+	}
+	// Redirecting keeps the owner and mode of an existing file.
+	c.Args = append(c.Args, "sh", "-c", `mkdir -p -- "$(dirname -- "$2")" && cat -- "$1" > "$2"`, "sh", tmp.Name(), path)
+	_, err = runner(w.Runner).Run(c)
+	return err
+}
@@ -0,0 +1,164 @@
+package platform
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCore bounds the downloaded archive and the binary extracted from it;
+// release archives are a few tens of MiB.
+const maxCore = 256 << 20
+
+// installClient bounds the download, so a stalled server cannot keep the
+// install busy indefinitely.
+var installClient = &http.Client{Timeout: 5 * time.Minute}
+
+// ZipInstaller downloads a release archive and extracts the xray binary
+// from it.
+type ZipInstaller struct {
+	URL string
+	Dir string
+	// Binary is the file name to extract, e.g. "xray" or "xray.exe".
+	Binary string
+}
+
+func (z ZipInstaller) Path() string {
+	return filepath.Join(z.Dir, z.Binary)
+}
+
+// previous is where Install keeps the binary it replaces.
+func (z ZipInstaller) previous() string {
+	return z.Path() + ".prev"
+}
+
+// Rollback puts back the binary the last Install replaced.
+func (z ZipInstaller) Rollback() error {
+	if _, err := os.Stat(z.previous()); err != nil {
+		return fmt.Errorf("no previous core to roll back to: %w", err)
+	}
+	return os.Rename(z.previous(), z.Path())
+}
+
+func (z ZipInstaller) Install() error {
+	if z.URL == "" {
+		return fmt.Errorf("no xray core release for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	if err := os.MkdirAll(z.Dir, 0755); err != nil {
+		return err
+	}
+	resp, err := installClient.Get(z.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", z.URL, resp.Status)
+	}
+	tmp, err := os.CreateTemp("", "xray-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := copyMax(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%s: %w", z.URL, err)
+	}
+	tmp.Close()
+	zr, err := zip.OpenReader(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if strings.EqualFold(filepath.Base(f.Name), z.Binary) {
+			return extract(f, z.Path(), z.previous())
+		}
+	}
+	return fmt.Errorf("%s not found in %s", z.Binary, z.URL)
+}
+
+// extract writes a zip entry next to dest and renames it into place, so a
+// running binary is never truncated. An existing dest is moved to prev.
+// An entry not built for this host is rejected before that.
+func extract(f *zip.File, dest, prev string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if err := copyMax(out, rc); err != nil {
+		out.Close()
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(out.Name(), 0755); err != nil {
+		return err
+	}
+	if err := checkHost(out.Name()); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		if err := os.Rename(dest, prev); err != nil {
+			return err
+		}
+	}
+	return os.Rename(out.Name(), dest)
+}
+
+// copyMax copies src to dst, failing once more than maxCore bytes come.
+func copyMax(dst io.Writer, src io.Reader) error {
+	n, err := io.Copy(dst, io.LimitReader(src, maxCore+1))
+	if err == nil && n > maxCore {
+		err = fmt.Errorf("larger than %d MiB", maxCore>>20)
+	}
+	return err
+}
+
+// Background runs installs off the calling goroutine, one at a time.
+type Background struct {
+	mu   sync.Mutex
+	busy bool
+}
+
+// Start begins in.Install unless an install is already running, and
+// reports whether it did. done, if set, receives the result.
+func (b *Background) Start(in Installer, done func(error)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.busy {
+		return false
+	}
+	b.busy = true
+	go func() {
+		err := in.Install()
+		b.mu.Lock()
+		b.busy = false
+		b.mu.Unlock()
+		if done != nil {
+			done(err)
+		}
+	}()
+	return true
+}
+
+// Busy reports whether an install is running.
+func (b *Background) Busy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.busy
+}
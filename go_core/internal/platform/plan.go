@@ -0,0 +1,155 @@
+package platform
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Step is one change a Plan recorded instead of applying.
+type Step struct {
+	// Kind is "command", "write", "remove", "service", "install" or "hook".
+	Kind    string `json:"kind"`
+	Command string `json:"command,omitempty"`
+	// Input is what a command is given on stdin, such as an nft script.
+	Input string `json:"input,omitempty"`
+	Path  string `json:"path,omitempty"`
+	// Diff is a unified diff against the file on disk; new files diff
+	// against nothing.
+	Diff    string `json:"diff,omitempty"`
+	Service string `json:"service,omitempty"`
+	// Op is the service or hook operation, e.g. "start".
+	Op   string `json:"op,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// Plan records commands, file writes and service operations for a dry
+// run. Its Runner, Writer, Services and Installer wrappers never change
+// the system; reads are passed through so the plan reflects it.
+type Plan struct {
+	mu      sync.Mutex
+	started time.Time
+	steps   []Step
+}
+
+func NewPlan() *Plan {
+	return &Plan{started: time.Now()}
+}
+
+// Record appends a step.
+func (p *Plan) Record(s Step) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, s)
+}
+
+// Steps returns the recorded steps in order.
+func (p *Plan) Steps() []Step {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Step{}, p.steps...)
+}
+
+// Started is when the plan began recording.
+func (p *Plan) Started() time.Time {
+	return p.started
+}
+
+// Runner records commands and reports them as succeeded with no output.
+// Queries are run.
+func (p *Plan) Runner() Runner {
+	return planRunner{p}
+}
+
+type planRunner struct{ p *Plan }
+
+func (r planRunner) Run(c Cmd) (string, error) {
+	if c.Query {
+		return ExecRunner{}.Run(c)
+	}
+	step := Step{Kind: "command", Command: c.String()}
+	if !c.Secret {
+		step.Input = c.Stdin
+	}
+	r.p.Record(step)
+	return "", nil
+}
+
+// Writer records writes with a diff against the current file.
+func (p *Plan) Writer() FileWriter {
+	return planWriter{p}
+}
+
+type planWriter struct{ p *Plan }
+
+func (w planWriter) WriteFile(path string, data []byte) error {
+	old, _ := os.ReadFile(path)
+	w.p.Record(Step{Kind: "write", Path: path, Diff: Diff(path, old, data)})
+	return nil
+}
+
+// System records commands, writes and removals; queries are run.
+func (p *Plan) System() System {
+	return planSystem{planRunner{p}}
+}
+
+type planSystem struct{ planRunner }
+
+func (s planSystem) Start(c Cmd) (int, error) {
+	_, err := s.Run(c)
+	return 0, err
+}
+
+func (s planSystem) WriteFile(path string, data []byte, _ os.FileMode) error {
+	return planWriter{s.p}.WriteFile(path, data)
+}
+
+func (s planSystem) Remove(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		s.p.Record(Step{Kind: "remove", Path: path})
+	}
+	return nil
+}
+
+// Services records Create, Start and Stop; Status and ConfigPath are
+// answered by m.
+func (p *Plan) Services(m ServiceManager) ServiceManager {
+	return planServices{p, m}
+}
+
+type planServices struct {
+	p *Plan
+	ServiceManager
+}
+
+func (s planServices) Create(svc Service) error {
+	s.p.Record(Step{Kind: "service", Op: "create", Service: svc.Name, Command: svc.Exec + " run -c " + svc.Config})
+	return nil
+}
+
+func (s planServices) Start(name string) error {
+	s.p.Record(Step{Kind: "service", Op: "start", Service: name})
+	return nil
+}
+
+func (s planServices) Stop(name string) error {
+	s.p.Record(Step{Kind: "service", Op: "stop", Service: name})
+	return nil
+}
+
+// Installer records an install to in's path.
+func (p *Plan) Installer(in Installer) Installer {
+	return planInstaller{p, in}
+}
+
+type planInstaller struct {
+	p  *Plan
+	in Installer
+}
+
+func (i planInstaller) Path() string { return i.in.Path() }
+
+func (i planInstaller) Install() error {
+	i.p.Record(Step{Kind: "install", Path: i.in.Path()})
+	return nil
+}
@@ -0,0 +1,20 @@
+package platform
+
+import "testing"
+
+func TestPlanRunnerKeepsSecretsOut(t *testing.T) {
+	p := NewPlan()
+	r := p.Runner()
+	r.Run(Cmd{Name: "nft", Args: []string{"-f", "-"}, Stdin: "table inet t\n"})
+	r.Run(Cmd{Name: "sudo", Args: []string{"-S", "-p", "", "rm", "-f", "--", "/opt/bin/xray"}, Stdin: "hunter2\n", Secret: true})
+	steps := p.Steps()
+	if len(steps) != 2 {
+		t.Fatalf("steps = %+v", steps)
+	}
+	if steps[0].Input != "table inet t\n" {
+		t.Errorf("input = %q, want the script", steps[0].Input)
+	}
+	if steps[1].Input != "" || steps[1].Command != "sudo -S -p  rm -f -- /opt/bin/xray" {
+		t.Errorf("secret step = %+v", steps[1])
+	}
+}
@@ -0,0 +1,168 @@
+// Package platform defines the seams between the node logic and the
+// operating system: how node services are run, how the xray core is
+// installed, how files are written and how the tray is shown. Each has a
+// small interface with one backend per mechanism, so the bridge picks
+// backends per platform and the logic above them can be driven with fakes.
+package platform
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Status is the state of a node service. The values match CheckNodeStatus.
+type Status int
+
+const (
+	StatusUnknown Status = -1
+	StatusStopped Status = 0
+	StatusRunning Status = 1
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusRunning:
+		return "running"
+	case StatusStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// Service describes a node service: the xray binary and the config it
+// runs with. Assets, when set, is where xray finds its geo data instead of
+// next to the binary.
+type Service struct {
+	Name   string `json:"name"`
+	Exec   string `json:"exec"`
+	Config string `json:"config"`
+	Assets string `json:"assets,omitempty"`
+}
+
+// assetEnv is the variable xray reads Service.Assets from.
+const assetEnv = "XRAY_LOCATION_ASSET"
+
+// ServiceManager runs node services.
+type ServiceManager interface {
+	// Name identifies the backend, e.g. "systemd".
+	Name() string
+	// Create registers a service. Existing services are left alone.
+	Create(s Service) error
+	Start(name string) error
+	Stop(name string) error
+	Status(name string) Status
+	// ConfigPath returns the xray config a service runs with.
+	ConfigPath(name string) (string, error)
+}
+
+// Installer puts the xray core in place.
+type Installer interface {
+	// Path is where the xray binary is installed.
+	Path() string
+	Install() error
+}
+
+// FileWriter writes generated files, creating parent directories.
+type FileWriter interface {
+	WriteFile(path string, data []byte) error
+}
+
+// MenuItem is an entry of the tray menu.
+type MenuItem struct {
+	Title     string
+	Tooltip   string
+	Checkable bool
+	Checked   bool
+	Disabled  bool
+	Click     func()
+	// Items makes the entry a submenu.
+	Items []MenuItem
+}
+
+// Tray shows the status icon and its menu.
+type Tray interface {
+	// Run shows the icon and blocks until Quit. onReady runs once the icon
+	// is up, onExit when it goes away.
+	Run(onReady, onExit func())
+	SetIcon(icon []byte)
+	SetTooltip(text string)
+	// SetMenu replaces the menu. It may be called before Run.
+	SetMenu(items []MenuItem)
+	Quit()
+}
+
+// PIDer is implemented by service managers that can tell the main process
+// of a running service.
+type PIDer interface {
+	MainPID(name string) (int, error)
+}
+
+// Restarter is implemented by service managers that can restart the
+// running services matching a glob pattern.
+type Restarter interface {
+	TryRestart(pattern string) error
+}
+
+// LogEntry is a line a service logged.
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// LogReader is implemented by service managers that keep the output of
+// services. Logs returns up to lines of the latest entries after cursor
+// (all when empty), and the cursor to pass to get only later ones.
+type LogReader interface {
+	Logs(name string, lines int, cursor string) ([]LogEntry, string, error)
+}
+
+// Cmd is an external command run by a backend.
+type Cmd struct {
+	Name  string
+	Args  []string
+	Stdin string
+	// Query marks a command that only reads state, which a Plan runs
+	// rather than records.
+	Query bool
+	// Secret marks Stdin as a password, which a Plan leaves out.
+	Secret bool
+}
+
+func (c Cmd) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Runner runs commands and returns their combined output. Errors carry the
+// output, or the exit status when there is none.
+type Runner interface {
+	Run(c Cmd) (string, error)
+}
+
+// ExecRunner runs commands with os/exec.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(c Cmd) (string, error) {
+	cmd := exec.Command(c.Name, c.Args...)
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return string(out), fmt.Errorf("%s: %s: %w", c.Name, msg, err)
+		}
+		return "", fmt.Errorf("%s: %w", c.Name, err)
+	}
+	return string(out), nil
+}
+
+// runner returns r, or ExecRunner when r is nil, so backends work as zero
+// values.
+func runner(r Runner) Runner {
+	if r == nil {
+		return ExecRunner{}
+	}
+	return r
+}
@@ -0,0 +1,301 @@
+package platform
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Process runs node services as child processes, for systems without a
+// usable service manager. Definitions are kept in services.json under
+// State, and a started service has <name>.pid and <name>.log there. A
+// supervisor restarts a service that exits on its own; services left
+// running by an earlier session are taken over by Start or Adopt.
+type Process struct {
+	State string
+	// Units, when set, is a directory of systemd unit files. A service
+	// that was not created is defined by the ExecStart of its unit, so the
+	// units the app generates run without systemd.
+	Units string
+}
+
+func (Process) Name() string { return "process" }
+
+// processMu guards the state files and supervisors, which are keyed by
+// pidfile.
+var (
+	processMu   sync.Mutex
+	supervisors = map[string]*supervisor{}
+)
+
+func (p Process) definitions() (map[string]Service, error) {
+	defs := map[string]Service{}
+	data, err := os.ReadFile(filepath.Join(p.State, "services.json"))
+	if os.IsNotExist(err) {
+		return defs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return defs, json.Unmarshal(data, &defs)
+}
+
+func (p Process) lookup(name string) (Service, error) {
+	defs, err := p.definitions()
+	if err != nil {
+		return Service{}, err
+	}
+	if svc, ok := defs[name]; ok {
+		return svc, nil
+	}
+	if p.Units != "" {
+		if svc, err := unitService(filepath.Join(p.Units, name)); err == nil {
+			svc.Name = name
+			return svc, nil
+		}
+	}
+	return Service{}, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+}
+
+// unitService reads the binary and config from a unit's ExecStart line,
+// and the asset directory from its Environment.
+func unitService(path string) (Service, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Service{}, err
+	}
+	defer f.Close()
+	var svc Service
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if env, ok := strings.CutPrefix(line, "Environment="); ok {
+			if assets, ok := strings.CutPrefix(strings.Trim(env, `"`), assetEnv+"="); ok {
+				svc.Assets = assets
+			}
+		}
+		cmdline, ok := strings.CutPrefix(line, "ExecStart=")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(cmdline)
+		for i, f := range fields {
+			if (f == "-c" || f == "-config") && i+1 < len(fields) && i > 0 {
+				svc.Exec, svc.Config = fields[0], fields[i+1]
+			}
+		}
+	}
+	if svc.Exec == "" {
+		return Service{}, fmt.Errorf("%s: no xray command in ExecStart", path)
+	}
+	return svc, nil
+}
+
+func (p Process) Create(svc Service) error {
+	processMu.Lock()
+	defer processMu.Unlock()
+	defs, err := p.definitions()
+	if err != nil {
+		return err
+	}
+	if _, ok := defs[svc.Name]; ok {
+		return nil
+	}
+	defs[svc.Name] = svc
+	data, err := json.MarshalIndent(defs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return PlainWriter{Perm: 0600}.WriteFile(filepath.Join(p.State, "services.json"), data)
+}
+
+func (p Process) ConfigPath(name string) (string, error) {
+	svc, err := p.lookup(name)
+	return svc.Config, err
+}
+
+func (p Process) pidFile(name string) string {
+	return filepath.Join(p.State, name+".pid")
+}
+
+func (p Process) logFile(name string) string {
+	return filepath.Join(p.State, name+".log")
+}
+
+func (p Process) pid(name string) int {
+	data, err := os.ReadFile(p.pidFile(name))
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// runningPID is the pid of the service's process, when it runs.
+func (p Process) runningPID(svc Service) int {
+	if pid := p.pid(svc.Name); pid > 0 && alive(pid) && runs(pid, svc) {
+		return pid
+	}
+	return 0
+}
+
+// Start spawns the service under a supervisor, or supervises the process
+// already running it.
+func (p Process) Start(name string) error {
+	processMu.Lock()
+	defer processMu.Unlock()
+	if _, ok := supervisors[p.pidFile(name)]; ok {
+		return nil
+	}
+	svc, err := p.lookup(name)
+	if err != nil {
+		return err
+	}
+	pid := p.runningPID(svc)
+	var exited <-chan struct{}
+	if pid == 0 {
+		if pid, exited, err = p.spawn(svc); err != nil {
+			return err
+		}
+	}
+	p.supervise(svc, pid, exited)
+	return nil
+}
+
+// Adopt supervises services whose process outlived the session that
+// started it, so they are restarted again when they exit.
+func (p Process) Adopt() {
+	pidFiles, _ := filepath.Glob(filepath.Join(p.State, "*.pid"))
+	processMu.Lock()
+	defer processMu.Unlock()
+	for _, f := range pidFiles {
+		if _, ok := supervisors[f]; ok {
+			continue
+		}
+		svc, err := p.lookup(strings.TrimSuffix(filepath.Base(f), ".pid"))
+		if err != nil {
+			continue
+		}
+		if pid := p.runningPID(svc); pid > 0 {
+			p.supervise(svc, pid, nil)
+		}
+	}
+}
+
+// spawn starts the service detached from the app, so it survives it, with
+// its output appended to the log. exited is closed when it exits.
+func (p Process) spawn(svc Service) (int, <-chan struct{}, error) {
+	log, err := openLog(p.logFile(svc.Name))
+	if err != nil {
+		return 0, nil, err
+	}
+	cmd := exec.Command(svc.Exec, "run", "-c", svc.Config)
+	if svc.Assets != "" {
+		cmd.Env = append(os.Environ(), assetEnv+"="+svc.Assets)
+	}
+	cmd.Stdout = log
+	cmd.Stderr = log
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return 0, nil, err
+	}
+	log.Close()
+	pid := cmd.Process.Pid
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	if err := os.WriteFile(p.pidFile(svc.Name), []byte(strconv.Itoa(pid)), 0600); err != nil {
+		cmd.Process.Kill()
+		return 0, nil, err
+	}
+	return pid, exited, nil
+}
+
+// Stop ends the service. A process started by another session, such as
+// xstreamctl's, is ended through its pidfile; removing the pidfile first
+// tells that session's supervisor not to restart it.
+func (p Process) Stop(name string) error {
+	processMu.Lock()
+	s := supervisors[p.pidFile(name)]
+	delete(supervisors, p.pidFile(name))
+	pid := p.pid(name)
+	os.Remove(p.pidFile(name))
+	processMu.Unlock()
+	if s != nil {
+		s.halt()
+		return nil
+	}
+	if pid <= 0 || !alive(pid) {
+		return nil
+	}
+	return terminate(pid, nil)
+}
+
+// Status is running while the service runs or its supervisor is waiting
+// to restart it.
+func (p Process) Status(name string) Status {
+	processMu.Lock()
+	_, supervised := supervisors[p.pidFile(name)]
+	processMu.Unlock()
+	if supervised {
+		return StatusRunning
+	}
+	svc, err := p.lookup(name)
+	if err != nil {
+		return StatusUnknown
+	}
+	if p.runningPID(svc) > 0 {
+		return StatusRunning
+	}
+	return StatusStopped
+}
+
+func (p Process) MainPID(name string) (int, error) {
+	if pid := p.pid(name); pid > 0 && alive(pid) {
+		return pid, nil
+	}
+	return 0, fmt.Errorf("%s: not running", name)
+}
+
+// TryRestart restarts the running services matching the glob pattern.
+func (p Process) TryRestart(pattern string) error {
+	pidFiles, _ := filepath.Glob(filepath.Join(p.State, "*.pid"))
+	var errs []string
+	for _, f := range pidFiles {
+		name := strings.TrimSuffix(filepath.Base(f), ".pid")
+		if ok, _ := filepath.Match(pattern, name); !ok || p.Status(name) != StatusRunning {
+			continue
+		}
+		if err := p.Stop(name); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if err := p.Start(name); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("restart: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Logs reads the service's log file. The cursor is a byte offset into it;
+// one past the end, after the log rotated, reads from the start.
+func (p Process) Logs(name string, lines int, cursor string) ([]LogEntry, string, error) {
+	return readLog(p.logFile(name), lines, cursor)
+}
+
+// waitTimeout bounds how long Stop waits for xray to exit before killing
+// it.
+const waitTimeout = 5 * time.Second
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package platform
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// detach starts cmd in its own session, so it outlives the app and does
+// not get the terminal's signals.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+func signalStop(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// runs reports whether pid runs svc's config, guarding against a pidfile
+// whose pid was reused. Without procfs it is trusted.
+func runs(pid int, svc Service) bool {
+	cmdline, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return os.IsNotExist(err) && !exists("/proc/self")
+	}
+	return bytes.Contains(cmdline, []byte(svc.Config))
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
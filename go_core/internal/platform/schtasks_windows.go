@@ -0,0 +1,127 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Schtasks runs node services as scheduled tasks named
+// "ray-node-<code>.schtasks". All tasks run Dir\xray.exe with Dir\config.json;
+// starting a node copies its xray-vpn-node-<code>.json there first.
+type Schtasks struct {
+	Dir    string
+	Runner Runner
+}
+
+func (Schtasks) Name() string { return "schtasks" }
+
+func (s Schtasks) run(args ...string) (string, error) {
+	return runner(s.Runner).Run(Cmd{Name: "schtasks", Args: args})
+}
+
+func (s Schtasks) exists(name string) bool {
+	_, err := s.run("/Query", "/TN", name)
+	return err == nil
+}
+
+func (s Schtasks) Create(svc Service) error {
+	if s.exists(svc.Name) {
+		return nil
+	}
+	taskCmd := fmt.Sprintf("\"%s\" run -c \"%s\"", svc.Exec, svc.Config)
+	_, err := s.run("/Create", "/TN", svc.Name, "/SC", "ONSTART", "/RL", "HIGHEST", "/TR", taskCmd, "/F")
+	return err
+}
+
+// ConfigPath returns the node's own config, not the shared config.json.
+func (s Schtasks) ConfigPath(name string) (string, error) {
+	base := strings.TrimSuffix(name, ".schtasks")
+	parts := strings.Split(base, "-")
+	return filepath.Join(s.Dir, fmt.Sprintf("xray-vpn-node-%s.json", parts[len(parts)-1])), nil
+}
+
+func (s Schtasks) Start(name string) error {
+	node, _ := s.ConfigPath(name)
+	shared := filepath.Join(s.Dir, "config.json")
+	input, err := os.ReadFile(node)
+	if err != nil {
+		return fmt.Errorf("read %s failed: %w", node, err)
+	}
+	if err := os.WriteFile(shared, input, 0644); err != nil {
+		return fmt.Errorf("write config.json failed: %w", err)
+	}
+	if err := s.Create(Service{Name: name, Exec: filepath.Join(s.Dir, "xray.exe"), Config: shared}); err != nil {
+		return err
+	}
+	_, err = s.run("/Run", "/TN", name)
+	return err
+}
+
+// Stop ends and deletes the task and kills any xray.exe left behind. It
+// does its best and does not fail.
+func (s Schtasks) Stop(name string) error {
+	s.run("/End", "/TN", name)
+	s.run("/Delete", "/TN", name, "/F")
+	runner(s.Runner).Run(Cmd{Name: "taskkill", Args: []string{"/F", "/IM", "xray.exe"}})
+	return nil
+}
+
+func (s Schtasks) Status(name string) Status {
+	out, err := s.run("/Query", "/TN", name)
+	if err != nil {
+		return StatusUnknown
+	}
+	str := strings.ToLower(out)
+	// "正在运行" on Chinese Windows.
+	if strings.Contains(str, "running") || strings.Contains(str, "\xe6\xad\xa3\xe5\x9c\xa8\xe8\xbf\x90\xe8\xa1\x8c") {
+		return StatusRunning
+	}
+	return StatusStopped
+}
+
+// Running lists the tasks named prefix* that are running.
+func (s Schtasks) Running(prefix string) []string {
+	out, err := s.run("/Query", "/FO", "CSV", "/NH")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\",\"")
+		if len(fields) < 3 {
+			continue
+		}
+		name := strings.TrimPrefix(strings.Trim(fields[0], "\"\r"), "\\")
+		status := strings.ToLower(strings.Trim(fields[2], "\"\r"))
+		if strings.HasPrefix(name, prefix) && strings.Contains(status, "running") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// MainPID returns the pid of xray.exe. All tasks run the same binary and
+// only one runs at a time.
+func (s Schtasks) MainPID(name string) (int, error) {
+	out, err := runner(s.Runner).Run(Cmd{Name: "tasklist", Args: []string{"/FI", "IMAGENAME eq xray.exe", "/FO", "CSV", "/NH"}})
+	if err != nil {
+		return 0, err
+	}
+	// "xray.exe","4312","Services","0","12,345 K"
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\",\"")
+		if len(fields) > 1 && strings.EqualFold(strings.Trim(fields[0], "\""), "xray.exe") {
+			return strconv.Atoi(fields[1])
+		}
+	}
+	return 0, fmt.Errorf("%s: not running", name)
+}
+
+// Restart ends and reruns a task.
+func (s Schtasks) Restart(name string) {
+	s.run("/End", "/TN", name)
+	s.run("/Run", "/TN", name)
+}
@@ -0,0 +1,518 @@
+//go:build linux
+
+// Package sni implements platform.Tray as a StatusNotifierItem with a
+// com.canonical.dbusmenu menu. Unlike the XEmbed tray it works on Wayland:
+// the panel draws the icon and menu from what the item exports on the
+// session bus.
+package sni
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"go_core/internal/platform"
+)
+
+const (
+	itemPath    = "/StatusNotifierItem"
+	itemIface   = "org.kde.StatusNotifierItem"
+	menuPath    = "/MenuBar"
+	menuIface   = "com.canonical.dbusmenu"
+	watcherName = "org.kde.StatusNotifierWatcher"
+	watcherPath = "/StatusNotifierWatcher"
+)
+
+// Available reports whether a StatusNotifierWatcher runs on the session
+// bus, i.e. whether a panel would show the item.
+func Available() bool {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return false
+	}
+	var has bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, watcherName).Store(&has)
+	return err == nil && has
+}
+
+// Tray is a StatusNotifierItem. Icon, tooltip and menu set before Run are
+// exported once it runs.
+type Tray struct {
+	activate func()
+	fallback func() platform.Tray
+
+	mu       sync.Mutex
+	conn     *dbus.Conn
+	name     string
+	props    *prop.Properties
+	icon     []pixmap
+	tooltip  string
+	root     *entry
+	byID     map[int32]*entry
+	revision uint32
+	quit     chan struct{}
+	quitOnce sync.Once
+	// rawIcon and items are kept to hand over to alt.
+	rawIcon []byte
+	items   []platform.MenuItem
+	// alt is the fallback tray once the item could not be exported.
+	alt platform.Tray
+}
+
+// New returns a tray that calls activate when the icon itself is clicked;
+// panels that only open the menu never call it. When the item cannot be
+// exported, Run hands over to the tray fallback returns.
+func New(activate func(), fallback func() platform.Tray) *Tray {
+	t := &Tray{activate: activate, fallback: fallback, quit: make(chan struct{})}
+	t.build(nil)
+	return t
+}
+
+// pixmap is one size of an icon, ARGB32 in network byte order.
+type pixmap struct {
+	Width, Height int32
+	Data          []byte
+}
+
+type tooltip struct {
+	IconName string
+	Icon     []pixmap
+	Title    string
+	Text     string
+}
+
+// Run exports the item and blocks until Quit. If the item cannot be
+// exported, the fallback tray runs in its place with the same icon,
+// tooltip and menu; onExit is only called once a tray that came up goes
+// away.
+func (t *Tray) Run(onReady, onExit func()) {
+	if err := t.start(); err != nil {
+		fmt.Println("StatusNotifierItem failed:", err)
+		if alt := t.handOver(); alt != nil {
+			alt.Run(onReady, onExit)
+		}
+		return
+	}
+	if onReady != nil {
+		onReady()
+	}
+	<-t.quit
+	t.conn.Close()
+	if onExit != nil {
+		onExit()
+	}
+}
+
+// handOver creates the fallback tray and gives it the current state. It
+// returns nil when there is no fallback or Quit came first.
+func (t *Tray) handOver() platform.Tray {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.quit:
+		return nil
+	default:
+	}
+	if t.fallback == nil {
+		return nil
+	}
+	t.alt = t.fallback()
+	if t.rawIcon != nil {
+		t.alt.SetIcon(t.rawIcon)
+	}
+	if t.tooltip != "" {
+		t.alt.SetTooltip(t.tooltip)
+	}
+	t.alt.SetMenu(t.items)
+	return t.alt
+}
+
+func (t *Tray) start() error {
+	// A private connection, so Quit can close it without affecting other
+	// users of the shared one.
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conn = conn
+	t.name = fmt.Sprintf("org.kde.StatusNotifierItem-%d-1", os.Getpid())
+	if _, err := conn.RequestName(t.name, dbus.NameFlagDoNotQueue); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := t.export(); err != nil {
+		conn.Close()
+		return err
+	}
+	// Register now and again whenever the watcher restarts, e.g. with the
+	// panel.
+	conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg(0, watcherName),
+	)
+	signals := make(chan *dbus.Signal, 4)
+	conn.Signal(signals)
+	go func() {
+		for sig := range signals {
+			if len(sig.Body) == 3 && sig.Body[2] != "" {
+				t.register()
+			}
+		}
+	}()
+	if err := t.register(); err != nil {
+		fmt.Println("Register StatusNotifierItem failed:", err)
+	}
+	return nil
+}
+
+// export publishes the item and menu objects; t.mu is held.
+func (t *Tray) export() error {
+	conn := t.conn
+	if err := conn.Export((*item)(t), itemPath, itemIface); err != nil {
+		return err
+	}
+	if err := conn.Export((*menu)(t), menuPath, menuIface); err != nil {
+		return err
+	}
+	if err := conn.Export(introspect.Introspectable(itemIntrospection), itemPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return err
+	}
+	if err := conn.Export(introspect.Introspectable(menuIntrospection), menuPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return err
+	}
+	props, err := prop.Export(conn, itemPath, prop.Map{itemIface: {
+		"Category":            {Value: "ApplicationStatus"},
+		"Id":                  {Value: "xstream"},
+		"Title":               {Value: "XStream"},
+		"Status":              {Value: "Active"},
+		"WindowId":            {Value: int32(0)},
+		"IconName":            {Value: ""},
+		"IconPixmap":          {Value: t.icon, Emit: prop.EmitFalse},
+		"OverlayIconName":     {Value: ""},
+		"OverlayIconPixmap":   {Value: []pixmap{}},
+		"AttentionIconName":   {Value: ""},
+		"AttentionIconPixmap": {Value: []pixmap{}},
+		"AttentionMovieName":  {Value: ""},
+		"ToolTip":             {Value: t.tooltipValue(), Emit: prop.EmitFalse},
+		"ItemIsMenu":          {Value: false},
+		"Menu":                {Value: dbus.ObjectPath(menuPath)},
+	}})
+	if err != nil {
+		return err
+	}
+	t.props = props
+	_, err = prop.Export(conn, menuPath, prop.Map{menuIface: {
+		"Version":       {Value: uint32(3)},
+		"TextDirection": {Value: "ltr"},
+		"Status":        {Value: "normal"},
+		"IconThemePath": {Value: []string{}},
+	}})
+	return err
+}
+
+func (t *Tray) register() error {
+	return t.conn.Object(watcherName, watcherPath).Call(watcherName+".RegisterStatusNotifierItem", 0, t.name).Err
+}
+
+func (t *Tray) tooltipValue() tooltip {
+	return tooltip{Icon: []pixmap{}, Title: t.tooltip}
+}
+
+func (t *Tray) SetIcon(icon []byte) {
+	if alt := t.fallbackTray(); alt != nil {
+		alt.SetIcon(icon)
+		return
+	}
+	px, err := decodeIcon(icon)
+	if err != nil {
+		fmt.Println("Decode tray icon failed:", err)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.icon = px
+	t.rawIcon = icon
+	if t.props != nil {
+		t.props.SetMust(itemIface, "IconPixmap", px)
+		t.conn.Emit(itemPath, itemIface+".NewIcon")
+	}
+}
+
+func (t *Tray) SetTooltip(text string) {
+	if alt := t.fallbackTray(); alt != nil {
+		alt.SetTooltip(text)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if text == t.tooltip {
+		return
+	}
+	t.tooltip = text
+	if t.props != nil {
+		t.props.SetMust(itemIface, "ToolTip", t.tooltipValue())
+		t.conn.Emit(itemPath, itemIface+".NewToolTip")
+	}
+}
+
+func (t *Tray) SetMenu(items []platform.MenuItem) {
+	if alt := t.fallbackTray(); alt != nil {
+		alt.SetMenu(items)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.items = items
+	t.build(items)
+	t.revision++
+	if t.conn != nil {
+		t.conn.Emit(menuPath, menuIface+".LayoutUpdated", t.revision, int32(0))
+	}
+}
+
+func (t *Tray) Quit() {
+	t.quitOnce.Do(func() { close(t.quit) })
+	if alt := t.fallbackTray(); alt != nil {
+		alt.Quit()
+	}
+}
+
+// fallbackTray is the tray Run handed over to, if any. The calls are
+// made without t.mu, since the fallback may call back into the app.
+func (t *Tray) fallbackTray() platform.Tray {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.alt
+}
+
+// decodeIcon converts a PNG to the pixmap the item exports.
+func decodeIcon(data []byte) ([]pixmap, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	px := make([]byte, 0, b.Dx()*b.Dy()*4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			px = append(px, c.A, c.R, c.G, c.B)
+		}
+	}
+	return []pixmap{{Width: int32(b.Dx()), Height: int32(b.Dy()), Data: px}}, nil
+}
+
+// entry is a menu item with the id the host refers to it by. The root has
+// id 0; the others are numbered depth first on every SetMenu, so an
+// unchanged menu keeps its ids.
+type entry struct {
+	id       int32
+	props    map[string]dbus.Variant
+	click    func()
+	children []*entry
+}
+
+// layout is the dbusmenu (ia{sv}av) structure.
+type layout struct {
+	ID       int32
+	Props    map[string]dbus.Variant
+	Children []dbus.Variant
+}
+
+func (e *entry) layout(depth int32) layout {
+	l := layout{ID: e.id, Props: e.props, Children: []dbus.Variant{}}
+	if depth != 0 {
+		for _, c := range e.children {
+			l.Children = append(l.Children, dbus.MakeVariant(c.layout(depth-1)))
+		}
+	}
+	return l
+}
+
+// build replaces the menu tree; t.mu is held.
+func (t *Tray) build(items []platform.MenuItem) {
+	t.byID = map[int32]*entry{}
+	next := int32(0)
+	var add func(props map[string]dbus.Variant, click func(), items []platform.MenuItem) *entry
+	add = func(props map[string]dbus.Variant, click func(), items []platform.MenuItem) *entry {
+		e := &entry{id: next, props: props, click: click}
+		t.byID[e.id] = e
+		next++
+		for _, it := range items {
+			e.children = append(e.children, add(itemProps(it), it.Click, it.Items))
+		}
+		return e
+	}
+	t.root = add(map[string]dbus.Variant{"children-display": dbus.MakeVariant("submenu")}, nil, items)
+}
+
+func itemProps(it platform.MenuItem) map[string]dbus.Variant {
+	p := map[string]dbus.Variant{
+		// Underscores mark mnemonics in dbusmenu labels.
+		"label":   dbus.MakeVariant(strings.ReplaceAll(it.Title, "_", "__")),
+		"enabled": dbus.MakeVariant(!it.Disabled),
+	}
+	if it.Checkable {
+		state := int32(0)
+		if it.Checked {
+			state = 1
+		}
+		p["toggle-type"] = dbus.MakeVariant("checkmark")
+		p["toggle-state"] = dbus.MakeVariant(state)
+	}
+	if len(it.Items) > 0 {
+		p["children-display"] = dbus.MakeVariant("submenu")
+	}
+	return p
+}
+
+// item holds the org.kde.StatusNotifierItem methods.
+type item Tray
+
+func (i *item) Activate(x, y int32) *dbus.Error {
+	if i.activate != nil {
+		go i.activate()
+	}
+	return nil
+}
+
+func (i *item) SecondaryActivate(x, y int32) *dbus.Error { return nil }
+
+func (i *item) ContextMenu(x, y int32) *dbus.Error { return nil }
+
+func (i *item) Scroll(delta int32, orientation string) *dbus.Error { return nil }
+
+// menu holds the com.canonical.dbusmenu methods.
+type menu Tray
+
+func (m *menu) GetLayout(parentID, depth int32, names []string) (uint32, layout, *dbus.Error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.byID[parentID]
+	if !ok {
+		return 0, layout{}, dbus.MakeFailedError(fmt.Errorf("no menu item %d", parentID))
+	}
+	return m.revision, e.layout(depth), nil
+}
+
+type itemProperties struct {
+	ID    int32
+	Props map[string]dbus.Variant
+}
+
+func (m *menu) GetGroupProperties(ids []int32, names []string) ([]itemProperties, *dbus.Error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []itemProperties{}
+	for _, id := range ids {
+		if e, ok := m.byID[id]; ok {
+			out = append(out, itemProperties{ID: id, Props: e.props})
+		}
+	}
+	return out, nil
+}
+
+func (m *menu) GetProperty(id int32, name string) (dbus.Variant, *dbus.Error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.byID[id]; ok {
+		if v, ok := e.props[name]; ok {
+			return v, nil
+		}
+	}
+	return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("no property %s on menu item %d", name, id))
+}
+
+func (m *menu) Event(id int32, eventID string, data dbus.Variant, timestamp uint32) *dbus.Error {
+	if eventID != "clicked" {
+		return nil
+	}
+	m.mu.Lock()
+	var click func()
+	if e, ok := m.byID[id]; ok {
+		click = e.click
+	}
+	m.mu.Unlock()
+	if click != nil {
+		go click()
+	}
+	return nil
+}
+
+type menuEvent struct {
+	ID        int32
+	EventID   string
+	Data      dbus.Variant
+	Timestamp uint32
+}
+
+func (m *menu) EventGroup(events []menuEvent) ([]int32, *dbus.Error) {
+	for _, ev := range events {
+		m.Event(ev.ID, ev.EventID, ev.Data, ev.Timestamp)
+	}
+	return []int32{}, nil
+}
+
+// AboutToShow reports that the menu needs no update; it is rebuilt when
+// the state changes, not when it opens.
+func (m *menu) AboutToShow(id int32) (bool, *dbus.Error) { return false, nil }
+
+func (m *menu) AboutToShowGroup(ids []int32) ([]int32, []int32, *dbus.Error) {
+	return []int32{}, []int32{}, nil
+}
+
+const itemIntrospection = `<node>
+  <interface name="org.kde.StatusNotifierItem">
+    <method name="Activate"><arg name="x" type="i" direction="in"/><arg name="y" type="i" direction="in"/></method>
+    <method name="SecondaryActivate"><arg name="x" type="i" direction="in"/><arg name="y" type="i" direction="in"/></method>
+    <method name="ContextMenu"><arg name="x" type="i" direction="in"/><arg name="y" type="i" direction="in"/></method>
+    <method name="Scroll"><arg name="delta" type="i" direction="in"/><arg name="orientation" type="s" direction="in"/></method>
+    <signal name="NewIcon"/>
+    <signal name="NewToolTip"/>
+    <property name="Category" type="s" access="read"/>
+    <property name="Id" type="s" access="read"/>
+    <property name="Title" type="s" access="read"/>
+    <property name="Status" type="s" access="read"/>
+    <property name="WindowId" type="i" access="read"/>
+    <property name="IconName" type="s" access="read"/>
+    <property name="IconPixmap" type="a(iiay)" access="read"/>
+    <property name="OverlayIconName" type="s" access="read"/>
+    <property name="OverlayIconPixmap" type="a(iiay)" access="read"/>
+    <property name="AttentionIconName" type="s" access="read"/>
+    <property name="AttentionIconPixmap" type="a(iiay)" access="read"/>
+    <property name="AttentionMovieName" type="s" access="read"/>
+    <property name="ToolTip" type="(sa(iiay)ss)" access="read"/>
+    <property name="ItemIsMenu" type="b" access="read"/>
+    <property name="Menu" type="o" access="read"/>
+  </interface>
+` + introspect.IntrospectDataString + `</node>`
+
+const menuIntrospection = `<node>
+  <interface name="com.canonical.dbusmenu">
+    <method name="GetLayout"><arg name="parentId" type="i" direction="in"/><arg name="recursionDepth" type="i" direction="in"/><arg name="propertyNames" type="as" direction="in"/><arg name="revision" type="u" direction="out"/><arg name="layout" type="(ia{sv}av)" direction="out"/></method>
+    <method name="GetGroupProperties"><arg name="ids" type="ai" direction="in"/><arg name="propertyNames" type="as" direction="in"/><arg name="properties" type="a(ia{sv})" direction="out"/></method>
+    <method name="GetProperty"><arg name="id" type="i" direction="in"/><arg name="name" type="s" direction="in"/><arg name="value" type="v" direction="out"/></method>
+    <method name="Event"><arg name="id" type="i" direction="in"/><arg name="eventId" type="s" direction="in"/><arg name="data" type="v" direction="in"/><arg name="timestamp" type="u" direction="in"/></method>
+    <method name="EventGroup"><arg name="events" type="a(isvu)" direction="in"/><arg name="idErrors" type="ai" direction="out"/></method>
+    <method name="AboutToShow"><arg name="id" type="i" direction="in"/><arg name="needUpdate" type="b" direction="out"/></method>
+    <method name="AboutToShowGroup"><arg name="ids" type="ai" direction="in"/><arg name="updatesNeeded" type="ai" direction="out"/><arg name="idErrors" type="ai" direction="out"/></method>
+    <signal name="ItemsPropertiesUpdated"><arg type="a(ia{sv})" direction="out"/><arg type="a(ias)" direction="out"/></signal>
+    <signal name="LayoutUpdated"><arg type="u" direction="out"/><arg type="i" direction="out"/></signal>
+    <property name="Version" type="u" access="read"/>
+    <property name="TextDirection" type="s" access="read"/>
+    <property name="Status" type="s" access="read"/>
+    <property name="IconThemePath" type="as" access="read"/>
+  </interface>
+` + introspect.IntrospectDataString + `</node>`
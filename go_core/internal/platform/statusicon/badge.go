@@ -0,0 +1,43 @@
+package statusicon
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// Badge returns icon with a dot of colour c in the bottom right corner, for
+// state icons derived from the app logo. When icon cannot be decoded the
+// dot alone is returned.
+func Badge(icon []byte, c color.Color) []byte {
+	var dst *image.NRGBA
+	if src, err := png.Decode(bytes.NewReader(icon)); err == nil {
+		dst = image.NewNRGBA(src.Bounds())
+		draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	} else {
+		dst = image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	}
+	b := dst.Bounds()
+	r := b.Dx() / 5
+	if r < 3 {
+		r = 3
+	}
+	cx, cy := b.Max.X-r-1, b.Max.Y-r-1
+	ring := color.NRGBA{255, 255, 255, 255}
+	for y := cy - r - 1; y <= cy+r+1; y++ {
+		for x := cx - r - 1; x <= cx+r+1; x++ {
+			d := (x-cx)*(x-cx) + (y-cy)*(y-cy)
+			switch {
+			case d <= r*r:
+				dst.Set(x, y, c)
+			case d <= (r+1)*(r+1):
+				dst.Set(x, y, ring)
+			}
+		}
+	}
+	var out bytes.Buffer
+	png.Encode(&out, dst)
+	return out.Bytes()
+}
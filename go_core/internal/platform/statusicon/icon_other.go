@@ -0,0 +1,5 @@
+//go:build !windows
+
+package statusicon
+
+func iconBytes(png []byte) []byte { return png }
@@ -0,0 +1,31 @@
+package statusicon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+)
+
+// iconBytes wraps a PNG in an ICO container, which is what the Windows
+// tray loads. PNG-compressed ICO entries are supported since Vista.
+func iconBytes(data []byte) []byte {
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data
+	}
+	size := func(n int) uint8 {
+		if n >= 256 {
+			return 0 // 0 means 256
+		}
+		return uint8(n)
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, [3]uint16{0, 1, 1}) // reserved, type icon, one image
+	binary.Write(&b, binary.LittleEndian, struct {
+		Width, Height, Colors, Reserved uint8
+		Planes, BitCount                uint16
+		Size, Offset                    uint32
+	}{size(cfg.Width), size(cfg.Height), 0, 0, 1, 32, uint32(len(data)), 6 + 16})
+	b.Write(data)
+	return b.Bytes()
+}
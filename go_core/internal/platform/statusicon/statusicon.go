@@ -0,0 +1,161 @@
+// Package statusicon implements platform.Tray with getlantern/systray: the
+// notification area on Windows, AppIndicator or XEmbed on Linux.
+package statusicon
+
+import (
+	"sync"
+
+	"github.com/getlantern/systray"
+
+	"go_core/internal/platform"
+)
+
+// Tray keeps the systray entries it created. systray cannot remove or
+// reorder entries, so SetMenu reuses them in place, hides the ones left
+// over and appends new ones.
+type Tray struct {
+	mu      sync.Mutex
+	ready   bool
+	icon    []byte
+	tooltip string
+	menu    []platform.MenuItem
+	slots   []*slot
+}
+
+// slot is a systray entry and what it currently stands for.
+type slot struct {
+	item      *systray.MenuItem
+	checkable bool
+	submenu   bool
+	click     func()
+	children  []*slot
+}
+
+func New() *Tray {
+	return &Tray{}
+}
+
+func (t *Tray) Run(onReady, onExit func()) {
+	systray.Run(func() {
+		t.mu.Lock()
+		t.ready = true
+		if t.icon != nil {
+			systray.SetIcon(iconBytes(t.icon))
+		}
+		if t.tooltip != "" {
+			systray.SetTooltip(t.tooltip)
+		}
+		t.slots = t.apply(nil, t.slots, t.menu)
+		t.mu.Unlock()
+		if onReady != nil {
+			onReady()
+		}
+	}, onExit)
+}
+
+func (t *Tray) SetIcon(icon []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.icon = icon
+	if t.ready {
+		systray.SetIcon(iconBytes(icon))
+	}
+}
+
+func (t *Tray) SetTooltip(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tooltip = text
+	if t.ready {
+		systray.SetTooltip(text)
+	}
+}
+
+func (t *Tray) SetMenu(items []platform.MenuItem) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.menu = items
+	if t.ready {
+		t.slots = t.apply(nil, t.slots, items)
+	}
+}
+
+func (t *Tray) Quit() {
+	systray.Quit()
+}
+
+// apply lays items over slots, the entries under parent (nil for the top
+// level), and returns the slots in use. A slot whose kind does not match
+// the item is hidden and a new entry is appended instead.
+func (t *Tray) apply(parent *systray.MenuItem, slots []*slot, items []platform.MenuItem) []*slot {
+	existing := len(slots)
+	used := make([]bool, existing)
+	next := 0
+	for _, it := range items {
+		var s *slot
+		for next < existing && s == nil {
+			if slots[next].checkable == it.Checkable && slots[next].submenu == (len(it.Items) > 0) {
+				s = slots[next]
+				used[next] = true
+			}
+			next++
+		}
+		if s == nil {
+			s = t.add(parent, it)
+			slots = append(slots, s)
+			used = append(used, true)
+		}
+		s.item.SetTitle(it.Title)
+		s.item.SetTooltip(it.Tooltip)
+		if it.Checked {
+			s.item.Check()
+		} else {
+			s.item.Uncheck()
+		}
+		if it.Disabled {
+			s.item.Disable()
+		} else {
+			s.item.Enable()
+		}
+		s.click = it.Click
+		if len(it.Items) > 0 {
+			s.children = t.apply(s.item, s.children, it.Items)
+		}
+		s.item.Show()
+	}
+	for i, s := range slots {
+		if !used[i] {
+			s.item.Hide()
+			s.click = nil
+		}
+	}
+	return slots
+}
+
+func (t *Tray) add(parent *systray.MenuItem, it platform.MenuItem) *slot {
+	var item *systray.MenuItem
+	switch {
+	case parent == nil && it.Checkable:
+		item = systray.AddMenuItemCheckbox(it.Title, it.Tooltip, it.Checked)
+	case parent == nil:
+		item = systray.AddMenuItem(it.Title, it.Tooltip)
+	case it.Checkable:
+		item = parent.AddSubMenuItemCheckbox(it.Title, it.Tooltip, it.Checked)
+	default:
+		item = parent.AddSubMenuItem(it.Title, it.Tooltip)
+	}
+	s := &slot{item: item, checkable: it.Checkable, submenu: len(it.Items) > 0}
+	go t.listen(s)
+	return s
+}
+
+func (t *Tray) listen(s *slot) {
+	for range s.item.ClickedCh {
+		t.mu.Lock()
+		click := s.click
+		t.mu.Unlock()
+		if click != nil {
+			click()
+		}
+	}
+}
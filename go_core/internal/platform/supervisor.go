@@ -0,0 +1,255 @@
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Restarts back off from minBackoff, doubling up to maxBackoff. A run
+	// of stableAfter resets the backoff; crashLoop short runs in a row
+	// stop the restarts.
+	minBackoff  = time.Second
+	maxBackoff  = time.Minute
+	stableAfter = time.Minute
+	crashLoop   = 5
+
+	// A log over maxLog is rotated to .1, keeping keepLogs old ones.
+	maxLog   = 4 << 20
+	keepLogs = 2
+)
+
+// supervisor restarts one service of a Process when it exits on its own.
+type supervisor struct {
+	p    Process
+	svc  Service
+	stop chan struct{}
+	done chan struct{}
+}
+
+// supervise watches pid, whose exit closes exited; nil for a process this
+// session did not start. processMu is held.
+func (p Process) supervise(svc Service, pid int, exited <-chan struct{}) {
+	s := &supervisor{p: p, svc: svc, stop: make(chan struct{}), done: make(chan struct{})}
+	supervisors[p.pidFile(svc.Name)] = s
+	go s.run(pid, exited)
+}
+
+// halt stops the service and waits for the supervisor to finish.
+func (s *supervisor) halt() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *supervisor) run(pid int, exited <-chan struct{}) {
+	defer close(s.done)
+	pidFile, logFile := s.p.pidFile(s.svc.Name), s.p.logFile(s.svc.Name)
+	backoff := minBackoff
+	short := 0
+	// owned is the pid the pidfile names: the last process started, even
+	// when a restart since failed and pid is 0.
+	owned := pid
+	for {
+		started := time.Now()
+		if exited == nil {
+			exited = watch(pid)
+		}
+		if !s.wait(pid, exited) {
+			return
+		}
+
+		processMu.Lock()
+		// A missing or different pidfile means another session stopped
+		// or restarted the service.
+		if supervisors[pidFile] != s || s.p.pid(s.svc.Name) != owned {
+			if supervisors[pidFile] == s {
+				delete(supervisors, pidFile)
+			}
+			processMu.Unlock()
+			return
+		}
+		if time.Since(started) >= stableAfter {
+			backoff, short = minBackoff, 0
+		}
+		short++
+		if short >= crashLoop {
+			appendLog(logFile, "%s exited %d times in a row, not restarting", s.svc.Name, short)
+			delete(supervisors, pidFile)
+			os.Remove(pidFile)
+			processMu.Unlock()
+			return
+		}
+		processMu.Unlock()
+
+		if pid > 0 {
+			appendLog(logFile, "%s exited, restarting in %s", s.svc.Name, backoff)
+		} else {
+			appendLog(logFile, "retrying %s in %s", s.svc.Name, backoff)
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+
+		processMu.Lock()
+		if supervisors[pidFile] != s {
+			processMu.Unlock()
+			return
+		}
+		var err error
+		pid, exited, err = s.p.spawn(s.svc)
+		processMu.Unlock()
+		if err != nil {
+			// Counted as a short run: retried with the backoff until
+			// crashLoop failures in a row.
+			appendLog(logFile, "restart %s failed: %v", s.svc.Name, err)
+			closed := make(chan struct{})
+			close(closed)
+			pid, exited = 0, closed
+			continue
+		}
+		owned = pid
+	}
+}
+
+// wait returns true when the process exits and false when the supervisor
+// is stopped, after ending the process. It rotates the log meanwhile.
+func (s *supervisor) wait(pid int, exited <-chan struct{}) bool {
+	rotate := time.NewTicker(30 * time.Second)
+	defer rotate.Stop()
+	for {
+		select {
+		case <-s.stop:
+			if pid > 0 {
+				if err := terminate(pid, exited); err != nil {
+					fmt.Println("Stop", s.svc.Name, "failed:", err)
+				}
+			}
+			return false
+		case <-exited:
+			return true
+		case <-rotate.C:
+			rotateLog(s.p.logFile(s.svc.Name))
+		}
+	}
+}
+
+// watch polls pid, for processes that are not children of this one.
+func watch(pid int) <-chan struct{} {
+	exited := make(chan struct{})
+	go func() {
+		for alive(pid) {
+			time.Sleep(time.Second)
+		}
+		close(exited)
+	}()
+	return exited
+}
+
+// terminate asks pid to exit and kills it when it has not after
+// waitTimeout.
+func terminate(pid int, exited <-chan struct{}) error {
+	if exited == nil {
+		exited = watch(pid)
+	}
+	if err := signalStop(pid); err != nil {
+		return err
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(waitTimeout):
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Kill()
+}
+
+// openLog opens a service log for appending, rotating it first when it is
+// too large.
+func openLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	rotateLog(path)
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+}
+
+// rotateLog copies a log over maxLog to .1 and truncates it. xray keeps
+// writing to the same file, at its new end since it appends.
+func rotateLog(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() <= maxLog {
+		return
+	}
+	for i := keepLogs; i > 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i-1), fmt.Sprintf("%s.%d", path, i))
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = os.WriteFile(path+".1", data, 0600)
+	}
+	if err == nil {
+		err = os.Truncate(path, 0)
+	}
+	if err != nil {
+		fmt.Println("Rotate", path, "failed:", err)
+	}
+}
+
+// logTime is the timestamp layout xray starts its log lines with.
+const logTime = "2006/01/02 15:04:05"
+
+// appendLog adds a supervisor line to a service log, in xray's format.
+func appendLog(path, format string, args ...any) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s [Supervisor] %s\n", time.Now().Format(logTime), fmt.Sprintf(format, args...))
+}
+
+// readLog returns up to lines of the complete lines after the byte offset
+// cursor, and the offset after them.
+func readLog(path string, lines int, cursor string) ([]LogEntry, string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []LogEntry{}, cursor, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	off, _ := strconv.Atoi(cursor)
+	if off < 0 || off > len(data) {
+		off = 0
+	}
+	end := off + bytes.LastIndexByte(data[off:], '\n') + 1
+	text := strings.Split(strings.TrimSuffix(string(data[off:end]), "\n"), "\n")
+	if end == off {
+		text = nil
+	}
+	if lines > 0 && len(text) > lines {
+		text = text[len(text)-lines:]
+	}
+	entries := []LogEntry{}
+	for _, line := range text {
+		e := LogEntry{Message: line}
+		if len(line) > len(logTime) {
+			if t, err := time.ParseInLocation(logTime, line[:len(logTime)], time.Local); err == nil {
+				e.Time, e.Message = t, strings.TrimLeft(line[len(logTime):], "0123456789. ")
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, strconv.Itoa(end), nil
+}
@@ -0,0 +1,75 @@
+package platform
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// System applies the changes a subsystem such as the kill switch makes to
+// the machine: commands and file writes. Subsystems read the machine
+// directly and mark commands that only read as Cmd.Query, so they see the
+// real state while a Plan's System records the changes.
+type System interface {
+	Runner
+	// Start runs a command without waiting for it and returns its pid, or
+	// 0 when the command was only recorded.
+	Start(c Cmd) (int, error)
+	// WriteFile replaces path, creating parent directories.
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	// Remove deletes path; a missing file is not an error.
+	Remove(path string) error
+}
+
+// Live is the System that applies changes.
+type Live struct{}
+
+func (Live) Run(c Cmd) (string, error) {
+	return ExecRunner{}.Run(c)
+}
+
+func (Live) Start(c Cmd) (int, error) {
+	cmd := exec.Command(c.Name, c.Args...)
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	go cmd.Wait()
+	return cmd.Process.Pid, nil
+}
+
+// WriteFile writes a temporary file next to path and renames it into
+// place, so readers never see a partial file.
+func (Live) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (Live) Remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Systemd runs node services as systemd user units.
+type Systemd struct {
+	Runner Runner
+	// Files writes the unit files Create generates.
+	Files FileWriter
+}
+
+func (Systemd) Name() string { return "systemd" }
+
+// SystemdAvailable reports whether the system booted with systemd and the
+// user's manager runs, which containers, WSL without systemd and other
+// init systems lack.
+func SystemdAvailable() bool {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return false
+	}
+	rt := os.Getenv("XDG_RUNTIME_DIR")
+	if rt == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(rt, "systemd"))
+	return err == nil
+}
+
+func (s Systemd) systemctl(args ...string) (string, error) {
+	return runner(s.Runner).Run(Cmd{Name: "systemctl", Args: append([]string{"--user"}, args...)})
+}
+
+// Create writes a simple unit for s under ~/.config/systemd/user. The app
+// normally ships its own unit through WriteConfigFiles; this is for
+// services defined without one.
+func (s Systemd) Create(svc Service) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(home, ".config", "systemd", "user", svc.Name)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	var env string
+	if svc.Assets != "" {
+		env = fmt.Sprintf("Environment=%s=%s\n", assetEnv, svc.Assets)
+	}
+	unit := fmt.Sprintf("[Unit]\nDescription=Xstream %s\nAfter=network-online.target\n\n"+
+		"[Service]\n%sExecStart=%s run -c %s\nRestart=on-failure\n\n"+
+		"[Install]\nWantedBy=default.target\n", svc.Name, env, svc.Exec, svc.Config)
+	files := s.Files
+	if files == nil {
+		files = PlainWriter{}
+	}
+	if err := files.WriteFile(path, []byte(unit)); err != nil {
+		return err
+	}
+	_, err = s.systemctl("daemon-reload")
+	return err
+}
+
+func (s Systemd) Start(name string) error {
+	_, err := s.systemctl("start", name)
+	return err
+}
+
+func (s Systemd) Stop(name string) error {
+	_, err := s.systemctl("stop", name)
+	return err
+}
+
+func (s Systemd) Status(name string) Status {
+	out, err := s.systemctl("is-active", name)
+	if err != nil {
+		// is-active exits non-zero for inactive units too; only a unit
+		// systemd does not know is unknown.
+		if strings.TrimSpace(out) == "inactive" || strings.TrimSpace(out) == "failed" {
+			return StatusStopped
+		}
+		return StatusUnknown
+	}
+	return StatusRunning
+}
+
+// ConfigPath returns the xray config passed via -c in the unit's ExecStart
+// line.
+func (s Systemd) ConfigPath(name string) (string, error) {
+	out, err := s.systemctl("show", "-p", "ExecStart", "--value", name)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	for i, f := range fields {
+		if (f == "-c" || f == "-config") && i+1 < len(fields) {
+			return strings.TrimSuffix(fields[i+1], ";"), nil
+		}
+	}
+	return "", fmt.Errorf("%s: no config in ExecStart", name)
+}
+
+// Cgroup returns the cgroup v2 path of a running unit.
+func (s Systemd) Cgroup(name string) string {
+	out, err := s.systemctl("show", "-p", "ControlGroup", "--value", name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// TryRestart restarts the units matching pattern that are running.
+func (s Systemd) TryRestart(pattern string) error {
+	_, err := s.systemctl("try-restart", pattern)
+	return err
+}
+
+func (s Systemd) MainPID(name string) (int, error) {
+	out, err := s.systemctl("show", "-p", "MainPID", "--value", name)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(out))
+	if err == nil && pid == 0 {
+		err = fmt.Errorf("%s: not running", name)
+	}
+	return pid, err
+}
+
+// Logs reads the unit's journal.
+func (s Systemd) Logs(name string, lines int, cursor string) ([]LogEntry, string, error) {
+	args := []string{"--user", "-u", name, "-o", "json", "-q", "--no-pager", "-n", strconv.Itoa(lines)}
+	if cursor != "" {
+		args = append(args, "--after-cursor", cursor)
+	}
+	out, err := runner(s.Runner).Run(Cmd{Name: "journalctl", Args: args})
+	if err != nil {
+		return nil, "", err
+	}
+	entries := []LogEntry{}
+	for _, line := range strings.Split(out, "\n") {
+		var e struct {
+			Cursor   string          `json:"__CURSOR"`
+			Realtime string          `json:"__REALTIME_TIMESTAMP"`
+			Message  json.RawMessage `json:"MESSAGE"`
+		}
+		if json.Unmarshal([]byte(line), &e) != nil {
+			continue
+		}
+		usec, _ := strconv.ParseInt(e.Realtime, 10, 64)
+		entries = append(entries, LogEntry{Time: time.UnixMicro(usec), Message: journalMessage(e.Message)})
+		cursor = e.Cursor
+	}
+	return entries, cursor, nil
+}
+
+// journalMessage decodes MESSAGE, which the journal gives as a byte array
+// when it is not valid UTF-8.
+func journalMessage(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var b []byte
+	var ints []int
+	if json.Unmarshal(raw, &ints) == nil {
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,53 @@
+//go:build windows
+
+package ports
+
+import (
+	"encoding/csv"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// listeners maps every locally bound port of proto to its holder, using
+// netstat for the owning PID and tasklist for the image name.
+func listeners(proto string) (map[int]Holder, error) {
+	out, err := exec.Command("netstat", "-ano", "-p", proto).Output()
+	if err != nil {
+		return nil, err
+	}
+	names := map[int]string{}
+	held := map[int]Holder{}
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 4 || !strings.EqualFold(f[0], proto) {
+			continue
+		}
+		if proto == "tcp" && (len(f) < 5 || f[3] != "LISTENING") {
+			continue
+		}
+		local := f[1]
+		port, err := strconv.Atoi(local[strings.LastIndex(local, ":")+1:])
+		if err != nil {
+			continue
+		}
+		pid, _ := strconv.Atoi(f[len(f)-1])
+		if _, ok := names[pid]; !ok {
+			names[pid] = imageName(pid)
+		}
+		held[port] = Holder{PID: pid, Name: names[pid]}
+	}
+	return held, nil
+}
+
+func imageName(pid int) string {
+	out, err := exec.Command("tasklist", "/FI", "PID eq "+strconv.Itoa(pid), "/FO", "CSV", "/NH").Output()
+	if err != nil {
+		return ""
+	}
+	rec, err := csv.NewReader(strings.NewReader(string(out))).Read()
+	if err != nil || len(rec) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(rec[0], ".exe")
+}
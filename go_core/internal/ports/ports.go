@@ -0,0 +1,242 @@
+// Package ports finds out who holds the ports a node wants to listen on
+// and hands out free ones, keeping a registry so several nodes started by
+// Xstream never pick the same port.
+package ports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"go_core/internal/settings"
+)
+
+// Holder is the process bound to a port.
+type Holder struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+	// Node is set when the port is claimed by another Xstream node.
+	Node string `json:"node,omitempty"`
+}
+
+func (h Holder) String() string {
+	name := h.Name
+	if h.Node != "" {
+		name = h.Node
+	}
+	if name == "" {
+		name = "unknown process"
+	}
+	if h.PID > 0 {
+		return fmt.Sprintf("%s (pid %d)", name, h.PID)
+	}
+	return name
+}
+
+// Conflict reports one port that is not available.
+type Conflict struct {
+	Proto  string `json:"proto"`
+	Port   int    `json:"port"`
+	Holder Holder `json:"holder"`
+}
+
+func (c Conflict) Error() string {
+	return fmt.Sprintf("port %d held by %s", c.Port, c.Holder)
+}
+
+// Want is a port a node intends to listen on.
+type Want struct {
+	Proto string // "tcp" or "udp"
+	Port  int
+}
+
+// Check returns a Conflict for every wanted port that is bound by another
+// process or claimed by another node, at most one per port. pid is the
+// node's own running process, 0 when it is not running; ports it holds are
+// not conflicts, nor are the node's own claims while nothing else is bound.
+func Check(node string, pid int, want []Want) []Conflict {
+	held := map[Want]Holder{}
+	for _, proto := range []string{"tcp", "udp"} {
+		ls, err := listeners(proto)
+		if err != nil {
+			continue
+		}
+		for port, h := range ls {
+			held[Want{proto, port}] = h
+		}
+	}
+	claims := loadClaims()
+	var out []Conflict
+	reported := map[int]bool{}
+	for _, w := range want {
+		if reported[w.Port] {
+			continue
+		}
+		h, bound := held[w]
+		var owner string
+		for other, ports := range claims {
+			if contains(ports, w.Port) {
+				owner = other
+				break
+			}
+		}
+		if bound && heldBy(h, pid, owner == node) || !bound && (owner == "" || owner == node) {
+			continue
+		}
+		if owner != node {
+			h.Node = owner
+		}
+		out = append(out, Conflict{w.Proto, w.Port, h})
+		reported[w.Port] = true
+	}
+	return out
+}
+
+// heldBy reports whether a bound port belongs to the node's process pid.
+// Sockets of other users carry no PID; those are taken as the node's when
+// it runs and has claimed the port.
+func heldBy(h Holder, pid int, claimed bool) bool {
+	if pid <= 0 {
+		return false
+	}
+	if h.PID > 0 {
+		return h.PID == pid
+	}
+	return claimed
+}
+
+// Free returns a port above from that is neither bound nor claimed and
+// not listed in skip. It binds the port briefly on each of the listen
+// addresses to be sure; an empty address is the wildcard xray defaults to.
+func Free(from int, listen []string, skip []int) (int, error) {
+	claimed := map[int]bool{}
+	for _, ports := range loadClaims() {
+		for _, p := range ports {
+			claimed[p] = true
+		}
+	}
+	for _, p := range skip {
+		claimed[p] = true
+	}
+	for p := from + 1; p <= 65535; p++ {
+		if claimed[p] {
+			continue
+		}
+		if available(p, listen) {
+			return p, nil
+		}
+	}
+	return 0, errors.New("no free port")
+}
+
+func available(port int, listen []string) bool {
+	if len(listen) == 0 {
+		listen = []string{""}
+	}
+	for _, host := range listen {
+		if host == "" {
+			host = "0.0.0.0"
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return false
+		}
+		l.Close()
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		pc.Close()
+	}
+	return true
+}
+
+var mu sync.Mutex
+
+func registryPath() string {
+	return settings.Path("ports.json")
+}
+
+func loadClaims() map[string][]int {
+	claims := map[string][]int{}
+	if data, err := os.ReadFile(registryPath()); err == nil {
+		json.Unmarshal(data, &claims)
+	}
+	return claims
+}
+
+func saveClaims(claims map[string][]int) error {
+	data, err := json.MarshalIndent(claims, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(registryPath()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(registryPath(), data, 0644)
+}
+
+// Claim records the ports of a running node.
+func Claim(node string, ports []int) error {
+	mu.Lock()
+	defer mu.Unlock()
+	claims := loadClaims()
+	sorted := append([]int(nil), ports...)
+	sort.Ints(sorted)
+	claims[node] = sorted
+	return saveClaims(claims)
+}
+
+// Release drops the claims of node.
+func Release(node string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	claims := loadClaims()
+	if _, ok := claims[node]; !ok {
+		return nil
+	}
+	delete(claims, node)
+	return saveClaims(claims)
+}
+
+// Prune drops claims of nodes that are no longer running, such as those
+// left behind by a crash.
+func Prune(active func(node string) bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+	claims := loadClaims()
+	changed := false
+	for node := range claims {
+		if !active(node) {
+			delete(claims, node)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveClaims(claims)
+}
+
+// Claims returns the registry: node name to claimed ports.
+func Claims() map[string][]int {
+	mu.Lock()
+	defer mu.Unlock()
+	return loadClaims()
+}
+
+func contains(ports []int, p int) bool {
+	for _, q := range ports {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+//go:build linux
+
+package ports
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Socket states in /proc/net/{tcp,udp}.
+const (
+	stateListen = "0A"
+	stateUnconn = "07"
+)
+
+// listeners maps every locally bound port of proto to its holder. The
+// owning process is found by matching socket inodes against /proc/<pid>/fd;
+// sockets of other users are reported without a PID unless we are root.
+func listeners(proto string) (map[int]Holder, error) {
+	inodes := map[string]int{}
+	for _, file := range []string{proto, proto + "6"} {
+		if err := readSockets("/proc/net/"+file, proto, inodes); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	out := make(map[int]Holder, len(inodes))
+	for _, port := range inodes {
+		out[port] = Holder{}
+	}
+	if len(inodes) == 0 {
+		return out, nil
+	}
+	procs, _ := filepath.Glob("/proc/[0-9]*/fd")
+	for _, fdDir := range procs {
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		pidDir := filepath.Dir(fdDir)
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			port, ok := inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")]
+			if !ok || out[port].PID != 0 {
+				continue
+			}
+			pid, _ := strconv.Atoi(filepath.Base(pidDir))
+			comm, _ := os.ReadFile(filepath.Join(pidDir, "comm"))
+			out[port] = Holder{PID: pid, Name: strings.TrimSpace(string(comm))}
+		}
+	}
+	return out, nil
+}
+
+// readSockets adds the inode and local port of every bound socket in a
+// /proc/net table to inodes.
+func readSockets(path, proto string, inodes map[string]int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		state := fields[3]
+		if proto == "tcp" && state != stateListen || proto == "udp" && state != stateUnconn {
+			continue
+		}
+		_, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(portHex, 16, 16)
+		if err != nil {
+			continue
+		}
+		inodes[fields[9]] = int(port)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"strings"
+
+	"go_core/internal/xrayconf"
+)
+
+// FieldRule is one entry of xray's routing.rules.
+type FieldRule struct {
+	Type        string   `json:"type"`
+	Domain      []string `json:"domain,omitempty"`
+	IP          []string `json:"ip,omitempty"`
+	Port        string   `json:"port,omitempty"`
+	Process     []string `json:"process,omitempty"`
+	OutboundTag string   `json:"outboundTag"`
+}
+
+// Compile turns c into xray field rules, one per enabled rule, in
+// evaluation order.
+func Compile(c Config) []FieldRule {
+	var out []FieldRule
+	for _, e := range c.effective() {
+		out = append(out, compileRule(e.Rule))
+	}
+	return out
+}
+
+func compileRule(r Rule) FieldRule {
+	fr := FieldRule{Type: "field", OutboundTag: string(r.Target)}
+	for _, v := range r.Values {
+		v = strings.TrimSpace(v)
+		switch r.Type {
+		case TypeDomain:
+			fr.Domain = append(fr.Domain, "domain:"+v)
+		case TypeFull:
+			fr.Domain = append(fr.Domain, "full:"+v)
+		case TypeRegexp:
+			fr.Domain = append(fr.Domain, "regexp:"+v)
+		case TypeGeosite:
+			fr.Domain = append(fr.Domain, "geosite:"+v)
+		case TypeCIDR:
+			fr.IP = append(fr.IP, v)
+		case TypeGeoIP:
+			fr.IP = append(fr.IP, "geoip:"+v)
+		case TypePort:
+			fr.Port = joinNonEmpty(fr.Port, v)
+		case TypeProcess:
+			fr.Process = append(fr.Process, v)
+		}
+	}
+	return fr
+}
+
+func joinNonEmpty(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+// Apply replaces the routing rules and domain strategy in an xray config
+// with the compiled form of c. Other routing fields such as balancers are
+// kept.
+func Apply(cfg xrayconf.Config, c Config) error {
+	routing := map[string]any{}
+	if err := cfg.Section("routing", &routing); err != nil {
+		return err
+	}
+	if c.DomainStrategy != "" {
+		routing["domainStrategy"] = c.DomainStrategy
+	}
+	rules := Compile(c)
+	if rules == nil {
+		rules = []FieldRule{}
+	}
+	routing["rules"] = rules
+	return cfg.SetSection("routing", routing)
+}
+
+// ApplyJSON is Apply for a config held as text.
+func ApplyJSON(data []byte, c Config) ([]byte, error) {
+	cfg, err := xrayconf.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := Apply(cfg, c); err != nil {
+		return nil, err
+	}
+	return cfg.Marshal()
+}
@@ -0,0 +1,150 @@
+package routing
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// GeoLookup answers geosite/geoip membership questions. Without one only
+// geoip:private can be evaluated.
+type GeoLookup interface {
+	SiteContains(code, domain string) (bool, error)
+	IPContains(code string, ip net.IP) (bool, error)
+}
+
+// Geo is consulted by Match for geosite and geoip rules.
+var Geo GeoLookup
+
+// Query describes a connection to classify.
+type Query struct {
+	Host    string `json:"host"`
+	Port    int    `json:"port,omitempty"`
+	Process string `json:"process,omitempty"`
+}
+
+// Result reports the first rule that matched a Query.
+type Result struct {
+	Matched bool   `json:"matched"`
+	Target  Target `json:"target"`
+	Source  string `json:"source,omitempty"`
+	Rule    *Rule  `json:"rule,omitempty"`
+	Value   string `json:"value,omitempty"`
+	// ResolvedIP is set when the match needed a DNS lookup.
+	ResolvedIP string `json:"resolvedIp,omitempty"`
+	// Skipped lists geo values that could not be evaluated.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// PrivateNets is what geoip:private covers.
+var PrivateNets = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15",
+	"224.0.0.0/4", "240.0.0.0/4", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+}
+
+// Match finds the rule xray would pick for q. Unmatched traffic goes to the
+// first outbound, which the template tags "proxy".
+func Match(c Config, q Query) Result {
+	res := Result{Target: TargetProxy}
+	host := strings.TrimSuffix(strings.ToLower(q.Host), ".")
+	ip := net.ParseIP(host)
+	entries := c.effective()
+	if matchAll(entries, q, host, ip, &res) {
+		return res
+	}
+	if ip == nil && (c.DomainStrategy == "IPIfNonMatch" || c.DomainStrategy == "IPOnDemand") {
+		if ips, err := net.LookupIP(host); err == nil && len(ips) > 0 {
+			res.ResolvedIP = ips[0].String()
+			if matchAll(entries, q, "", ips[0], &res) {
+				return res
+			}
+		}
+	}
+	return res
+}
+
+func matchAll(entries []entry, q Query, host string, ip net.IP, res *Result) bool {
+	for _, e := range entries {
+		for _, v := range e.Rule.Values {
+			ok, evaluated := matchValue(e.Rule.Type, strings.TrimSpace(v), q, host, ip)
+			if !evaluated {
+				res.Skipped = append(res.Skipped, string(e.Rule.Type)+":"+v)
+				continue
+			}
+			if ok {
+				r := e.Rule
+				res.Matched, res.Target, res.Source, res.Rule, res.Value = true, r.Target, e.Source, &r, v
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchValue reports whether v matches, and whether it could be evaluated
+// at all.
+func matchValue(t Type, v string, q Query, host string, ip net.IP) (bool, bool) {
+	switch t {
+	case TypeDomain:
+		v = strings.ToLower(v)
+		return host != "" && ip == nil && (host == v || strings.HasSuffix(host, "."+v)), true
+	case TypeFull:
+		return host != "" && ip == nil && host == strings.ToLower(v), true
+	case TypeRegexp:
+		re, err := regexp.Compile(v)
+		return err == nil && host != "" && ip == nil && re.MatchString(host), true
+	case TypeGeosite:
+		if host == "" || ip != nil {
+			return false, true
+		}
+		if Geo == nil {
+			return false, false
+		}
+		ok, err := Geo.SiteContains(v, host)
+		return ok, err == nil
+	case TypeCIDR:
+		n, err := parseCIDR(v)
+		return err == nil && ip != nil && n.Contains(ip), true
+	case TypeGeoIP:
+		if ip == nil {
+			return false, true
+		}
+		if v == "private" {
+			for _, cidr := range PrivateNets {
+				if _, n, _ := net.ParseCIDR(cidr); n.Contains(ip) {
+					return true, true
+				}
+			}
+			return false, true
+		}
+		if Geo == nil {
+			return false, false
+		}
+		ok, err := Geo.IPContains(v, ip)
+		return ok, err == nil
+	case TypePort:
+		from, to, err := parsePortRange(v)
+		return err == nil && q.Port >= from && q.Port <= to, true
+	case TypeProcess:
+		return q.Process != "" && strings.EqualFold(q.Process, v), true
+	}
+	return false, true
+}
+
+// parseCIDR accepts a bare address as a single-host network.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "CIDR address", Text: s}
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
@@ -0,0 +1,235 @@
+// Package routing stores user routing rules and presets and compiles them
+// into the xray "routing" section.
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go_core/internal/settings"
+)
+
+// Type is what a rule matches on.
+type Type string
+
+const (
+	TypeDomain  Type = "domain"  // domain and all subdomains
+	TypeFull    Type = "full"    // exact domain
+	TypeRegexp  Type = "regexp"  // regular expression over the domain
+	TypeGeosite Type = "geosite" // geosite.dat category, e.g. "cn"
+	TypeCIDR    Type = "cidr"    // IP or CIDR
+	TypeGeoIP   Type = "geoip"   // geoip.dat code, e.g. "private"
+	TypePort    Type = "port"    // port or range, e.g. "443" or "6881-6889"
+	TypeProcess Type = "process" // process name; needs an xray core with process routing
+)
+
+// Target is the outbound tag traffic is sent to. The names match the tags
+// in the Dart xray template.
+type Target string
+
+const (
+	TargetProxy  Target = "proxy"
+	TargetDirect Target = "direct"
+	TargetBlock  Target = "block"
+)
+
+// Rule sends traffic matching any of Values to Target. A rule without
+// "enabled" is on.
+type Rule struct {
+	Name    string   `json:"name,omitempty"`
+	Type    Type     `json:"type"`
+	Values  []string `json:"values"`
+	Target  Target   `json:"target"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+// On reports whether r takes part in routing.
+func (r Rule) On() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// Config is the persisted routing setup. User rules are evaluated before
+// presets, so they can override them.
+type Config struct {
+	DomainStrategy string   `json:"domainStrategy,omitempty"`
+	Presets        []string `json:"presets"`
+	Rules          []Rule   `json:"rules"`
+}
+
+// Preset is a named, read-only rule set.
+type Preset struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Rules       []Rule `json:"rules"`
+}
+
+// Presets are offered to the user by name.
+var Presets = []Preset{
+	{
+		Name:        "bypass-lan",
+		Description: "Connect to private networks and localhost directly",
+		Rules: []Rule{
+			{Type: TypeFull, Values: []string{"localhost"}, Target: TargetDirect},
+			{Type: TypeGeoIP, Values: []string{"private"}, Target: TargetDirect},
+		},
+	},
+	{
+		Name:        "bypass-cn",
+		Description: "Connect to mainland China sites directly",
+		Rules: []Rule{
+			{Type: TypeGeosite, Values: []string{"cn"}, Target: TargetDirect},
+			{Type: TypeGeoIP, Values: []string{"cn"}, Target: TargetDirect},
+		},
+	},
+	{
+		Name:        "block-ads",
+		Description: "Drop known advertising domains",
+		Rules: []Rule{
+			{Type: TypeGeosite, Values: []string{"category-ads-all"}, Target: TargetBlock},
+		},
+	},
+}
+
+// DefaultConfig keeps LAN traffic off the proxy, which is what almost
+// everyone expects.
+func DefaultConfig() Config {
+	return Config{DomainStrategy: "IPIfNonMatch", Presets: []string{"bypass-lan"}}
+}
+
+func findPreset(name string) (Preset, bool) {
+	for _, p := range Presets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// Validate checks rule types, targets and values.
+func (c Config) Validate() error {
+	for _, name := range c.Presets {
+		if _, ok := findPreset(name); !ok {
+			return fmt.Errorf("unknown preset %q", name)
+		}
+	}
+	for i, r := range c.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	switch r.Target {
+	case TargetProxy, TargetDirect, TargetBlock:
+	default:
+		return fmt.Errorf("unknown target %q", r.Target)
+	}
+	if len(r.Values) == 0 {
+		return errors.New("no values")
+	}
+	for _, v := range r.Values {
+		if strings.TrimSpace(v) == "" {
+			return errors.New("empty value")
+		}
+		switch r.Type {
+		case TypeDomain, TypeFull, TypeGeosite, TypeGeoIP, TypeProcess:
+		case TypeRegexp:
+			if _, err := regexp.Compile(v); err != nil {
+				return err
+			}
+		case TypeCIDR:
+			if _, err := parseCIDR(v); err != nil {
+				return err
+			}
+		case TypePort:
+			if _, _, err := parsePortRange(v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown type %q", r.Type)
+		}
+	}
+	return nil
+}
+
+func parsePortRange(s string) (int, int, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	from, err := strconv.Atoi(lo)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	to := from
+	if isRange {
+		if to, err = strconv.Atoi(hi); err != nil {
+			return 0, 0, fmt.Errorf("invalid port %q", s)
+		}
+	}
+	if from < 1 || to > 65535 || from > to {
+		return 0, 0, fmt.Errorf("invalid port %q", s)
+	}
+	return from, to, nil
+}
+
+// entry is one rule in evaluation order together with where it came from.
+type entry struct {
+	Rule   Rule
+	Source string
+}
+
+// effective flattens user rules and presets into evaluation order,
+// skipping disabled rules.
+func (c Config) effective() []entry {
+	var out []entry
+	for i, r := range c.Rules {
+		if r.On() {
+			out = append(out, entry{r, fmt.Sprintf("rule:%d", i)})
+		}
+	}
+	for _, name := range c.Presets {
+		p, _ := findPreset(name)
+		for _, r := range p.Rules {
+			out = append(out, entry{r, "preset:" + name})
+		}
+	}
+	return out
+}
+
+// Effective returns the enabled user rules followed by the preset rules, in
+// the order xray evaluates them.
+func Effective(c Config) []Rule {
+	entries := c.effective()
+	rules := make([]Rule, len(entries))
+	for i, e := range entries {
+		rules[i] = e.Rule
+	}
+	return rules
+}
+
+const file = "routing.json"
+
+// Load returns the saved config, or DefaultConfig when none exists.
+func Load() (Config, error) {
+	var c Config
+	err := settings.Load(file, &c)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	return c, c.Validate()
+}
+
+// Save validates and persists c.
+func Save(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return settings.Save(file, c, 0644)
+}
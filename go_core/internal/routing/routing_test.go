@@ -0,0 +1,173 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// fakeGeo knows one geosite and one geoip code.
+type fakeGeo struct{}
+
+func (fakeGeo) SiteContains(code, domain string) (bool, error) {
+	if code != "cn" {
+		return false, errors.New("unknown code")
+	}
+	return domain == "baidu.com", nil
+}
+
+func (fakeGeo) IPContains(code string, ip net.IP) (bool, error) {
+	if code != "cn" {
+		return false, errors.New("unknown code")
+	}
+	_, n, _ := net.ParseCIDR("36.110.0.0/16")
+	return n.Contains(ip), nil
+}
+
+func TestRuleEnabledDefault(t *testing.T) {
+	tests := []struct {
+		json string
+		want bool
+	}{
+		{`{"type":"domain","values":["a.com"],"target":"direct"}`, true},
+		{`{"type":"domain","values":["a.com"],"target":"direct","enabled":true}`, true},
+		{`{"type":"domain","values":["a.com"],"target":"direct","enabled":false}`, false},
+	}
+	for _, tt := range tests {
+		var r Rule
+		if err := json.Unmarshal([]byte(tt.json), &r); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.On(); got != tt.want {
+			t.Errorf("%s: On() = %v, want %v", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	off := false
+	c := Config{
+		DomainStrategy: "AsIs",
+		Presets:        []string{"bypass-lan"},
+		Rules: []Rule{
+			{Type: TypeDomain, Values: []string{"blocked.example"}, Target: TargetBlock, Enabled: &off},
+			{Type: TypeDomain, Values: []string{"example.com"}, Target: TargetDirect},
+			{Type: TypeFull, Values: []string{"api.example.org"}, Target: TargetBlock},
+			{Type: TypeRegexp, Values: []string{`^ads\.`}, Target: TargetBlock},
+			{Type: TypeGeosite, Values: []string{"cn"}, Target: TargetDirect},
+			{Type: TypeGeoIP, Values: []string{"cn"}, Target: TargetDirect},
+			{Type: TypeCIDR, Values: []string{"203.0.113.0/24", "198.51.100.7"}, Target: TargetBlock},
+			{Type: TypePort, Values: []string{"6881-6889"}, Target: TargetDirect},
+			{Type: TypeProcess, Values: []string{"curl"}, Target: TargetBlock},
+		},
+	}
+	tests := []struct {
+		name   string
+		geo    GeoLookup
+		q      Query
+		target Target
+		source string
+		value  string
+		skip   []string
+	}{
+		{"unmatched goes to proxy", fakeGeo{}, Query{Host: "github.com"}, TargetProxy, "", "", nil},
+		{"disabled rule is skipped", fakeGeo{}, Query{Host: "blocked.example"}, TargetProxy, "", "", nil},
+		{"domain covers subdomains", fakeGeo{}, Query{Host: "www.Example.com."}, TargetDirect, "rule:1", "example.com", nil},
+		{"full is exact", fakeGeo{}, Query{Host: "v2.api.example.org"}, TargetProxy, "", "", nil},
+		{"full", fakeGeo{}, Query{Host: "api.example.org"}, TargetBlock, "rule:2", "api.example.org", nil},
+		{"regexp", fakeGeo{}, Query{Host: "ads.tracker.net"}, TargetBlock, "rule:3", `^ads\.`, nil},
+		{"geosite", fakeGeo{}, Query{Host: "baidu.com"}, TargetDirect, "rule:4", "cn", nil},
+		{"geoip", fakeGeo{}, Query{Host: "36.110.1.1"}, TargetDirect, "rule:5", "cn", nil},
+		{"cidr", fakeGeo{}, Query{Host: "203.0.113.9"}, TargetBlock, "rule:6", "203.0.113.0/24", nil},
+		{"bare address", fakeGeo{}, Query{Host: "198.51.100.7"}, TargetBlock, "rule:6", "198.51.100.7", nil},
+		{"port range", fakeGeo{}, Query{Host: "peer.example.net", Port: 6885}, TargetDirect, "rule:7", "6881-6889", nil},
+		{"process", fakeGeo{}, Query{Host: "github.com", Process: "CURL"}, TargetBlock, "rule:8", "curl", nil},
+		{"preset after user rules", fakeGeo{}, Query{Host: "192.168.1.10"}, TargetDirect, "preset:bypass-lan", "private", nil},
+		{"geo without data is skipped", nil, Query{Host: "baidu.com"}, TargetProxy, "", "", []string{"geosite:cn"}},
+		{"geoip private needs no data", nil, Query{Host: "10.0.0.1"}, TargetDirect, "preset:bypass-lan", "private", []string{"geoip:cn"}},
+	}
+	defer func() { Geo = nil }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Geo = tt.geo
+			res := Match(c, tt.q)
+			if res.Target != tt.target || res.Source != tt.source || res.Value != tt.value {
+				t.Errorf("Match(%+v) = %s %q %q, want %s %q %q", tt.q, res.Target, res.Source, res.Value, tt.target, tt.source, tt.value)
+			}
+			if res.Matched != (tt.source != "") {
+				t.Errorf("Match(%+v).Matched = %v", tt.q, res.Matched)
+			}
+			if !reflect.DeepEqual(res.Skipped, tt.skip) {
+				t.Errorf("Match(%+v).Skipped = %v, want %v", tt.q, res.Skipped, tt.skip)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	off := false
+	tests := []struct {
+		name string
+		c    Config
+		want []FieldRule
+	}{
+		{
+			name: "empty",
+			c:    Config{},
+			want: nil,
+		},
+		{
+			name: "domain kinds share one rule",
+			c: Config{Rules: []Rule{
+				{Type: TypeDomain, Values: []string{"a.com"}, Target: TargetDirect},
+				{Type: TypeFull, Values: []string{" b.com "}, Target: TargetDirect},
+				{Type: TypeRegexp, Values: []string{`^c\.`}, Target: TargetDirect},
+				{Type: TypeGeosite, Values: []string{"cn", "category-ads-all"}, Target: TargetBlock},
+			}},
+			want: []FieldRule{
+				{Type: "field", Domain: []string{"domain:a.com"}, OutboundTag: "direct"},
+				{Type: "field", Domain: []string{"full:b.com"}, OutboundTag: "direct"},
+				{Type: "field", Domain: []string{`regexp:^c\.`}, OutboundTag: "direct"},
+				{Type: "field", Domain: []string{"geosite:cn", "geosite:category-ads-all"}, OutboundTag: "block"},
+			},
+		},
+		{
+			name: "ip, port and process",
+			c: Config{Rules: []Rule{
+				{Type: TypeCIDR, Values: []string{"10.0.0.0/8"}, Target: TargetDirect},
+				{Type: TypeGeoIP, Values: []string{"cn"}, Target: TargetDirect},
+				{Type: TypePort, Values: []string{"443", "6881-6889"}, Target: TargetProxy},
+				{Type: TypeProcess, Values: []string{"curl", "git"}, Target: TargetBlock},
+			}},
+			want: []FieldRule{
+				{Type: "field", IP: []string{"10.0.0.0/8"}, OutboundTag: "direct"},
+				{Type: "field", IP: []string{"geoip:cn"}, OutboundTag: "direct"},
+				{Type: "field", Port: "443,6881-6889", OutboundTag: "proxy"},
+				{Type: "field", Process: []string{"curl", "git"}, OutboundTag: "block"},
+			},
+		},
+		{
+			name: "disabled rules dropped, presets last",
+			c: Config{
+				Presets: []string{"block-ads"},
+				Rules: []Rule{
+					{Type: TypeDomain, Values: []string{"off.com"}, Target: TargetBlock, Enabled: &off},
+					{Type: TypeDomain, Values: []string{"on.com"}, Target: TargetProxy},
+				},
+			},
+			want: []FieldRule{
+				{Type: "field", Domain: []string{"domain:on.com"}, OutboundTag: "proxy"},
+				{Type: "field", Domain: []string{"geosite:category-ads-all"}, OutboundTag: "block"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compile(tt.c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Package sdnotify reports service state to systemd through NOTIFY_SOCKET,
+// for units of Type=notify or notify-reload. Without the socket, as when
+// not started by systemd, every call does nothing.
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States to send.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends state lines to systemd.
+func Notify(states ...string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	msg := ""
+	for _, s := range states {
+		msg += s + "\n"
+	}
+	_, err = conn.Write([]byte(msg))
+	return err
+}
+
+// Status is a free-form status line for systemctl status.
+func Status(s string) string {
+	return "STATUS=" + s
+}
+
+// Reloading starts a reload; Ready ends it. notify-reload units need the
+// monotonic timestamp with it.
+func Reloading() []string {
+	states := []string{"RELOADING=1"}
+	if usec, ok := monotonicUsec(); ok {
+		states = append(states, "MONOTONIC_USEC="+strconv.FormatInt(usec, 10))
+	}
+	return states
+}
+
+// WatchdogInterval is how often to send Watchdog: half the unit's
+// WatchdogSec, or 0 when the watchdog is off or meant for another process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
@@ -0,0 +1,49 @@
+// Package settings keeps the JSON settings files under the user's config
+// directory, ~/.config/xstream on Linux.
+package settings
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"go_core/internal/platform"
+)
+
+// Sys writes the files. The bridge swaps it for a dry-run plan's System,
+// which records the writes.
+var Sys platform.System = platform.Live{}
+
+// Dir is the directory every settings file lives in.
+func Dir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "xstream")
+}
+
+// Path is the path of the settings file name.
+func Path(name string) string {
+	return filepath.Join(Dir(), name)
+}
+
+// Load decodes the settings file name into v. When the file does not
+// exist, v is left as it is and the error matches os.ErrNotExist.
+func Load(name string, v any) error {
+	data, err := os.ReadFile(Path(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Save replaces the settings file name with v. Files holding secrets pass
+// perm 0600.
+func Save(name string, v any, perm os.FileMode) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return Sys.WriteFile(Path(name), data, perm)
+}
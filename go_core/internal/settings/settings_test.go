@@ -0,0 +1,43 @@
+package settings
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"go_core/internal/platform"
+)
+
+func TestSaveLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("AppData", os.Getenv("XDG_CONFIG_HOME"))
+	type conf struct {
+		Name string `json:"name"`
+	}
+	c := conf{Name: "default"}
+	if err := Load("test.json", &c); !errors.Is(err, os.ErrNotExist) || c.Name != "default" {
+		t.Fatalf("Load of a missing file = %v, %+v", err, c)
+	}
+
+	// Under a plan the write is only recorded.
+	plan := platform.NewPlan()
+	Sys = plan.System()
+	err := Save("test.json", conf{Name: "planned"}, 0644)
+	Sys = platform.Live{}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps := plan.Steps(); len(steps) != 1 || steps[0].Kind != "write" || steps[0].Path != Path("test.json") {
+		t.Errorf("steps = %+v", steps)
+	}
+	if _, err := os.Stat(Path("test.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("planned save wrote the file: %v", err)
+	}
+
+	if err := Save("test.json", conf{Name: "saved"}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load("test.json", &c); err != nil || c.Name != "saved" {
+		t.Errorf("Load = %v, %+v", err, c)
+	}
+}
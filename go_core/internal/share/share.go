@@ -0,0 +1,321 @@
+// Package share turns share links (vless://, vmess://, trojan://, ss://)
+// and subscriptions of them into xray configs shaped like the app's
+// template: local SOCKS and HTTP inbounds and a "proxy" outbound.
+package share
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Node is a parsed link.
+type Node struct {
+	Name     string
+	Outbound map[string]any
+}
+
+// Parse reads one share link.
+func Parse(link string) (Node, error) {
+	link = strings.TrimSpace(link)
+	scheme, _, ok := strings.Cut(link, "://")
+	if !ok {
+		return Node{}, fmt.Errorf("not a share link")
+	}
+	switch strings.ToLower(scheme) {
+	case "vless":
+		return parseVless(link)
+	case "vmess":
+		return parseVmess(link)
+	case "trojan":
+		return parseTrojan(link)
+	case "ss":
+		return parseShadowsocks(link)
+	}
+	return Node{}, fmt.Errorf("unsupported scheme %q", scheme)
+}
+
+// ParseSubscription reads a subscription: links one per line, the whole
+// list optionally base64 encoded. Lines that do not parse are returned as
+// errors next to the nodes that do.
+func ParseSubscription(data []byte) ([]Node, []error) {
+	text := strings.TrimSpace(string(data))
+	if !strings.Contains(text, "://") {
+		if decoded, err := decodeBase64(text); err == nil {
+			text = string(decoded)
+		}
+	}
+	var nodes []Node
+	var errs []error
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		n, err := Parse(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%.40s: %w", line, err))
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, errs
+}
+
+// Config builds a full xray config around n's outbound.
+func Config(n Node) ([]byte, error) {
+	sniffing := map[string]any{"enabled": true, "destOverride": []string{"http", "tls", "quic"}}
+	cfg := map[string]any{
+		"log": map[string]any{"loglevel": "info"},
+		"dns": map[string]any{
+			"servers":       []string{"1.1.1.1", "8.8.8.8"},
+			"queryStrategy": "UseIPv4",
+		},
+		"inbounds": []any{
+			map[string]any{"listen": "127.0.0.1", "port": 1080, "protocol": "socks", "settings": map[string]any{"udp": true}, "sniffing": sniffing},
+			map[string]any{"listen": "127.0.0.1", "port": 1081, "protocol": "http", "sniffing": sniffing},
+		},
+		"outbounds": []any{
+			n.Outbound,
+			map[string]any{"protocol": "freedom", "tag": "direct"},
+			map[string]any{"protocol": "blackhole", "tag": "block"},
+		},
+		"routing": map[string]any{"rules": []any{}},
+	}
+	return json.MarshalIndent(cfg, "", "  ")
+}
+
+func parseVless(link string) (Node, error) {
+	u, port, err := parseURL(link)
+	if err != nil {
+		return Node{}, err
+	}
+	q := u.Query()
+	user := map[string]any{"id": u.User.Username(), "encryption": orDefault(q.Get("encryption"), "none")}
+	if flow := q.Get("flow"); flow != "" {
+		user["flow"] = flow
+	}
+	out := map[string]any{
+		"protocol": "vless",
+		"settings": map[string]any{"vnext": []any{map[string]any{
+			"address": u.Hostname(), "port": port, "users": []any{user},
+		}}},
+		"streamSettings": stream(q, u.Hostname()),
+		"tag":            "proxy",
+	}
+	return Node{Name: name(u, u.Hostname()), Outbound: out}, nil
+}
+
+func parseTrojan(link string) (Node, error) {
+	u, port, err := parseURL(link)
+	if err != nil {
+		return Node{}, err
+	}
+	q := u.Query()
+	if q.Get("security") == "" {
+		q.Set("security", "tls")
+	}
+	out := map[string]any{
+		"protocol": "trojan",
+		"settings": map[string]any{"servers": []any{map[string]any{
+			"address": u.Hostname(), "port": port, "password": u.User.Username(),
+		}}},
+		"streamSettings": stream(q, u.Hostname()),
+		"tag":            "proxy",
+	}
+	return Node{Name: name(u, u.Hostname()), Outbound: out}, nil
+}
+
+// parseVmess reads the base64 JSON form v2rayN uses.
+func parseVmess(link string) (Node, error) {
+	data, err := decodeBase64(strings.TrimPrefix(link[len("vmess://"):], "/"))
+	if err != nil {
+		return Node{}, fmt.Errorf("vmess: %w", err)
+	}
+	var v struct {
+		Ps   string          `json:"ps"`
+		Add  string          `json:"add"`
+		Port json.RawMessage `json:"port"`
+		ID   string          `json:"id"`
+		Aid  json.RawMessage `json:"aid"`
+		Scy  string          `json:"scy"`
+		Net  string          `json:"net"`
+		Type string          `json:"type"`
+		Host string          `json:"host"`
+		Path string          `json:"path"`
+		TLS  string          `json:"tls"`
+		SNI  string          `json:"sni"`
+		ALPN string          `json:"alpn"`
+		FP   string          `json:"fp"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return Node{}, fmt.Errorf("vmess: %w", err)
+	}
+	port, err := strconv.Atoi(strings.Trim(string(v.Port), `"`))
+	if err != nil || v.Add == "" || v.ID == "" {
+		return Node{}, fmt.Errorf("vmess: address, port and id are required")
+	}
+	aid, _ := strconv.Atoi(strings.Trim(string(v.Aid), `"`))
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("type", v.Net)
+	set("headerType", v.Type)
+	set("host", v.Host)
+	set("path", v.Path)
+	set("security", v.TLS)
+	set("sni", v.SNI)
+	set("alpn", v.ALPN)
+	set("fp", v.FP)
+	if v.Net == "grpc" {
+		set("serviceName", v.Path)
+	}
+	out := map[string]any{
+		"protocol": "vmess",
+		"settings": map[string]any{"vnext": []any{map[string]any{
+			"address": v.Add, "port": port,
+			"users": []any{map[string]any{"id": v.ID, "alterId": aid, "security": orDefault(v.Scy, "auto")}},
+		}}},
+		"streamSettings": stream(q, v.Add),
+		"tag":            "proxy",
+	}
+	return Node{Name: orDefault(v.Ps, v.Add), Outbound: out}, nil
+}
+
+// parseShadowsocks reads SIP002 links, with the user info plain or base64,
+// and the older form with everything before the fragment base64 encoded.
+func parseShadowsocks(link string) (Node, error) {
+	rest := link[len("ss://"):]
+	body, fragment, _ := strings.Cut(rest, "#")
+	if !strings.Contains(body, "@") {
+		decoded, err := decodeBase64(body)
+		if err != nil {
+			return Node{}, fmt.Errorf("ss: %w", err)
+		}
+		body = string(decoded)
+		link = "ss://" + body
+		if fragment != "" {
+			link += "#" + fragment
+		}
+	}
+	u, port, err := parseURL(link)
+	if err != nil {
+		return Node{}, err
+	}
+	method, password := u.User.Username(), ""
+	if p, ok := u.User.Password(); ok {
+		password = p
+	} else if decoded, err := decodeBase64(method); err == nil {
+		method, password, _ = strings.Cut(string(decoded), ":")
+	}
+	if method == "" || password == "" {
+		return Node{}, fmt.Errorf("ss: method and password are required")
+	}
+	out := map[string]any{
+		"protocol": "shadowsocks",
+		"settings": map[string]any{"servers": []any{map[string]any{
+			"address": u.Hostname(), "port": port, "method": method, "password": password,
+		}}},
+		"tag": "proxy",
+	}
+	return Node{Name: name(u, u.Hostname()), Outbound: out}, nil
+}
+
+func parseURL(link string) (*url.URL, int, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, 0, err
+	}
+	if u.User == nil || u.Hostname() == "" {
+		return nil, 0, fmt.Errorf("%s: user and host are required", u.Scheme)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: invalid port %q", u.Scheme, u.Port())
+	}
+	return u, port, nil
+}
+
+// stream builds streamSettings from the query parameters links share.
+func stream(q url.Values, address string) map[string]any {
+	network := orDefault(q.Get("type"), "tcp")
+	s := map[string]any{"network": network}
+	host, path := q.Get("host"), q.Get("path")
+	switch network {
+	case "ws":
+		ws := map[string]any{"path": orDefault(path, "/")}
+		if host != "" {
+			ws["headers"] = map[string]string{"Host": host}
+		}
+		s["wsSettings"] = ws
+	case "grpc":
+		s["grpcSettings"] = map[string]any{"serviceName": q.Get("serviceName")}
+	case "h2", "http":
+		s["network"] = "http"
+		h := map[string]any{"path": orDefault(path, "/")}
+		if host != "" {
+			h["host"] = strings.Split(host, ",")
+		}
+		s["httpSettings"] = h
+	case "httpupgrade", "xhttp", "splithttp":
+		s[network+"Settings"] = map[string]any{"path": orDefault(path, "/"), "host": host}
+	case "tcp":
+		if q.Get("headerType") == "http" {
+			s["tcpSettings"] = map[string]any{"header": map[string]any{"type": "http"}}
+		}
+	}
+	sni := orDefault(q.Get("sni"), orDefault(host, address))
+	switch security := q.Get("security"); security {
+	case "tls":
+		t := map[string]any{"serverName": sni, "fingerprint": orDefault(q.Get("fp"), "chrome")}
+		if alpn := q.Get("alpn"); alpn != "" {
+			t["alpn"] = strings.Split(alpn, ",")
+		}
+		if q.Get("allowInsecure") == "1" {
+			t["allowInsecure"] = true
+		}
+		s["security"] = "tls"
+		s["tlsSettings"] = t
+	case "reality":
+		s["security"] = "reality"
+		s["realitySettings"] = map[string]any{
+			"serverName":  sni,
+			"fingerprint": orDefault(q.Get("fp"), "chrome"),
+			"publicKey":   q.Get("pbk"),
+			"shortId":     q.Get("sid"),
+			"spiderX":     q.Get("spx"),
+		}
+	}
+	return s
+}
+
+func name(u *url.URL, fallback string) string {
+	if u.Fragment != "" {
+		return u.Fragment
+	}
+	return fallback
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// decodeBase64 accepts the standard and URL alphabets, padded or not.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64")
+}
@@ -0,0 +1,190 @@
+package share
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// normalize round-trips v through JSON, so outbounds built from Go values
+// compare equal to ones written as JSON.
+func normalize(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func vmessLink(json string) string {
+	return "vmess://" + base64.StdEncoding.EncodeToString([]byte(json))
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     string
+		wantName string
+		want     string // the outbound as JSON
+	}{
+		{
+			name:     "vless reality",
+			link:     "vless://b831381d-6324-4d53-ad4f-8cda48b30811@jp.example.com:443?encryption=none&flow=xtls-rprx-vision&security=reality&sni=www.microsoft.com&fp=firefox&pbk=SbVKOEMjK0sIlbwg4akyBg5mL5KZwwB-ed4eEE7YnRc&sid=6ba85179e30d4fc2&type=tcp#JP%20Tokyo",
+			wantName: "JP Tokyo",
+			want: `{"protocol": "vless", "tag": "proxy",
+				"settings": {"vnext": [{"address": "jp.example.com", "port": 443, "users": [
+					{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "encryption": "none", "flow": "xtls-rprx-vision"}]}]},
+				"streamSettings": {"network": "tcp", "security": "reality", "realitySettings": {
+					"serverName": "www.microsoft.com", "fingerprint": "firefox",
+					"publicKey": "SbVKOEMjK0sIlbwg4akyBg5mL5KZwwB-ed4eEE7YnRc", "shortId": "6ba85179e30d4fc2", "spiderX": ""}}}`,
+		},
+		{
+			name:     "vless ws tls without a name",
+			link:     "vless://b831381d-6324-4d53-ad4f-8cda48b30811@203.0.113.5:8443?type=ws&path=%2Fray&host=cdn.example.com&security=tls&alpn=h2,http/1.1",
+			wantName: "203.0.113.5",
+			want: `{"protocol": "vless", "tag": "proxy",
+				"settings": {"vnext": [{"address": "203.0.113.5", "port": 8443, "users": [
+					{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "encryption": "none"}]}]},
+				"streamSettings": {"network": "ws",
+					"wsSettings": {"path": "/ray", "headers": {"Host": "cdn.example.com"}},
+					"security": "tls", "tlsSettings": {"serverName": "cdn.example.com", "fingerprint": "chrome", "alpn": ["h2", "http/1.1"]}}}`,
+		},
+		{
+			name:     "vmess with string port",
+			link:     vmessLink(`{"v":"2","ps":"US West","add":"us.example.com","port":"443","id":"a3482e88-686a-4a58-8126-99c9df64b7bf","aid":"0","scy":"auto","net":"ws","type":"none","host":"us.example.com","path":"/vm","tls":"tls","sni":""}`),
+			wantName: "US West",
+			want: `{"protocol": "vmess", "tag": "proxy",
+				"settings": {"vnext": [{"address": "us.example.com", "port": 443, "users": [
+					{"id": "a3482e88-686a-4a58-8126-99c9df64b7bf", "alterId": 0, "security": "auto"}]}]},
+				"streamSettings": {"network": "ws",
+					"wsSettings": {"path": "/vm", "headers": {"Host": "us.example.com"}},
+					"security": "tls", "tlsSettings": {"serverName": "us.example.com", "fingerprint": "chrome"}}}`,
+		},
+		{
+			name:     "vmess with int port and grpc",
+			link:     vmessLink(`{"v":2,"ps":"","add":"198.51.100.7","port":10086,"id":"a3482e88-686a-4a58-8126-99c9df64b7bf","aid":64,"scy":"aes-128-gcm","net":"grpc","path":"gun"}`),
+			wantName: "198.51.100.7",
+			want: `{"protocol": "vmess", "tag": "proxy",
+				"settings": {"vnext": [{"address": "198.51.100.7", "port": 10086, "users": [
+					{"id": "a3482e88-686a-4a58-8126-99c9df64b7bf", "alterId": 64, "security": "aes-128-gcm"}]}]},
+				"streamSettings": {"network": "grpc", "grpcSettings": {"serviceName": "gun"}}}`,
+		},
+		{
+			name:     "trojan defaults to tls",
+			link:     "trojan://p%40ssword@trojan.example.com:443?sni=t.example.com#HK",
+			wantName: "HK",
+			want: `{"protocol": "trojan", "tag": "proxy",
+				"settings": {"servers": [{"address": "trojan.example.com", "port": 443, "password": "p@ssword"}]},
+				"streamSettings": {"network": "tcp", "security": "tls", "tlsSettings": {"serverName": "t.example.com", "fingerprint": "chrome"}}}`,
+		},
+		{
+			name:     "ss SIP002 plain user info",
+			link:     "ss://chacha20-ietf-poly1305:secret@ss.example.com:8388#SS%20Plain",
+			wantName: "SS Plain",
+			want: `{"protocol": "shadowsocks", "tag": "proxy",
+				"settings": {"servers": [{"address": "ss.example.com", "port": 8388, "method": "chacha20-ietf-poly1305", "password": "secret"}]}}`,
+		},
+		{
+			name:     "ss SIP002 base64 user info",
+			link:     "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm:pa:ss")) + "@ss.example.com:8388/?plugin=#SG",
+			wantName: "SG",
+			want: `{"protocol": "shadowsocks", "tag": "proxy",
+				"settings": {"servers": [{"address": "ss.example.com", "port": 8388, "method": "aes-256-gcm", "password": "pa:ss"}]}}`,
+		},
+		{
+			name:     "ss legacy",
+			link:     "ss://" + base64.StdEncoding.EncodeToString([]byte("aes-128-gcm:legacy@192.0.2.10:8389")) + "#Legacy",
+			wantName: "Legacy",
+			want: `{"protocol": "shadowsocks", "tag": "proxy",
+				"settings": {"servers": [{"address": "192.0.2.10", "port": 8389, "method": "aes-128-gcm", "password": "legacy"}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", n.Name, tt.wantName)
+			}
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := normalize(t, n.Outbound); !reflect.DeepEqual(got, want) {
+				data, _ := json.Marshal(got)
+				t.Errorf("outbound =\n%s\nwant:\n%s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, link, want string
+	}{
+		{"no scheme", "example.com:443", "not a share link"},
+		{"unsupported scheme", "hysteria2://pw@example.com:443", "unsupported scheme"},
+		{"vless without user", "vless://example.com:443", "user and host are required"},
+		{"vless bad port", "vless://id@example.com:https", "invalid port"},
+		{"vmess not base64", "vmess://not base64!", "vmess: invalid base64"},
+		{"vmess without id", vmessLink(`{"add":"example.com","port":"443"}`), "address, port and id are required"},
+		{"vmess bad port", vmessLink(`{"add":"example.com","port":"x","id":"a"}`), "address, port and id are required"},
+		{"ss without password", "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm")) + "@example.com:8388", "method and password are required"},
+		{"ss legacy not base64", "ss://not base64!", "ss: invalid base64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.link)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %v, want %q", tt.link, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSubscription(t *testing.T) {
+	lines := strings.Join([]string{
+		"# exported by the provider",
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@jp.example.com:443?security=tls#JP",
+		"",
+		"  ss://chacha20-ietf-poly1305:secret@ss.example.com:8388#SS  ",
+		"vless://missing-port@example.com",
+		"garbage",
+		vmessLink(`{"ps":"US","add":"us.example.com","port":443,"id":"a3482e88-686a-4a58-8126-99c9df64b7bf"}`),
+	}, "\r\n")
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"plain", lines},
+		{"base64", base64.StdEncoding.EncodeToString([]byte(lines))},
+		{"base64 url unpadded", base64.RawURLEncoding.EncodeToString([]byte(lines)) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, errs := ParseSubscription([]byte(tt.data))
+			var names []string
+			for _, n := range nodes {
+				names = append(names, n.Name)
+			}
+			if want := []string{"JP", "SS", "US"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("nodes = %q, want %q", names, want)
+			}
+			if len(errs) != 2 {
+				t.Fatalf("errors = %v, want 2", errs)
+			}
+			if !strings.HasPrefix(errs[0].Error(), "vless://missing-port@example.com: ") || !strings.HasPrefix(errs[1].Error(), "garbage: ") {
+				t.Errorf("errors = %v, want the bad lines named", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+//go:build linux
+
+package splittun
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go_core/internal/platform"
+)
+
+const (
+	// ProxiedSlice holds every process routed through the TUN. systemd
+	// nests it under xstream.slice because of the dash.
+	ProxiedSlice = "xstream-proxied.slice"
+	anchorUnit   = "xstream-proxied-anchor"
+	nftAppsTable = "xstream_apps"
+	fwmark       = "0x5853"
+	routeTable   = "5853"
+)
+
+// userRoot returns the calling user's systemd manager cgroup, e.g.
+// user.slice/user-1000.slice/user@1000.service.
+func userRoot() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		path, ok := strings.CutPrefix(line, "0::/")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(path, "/")
+		for i, p := range parts {
+			if strings.HasPrefix(p, "user@") && strings.HasSuffix(p, ".service") {
+				return strings.Join(parts[:i+1], "/"), nil
+			}
+		}
+	}
+	return "", errors.New("not running under a systemd user manager with cgroup v2")
+}
+
+// SliceCgroup is the cgroup path of ProxiedSlice relative to the cgroup root.
+func SliceCgroup() (string, error) {
+	root, err := userRoot()
+	if err != nil {
+		return "", err
+	}
+	return root + "/xstream.slice/" + ProxiedSlice, nil
+}
+
+// ErrNoTun is returned by ModeCgroup when its TUN device does not exist.
+// XStream does not create one; a tun inbound or another program must.
+var ErrNoTun = errors.New("TUN device for cgroup mode does not exist")
+
+// Tun returns the TUN device ModeCgroup routes through.
+func (c Config) Tun() string {
+	if c.TunInterface == "" {
+		return "xstream0"
+	}
+	return c.TunInterface
+}
+
+// TunExists reports whether the device ModeCgroup routes through is up on
+// this host.
+func TunExists(c Config) bool {
+	_, err := os.Stat(filepath.Join("/sys/class/net", c.Tun()))
+	return err == nil
+}
+
+func enableCgroup(c Config) error {
+	tun := c.Tun()
+	if !TunExists(c) {
+		return fmt.Errorf("%w: %s", ErrNoTun, tun)
+	}
+	if err := ensureAnchor(); err != nil {
+		return err
+	}
+	slice, err := SliceCgroup()
+	if err != nil {
+		return err
+	}
+	if err := privilegedStdin(cgroupRuleset(slice), "nft", "-f", "-"); err != nil {
+		return err
+	}
+	for _, family := range []string{"-4", "-6"} {
+		privileged("ip", family, "rule", "del", "fwmark", fwmark, "lookup", routeTable)
+		if err := privileged("ip", family, "rule", "add", "fwmark", fwmark, "lookup", routeTable, "priority", routeTable); err != nil {
+			return err
+		}
+		if err := privileged("ip", family, "route", "replace", "default", "dev", tun, "table", routeTable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cgroupRuleset renders the nft script marking the sockets of processes in
+// slice, so the fwmark rule routes them through the TUN.
+func cgroupRuleset(slice string) string {
+	level := len(strings.Split(slice, "/"))
+	return fmt.Sprintf(`table inet %[1]s
+delete table inet %[1]s
+table inet %[1]s {
+	chain output {
+		type route hook output priority mangle; policy accept;
+		socket cgroupv2 level %[2]d %[3]q meta mark set %[4]s
+	}
+}
+`, nftAppsTable, level, slice, fwmark)
+}
+
+func disableCgroup() error {
+	var errs []error
+	if tableExists(nftAppsTable) {
+		if err := privileged("nft", "delete", "table", "inet", nftAppsTable); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, family := range []string{"-4", "-6"} {
+		privileged("ip", family, "rule", "del", "fwmark", fwmark, "lookup", routeTable)
+		privileged("ip", family, "route", "flush", "table", routeTable)
+	}
+	if anchorActive() {
+		Sys.Run(platform.Cmd{Name: "systemctl", Args: []string{"--user", "stop", anchorUnit + ".scope"}})
+	}
+	return errors.Join(errs...)
+}
+
+// ensureAnchor keeps one placeholder scope alive in the slice, so the cgroup
+// exists for nft and matched processes have a unit to be attached to.
+func ensureAnchor() error {
+	if anchorActive() {
+		return nil
+	}
+	pid, err := Sys.Start(platform.Cmd{Name: "systemd-run", Args: []string{"--user", "--scope", "--quiet",
+		"--unit=" + anchorUnit, "--slice=" + ProxiedSlice, "sleep", "infinity"}})
+	if err != nil || pid == 0 {
+		return err
+	}
+	for i := 0; i < 20; i++ {
+		if anchorActive() {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return errors.New("proxied slice did not come up")
+}
+
+func anchorActive() bool {
+	_, err := Sys.Run(platform.Cmd{Name: "systemctl", Args: []string{"--user", "is-active", "--quiet", anchorUnit + ".scope"}, Query: true})
+	return err == nil
+}
+
+func runInSlice(argv []string) (int, error) {
+	args := append([]string{"--user", "--scope", "--quiet", "--collect", "--slice=" + ProxiedSlice, "--"}, argv...)
+	// systemd-run --scope execs the command in place, so the PID carries over.
+	return Sys.Start(platform.Cmd{Name: "systemd-run", Args: args})
+}
+
+// ListProcesses returns the calling user's processes.
+func ListProcesses() ([]Process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	uid := os.Getuid()
+	var procs []Process
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if owner(pid) != uid {
+			continue
+		}
+		exe, err := os.Readlink(filepath.Join("/proc", e.Name(), "exe"))
+		if err != nil {
+			continue
+		}
+		procs = append(procs, Process{PID: pid, Exe: exe, Cgroup: processCgroup(pid)})
+	}
+	return procs, nil
+}
+
+func owner(pid int) int {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rest, ok := strings.CutPrefix(sc.Text(), "Uid:"); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				uid, _ := strconv.Atoi(fields[0])
+				return uid
+			}
+		}
+	}
+	return -1
+}
+
+func processCgroup(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::/"); ok {
+			return path
+		}
+	}
+	return ""
+}
+
+// Classify attaches running processes that rules route through the proxy
+// to the proxied slice and returns how many were moved.
+func Classify(c Config) (int, error) {
+	slice, err := SliceCgroup()
+	if err != nil {
+		return 0, err
+	}
+	procs, err := ListProcesses()
+	if err != nil {
+		return 0, err
+	}
+	var pids []string
+	for _, p := range procs {
+		if strings.HasPrefix(p.Cgroup, slice) {
+			continue
+		}
+		if action, ok := c.Decide(p); ok && action == ActionProxy {
+			pids = append(pids, strconv.Itoa(p.PID))
+		}
+	}
+	if len(pids) == 0 {
+		return 0, nil
+	}
+	args := append([]string{"--user", "call", "org.freedesktop.systemd1", "/org/freedesktop/systemd1",
+		"org.freedesktop.systemd1.Manager", "AttachProcessesToUnit", "ssau",
+		anchorUnit + ".scope", "", strconv.Itoa(len(pids))}, pids...)
+	if _, err := Sys.Run(platform.Cmd{Name: "busctl", Args: args}); err != nil {
+		return 0, fmt.Errorf("attach processes: %w", err)
+	}
+	return len(pids), nil
+}
+
+var (
+	classifierMu   sync.Mutex
+	classifierStop chan struct{}
+)
+
+// StartClassifier runs Classify every interval until StopClassifier.
+// Starting it again replaces the running loop.
+func StartClassifier(c Config, interval time.Duration) {
+	StopClassifier()
+	classifierMu.Lock()
+	defer classifierMu.Unlock()
+	stop := make(chan struct{})
+	classifierStop = stop
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			if _, err := Classify(c); err != nil {
+				fmt.Println("Classify processes failed:", err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// StopClassifier stops the loop started by StartClassifier, if any.
+func StopClassifier() {
+	classifierMu.Lock()
+	defer classifierMu.Unlock()
+	if classifierStop != nil {
+		close(classifierStop)
+		classifierStop = nil
+	}
+}
+
+func privilegedStdin(stdin string, args ...string) error {
+	c := asRoot(args)
+	c.Stdin = stdin
+	if _, err := Sys.Run(c); err != nil {
+		return fmt.Errorf("%s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
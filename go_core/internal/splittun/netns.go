@@ -0,0 +1,165 @@
+//go:build linux
+
+package splittun
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"strings"
+
+	"go_core/internal/platform"
+)
+
+const (
+	// Netns is the namespace proxied programs run in.
+	Netns = "xstream-apps"
+	// HostAddr is the host end of the veth pair. Programs in the namespace
+	// reach xray through inbounds listening on it.
+	HostAddr    = "169.254.53.1"
+	hostIf      = "xs-host"
+	nsIf        = "xs-ns"
+	nsAddr      = "169.254.53.2"
+	nftNsTable  = "xstream_appns"
+	vethNetmask = "/30"
+)
+
+func netnsExists() bool {
+	out, err := Sys.Run(platform.Cmd{Name: "ip", Args: []string{"netns", "list"}, Query: true})
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if f := strings.Fields(line); len(f) > 0 && f[0] == Netns {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareNetns creates the namespace and its veth unless they exist, and
+// loads the host side ruleset with no port open.
+func prepareNetns() error {
+	if !netnsExists() {
+		steps := [][]string{
+			{"ip", "netns", "add", Netns},
+			{"ip", "link", "add", hostIf, "type", "veth", "peer", "name", nsIf},
+			{"ip", "link", "set", nsIf, "netns", Netns},
+			{"ip", "addr", "add", HostAddr + vethNetmask, "dev", hostIf},
+			{"ip", "link", "set", hostIf, "up"},
+			{"ip", "-n", Netns, "addr", "add", nsAddr + vethNetmask, "dev", nsIf},
+			{"ip", "-n", Netns, "link", "set", nsIf, "up"},
+			{"ip", "-n", Netns, "link", "set", "lo", "up"},
+			{"ip", "-n", Netns, "route", "add", "default", "via", HostAddr},
+		}
+		for _, s := range steps {
+			if err := privileged(s...); err != nil {
+				disableNetns()
+				return err
+			}
+		}
+	}
+	return privilegedStdin(netnsRuleset(Ports{}), "nft", "-f", "-")
+}
+
+func enableNetns(p Ports) error {
+	if p.Socks == 0 && p.HTTP == 0 {
+		return errors.New("no inbound port to expose to the namespace")
+	}
+	if err := prepareNetns(); err != nil {
+		return err
+	}
+	return privilegedStdin(netnsRuleset(p), "nft", "-f", "-")
+}
+
+// netnsRuleset renders the nft script for the host side of the veth. It
+// only reaches the xray inbounds in p; nothing is forwarded, so the
+// namespace has no other way out.
+func netnsRuleset(p Ports) string {
+	var ports []string
+	for _, port := range []int{p.Socks, p.HTTP} {
+		if port != 0 {
+			ports = append(ports, fmt.Sprint(port))
+		}
+	}
+	var accept string
+	if len(ports) > 0 {
+		set := strings.Join(ports, ", ")
+		accept = fmt.Sprintf("\t\tiifname %[1]q tcp dport { %[2]s } accept\n\t\tiifname %[1]q udp dport { %[2]s } accept\n", hostIf, set)
+	}
+	return fmt.Sprintf(`table inet %[1]s
+delete table inet %[1]s
+table inet %[1]s {
+	chain input {
+		type filter hook input priority -10; policy accept;
+%[3]s		iifname %[2]q drop
+	}
+	chain forward {
+		type filter hook forward priority -10; policy accept;
+		iifname %[2]q drop
+		oifname %[2]q drop
+	}
+}
+`, nftNsTable, hostIf, accept)
+}
+
+func disableNetns() error {
+	var errs []error
+	if tableExists(nftNsTable) {
+		if err := privileged("nft", "delete", "table", "inet", nftNsTable); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if netnsExists() {
+		// Deleting the namespace also removes the veth pair.
+		if err := privileged("ip", "netns", "del", Netns); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// proxyEnv points the usual proxy variables at the host end of the veth.
+func proxyEnv(p Ports) []string {
+	var env []string
+	if p.HTTP != 0 {
+		u := fmt.Sprintf("http://%s:%d", HostAddr, p.HTTP)
+		env = append(env, "http_proxy="+u, "https_proxy="+u, "HTTP_PROXY="+u, "HTTPS_PROXY="+u)
+	}
+	if p.Socks != 0 {
+		// socks5h: the namespace has no DNS, so names resolve at the proxy.
+		u := fmt.Sprintf("socks5h://%s:%d", HostAddr, p.Socks)
+		env = append(env, "all_proxy="+u, "ALL_PROXY="+u)
+	}
+	return env
+}
+
+// sessionEnv is what sudo passes on from the app's environment, so a
+// program started in the namespace finds the desktop session. The rest
+// is reset by sudo; nothing from the environment goes on the command
+// line, which every local user can read.
+var sessionEnv = []string{
+	"HOME", "USER", "LOGNAME", "PATH", "LANG", "LANGUAGE", "LC_ALL", "TERM",
+	"DISPLAY", "WAYLAND_DISPLAY", "XAUTHORITY", "XDG_RUNTIME_DIR",
+	"XDG_SESSION_TYPE", "XDG_CURRENT_DESKTOP", "XDG_DATA_DIRS",
+	"DBUS_SESSION_BUS_ADDRESS",
+}
+
+// runInNetns starts argv in the namespace as the calling user. setpriv
+// keeps the environment it inherits; only the proxy variables, which
+// hold no secrets, are added on the command line.
+func runInNetns(p Ports, argv []string) (int, error) {
+	u, err := user.Current()
+	if err != nil {
+		return 0, err
+	}
+	args := []string{"ip", "netns", "exec", Netns,
+		"setpriv", "--reuid=" + u.Uid, "--regid=" + u.Gid, "--init-groups", "env"}
+	args = append(args, proxyEnv(p)...)
+	args = append(args, argv...)
+	c := asRoot(args)
+	if c.Name == "sudo" {
+		c.Args = append([]string{"--preserve-env=" + strings.Join(sessionEnv, ",")}, c.Args...)
+	}
+	return Sys.Start(c)
+}
@@ -0,0 +1,227 @@
+//go:build linux
+
+// Package splittun routes selected programs through the proxy while the rest
+// of the desktop keeps its normal connectivity.
+//
+// Two mechanisms are supported:
+//
+//   - ModeCgroup: proxied programs run inside xstream-proxied.slice. An
+//     nftables rule marks sockets from that cgroup and a policy routing rule
+//     sends marked packets to the TUN interface. Already running processes
+//     whose executable matches a rule are attached to the slice.
+//   - ModeNetns: proxied programs are started in the xstream-apps network
+//     namespace. Its only link is a veth pair whose host side accepts
+//     nothing but the xray inbound ports, so a program cannot leak even if
+//     it ignores the proxy environment variables it is given.
+package splittun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go_core/internal/platform"
+	"go_core/internal/settings"
+)
+
+// Sys runs the commands that set up routing and start proxied programs.
+// The bridge points it at the dry-run plan while one is active.
+var Sys platform.System = platform.Live{}
+
+// Mode selects the confinement mechanism.
+type Mode string
+
+const (
+	ModeCgroup Mode = "cgroup"
+	ModeNetns  Mode = "netns"
+)
+
+// Action is what happens to a matched process.
+type Action string
+
+const (
+	ActionProxy  Action = "proxy"
+	ActionDirect Action = "direct"
+)
+
+// MatchKind selects which process attribute a rule looks at.
+type MatchKind string
+
+const (
+	// MatchExe compares against the resolved /proc/<pid>/exe path. A
+	// pattern without a slash matches the base name only.
+	MatchExe MatchKind = "exe"
+	// MatchCgroup matches processes whose cgroup path starts with Pattern.
+	MatchCgroup MatchKind = "cgroup"
+)
+
+// Rule selects processes by executable or cgroup.
+type Rule struct {
+	Name    string    `json:"name"`
+	Match   MatchKind `json:"match"`
+	Pattern string    `json:"pattern"`
+	Action  Action    `json:"action"`
+}
+
+// Config is the persisted rule list and mechanism settings.
+type Config struct {
+	Mode         Mode   `json:"mode"`
+	TunInterface string `json:"tunInterface,omitempty"`
+	Rules        []Rule `json:"rules"`
+}
+
+// Ports are the xray inbound ports proxied programs in the namespace
+// reach on HostAddr. They come from the running node's config, since the
+// inbound settings and a port moved at start decide them.
+type Ports struct {
+	Socks int
+	HTTP  int
+}
+
+// Process is the subset of /proc data rules are matched against.
+type Process struct {
+	PID    int
+	Exe    string
+	Cgroup string
+}
+
+const file = "app-rules.json"
+
+// DefaultConfig uses the namespace mechanism, which works without a TUN
+// device.
+func DefaultConfig() Config {
+	return Config{Mode: ModeNetns}
+}
+
+// Load returns the saved config or DefaultConfig.
+func Load() (Config, error) {
+	c := DefaultConfig()
+	err := settings.Load(file, &c)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	return c, c.Validate()
+}
+
+// Save validates and persists c.
+func Save(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return settings.Save(file, c, 0644)
+}
+
+// Validate checks the mode and every rule.
+func (c Config) Validate() error {
+	if c.Mode != ModeCgroup && c.Mode != ModeNetns {
+		return fmt.Errorf("unknown mode %q", c.Mode)
+	}
+	for i, r := range c.Rules {
+		if r.Pattern == "" {
+			return fmt.Errorf("rule %d: empty pattern", i)
+		}
+		if r.Match != MatchExe && r.Match != MatchCgroup {
+			return fmt.Errorf("rule %d: unknown match %q", i, r.Match)
+		}
+		if r.Action != ActionProxy && r.Action != ActionDirect {
+			return fmt.Errorf("rule %d: unknown action %q", i, r.Action)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether r selects p.
+func (r Rule) Matches(p Process) bool {
+	switch r.Match {
+	case MatchExe:
+		if !strings.Contains(r.Pattern, "/") {
+			return filepath.Base(p.Exe) == r.Pattern
+		}
+		return p.Exe == r.Pattern
+	case MatchCgroup:
+		return strings.HasPrefix(p.Cgroup, r.Pattern)
+	}
+	return false
+}
+
+// Decide returns the action for p. Direct rules win over proxy rules so a
+// broad proxy rule can carve out exceptions; unmatched processes are direct.
+func (c Config) Decide(p Process) (Action, bool) {
+	matched := false
+	for _, r := range c.Rules {
+		if !r.Matches(p) {
+			continue
+		}
+		if r.Action == ActionDirect {
+			return ActionDirect, true
+		}
+		matched = true
+	}
+	if matched {
+		return ActionProxy, true
+	}
+	return ActionDirect, false
+}
+
+// Prepare sets up what xray needs before it starts: in ModeNetns the
+// namespace and its veth, with the host side closed until Enable opens
+// the inbound ports. ModeCgroup needs nothing.
+func Prepare(c Config) error {
+	if c.Mode == ModeCgroup {
+		return nil
+	}
+	return prepareNetns()
+}
+
+// Enable installs the mechanism for c.Mode; p is only used by ModeNetns.
+// It is idempotent.
+func Enable(c Config, p Ports) error {
+	if c.Mode == ModeCgroup {
+		return enableCgroup(c)
+	}
+	return enableNetns(p)
+}
+
+// Disable removes everything Enable installed, for both mechanisms.
+func Disable() error {
+	return errors.Join(disableCgroup(), disableNetns())
+}
+
+// RunProxied starts argv through the proxy and returns its PID.
+func RunProxied(c Config, p Ports, argv []string) (int, error) {
+	if len(argv) == 0 || argv[0] == "" {
+		return 0, errors.New("empty command")
+	}
+	if err := Enable(c, p); err != nil {
+		return 0, err
+	}
+	if c.Mode == ModeCgroup {
+		return runInSlice(argv)
+	}
+	return runInNetns(p, argv)
+}
+
+func privileged(args ...string) error {
+	return privilegedStdin("", args...)
+}
+
+// tableExists reports whether the nftables table is loaded.
+func tableExists(table string) bool {
+	c := asRoot([]string{"nft", "list", "table", "inet", table})
+	c.Query = true
+	_, err := Sys.Run(c)
+	return err == nil
+}
+
+// asRoot runs args through sudo -n unless we are root.
+func asRoot(args []string) platform.Cmd {
+	if os.Geteuid() != 0 {
+		return platform.Cmd{Name: "sudo", Args: append([]string{"-n"}, args...)}
+	}
+	return platform.Cmd{Name: args[0], Args: args[1:]}
+}
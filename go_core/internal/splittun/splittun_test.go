@@ -0,0 +1,94 @@
+//go:build linux
+
+package splittun
+
+import "testing"
+
+func TestNetnsRuleset(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports Ports
+		want  string
+	}{
+		{
+			name:  "socks and http",
+			ports: Ports{Socks: 1080, HTTP: 1081},
+			want: `table inet xstream_appns
+delete table inet xstream_appns
+table inet xstream_appns {
+	chain input {
+		type filter hook input priority -10; policy accept;
+		iifname "xs-host" tcp dport { 1080, 1081 } accept
+		iifname "xs-host" udp dport { 1080, 1081 } accept
+		iifname "xs-host" drop
+	}
+	chain forward {
+		type filter hook forward priority -10; policy accept;
+		iifname "xs-host" drop
+		oifname "xs-host" drop
+	}
+}
+`,
+		},
+		{
+			name:  "http only",
+			ports: Ports{HTTP: 8118},
+			want: `table inet xstream_appns
+delete table inet xstream_appns
+table inet xstream_appns {
+	chain input {
+		type filter hook input priority -10; policy accept;
+		iifname "xs-host" tcp dport { 8118 } accept
+		iifname "xs-host" udp dport { 8118 } accept
+		iifname "xs-host" drop
+	}
+	chain forward {
+		type filter hook forward priority -10; policy accept;
+		iifname "xs-host" drop
+		oifname "xs-host" drop
+	}
+}
+`,
+		},
+		{
+			name: "closed",
+			want: `table inet xstream_appns
+delete table inet xstream_appns
+table inet xstream_appns {
+	chain input {
+		type filter hook input priority -10; policy accept;
+		iifname "xs-host" drop
+	}
+	chain forward {
+		type filter hook forward priority -10; policy accept;
+		iifname "xs-host" drop
+		oifname "xs-host" drop
+	}
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := netnsRuleset(tt.ports); got != tt.want {
+				t.Errorf("netnsRuleset() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCgroupRuleset(t *testing.T) {
+	got := cgroupRuleset("user.slice/user-1000.slice/user@1000.service/xstream.slice/xstream-proxied.slice")
+	want := `table inet xstream_apps
+delete table inet xstream_apps
+table inet xstream_apps {
+	chain output {
+		type route hook output priority mangle; policy accept;
+		socket cgroupv2 level 5 "user.slice/user-1000.slice/user@1000.service/xstream.slice/xstream-proxied.slice" meta mark set 0x5853
+	}
+}
+`
+	if got != want {
+		t.Errorf("cgroupRuleset() =\n%s\nwant:\n%s", got, want)
+	}
+}
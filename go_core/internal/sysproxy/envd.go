@@ -0,0 +1,43 @@
+//go:build linux
+
+package sysproxy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// envdPath is the systemd environment.d snippet picked up by the user
+// session on next login and by `systemctl --user` managed programs.
+func envdPath() string {
+	return filepath.Join(configHome(), "environment.d", "90-xstream-proxy.conf")
+}
+
+func envdApply(s Settings) error {
+	var b strings.Builder
+	b.WriteString("# Managed by Xstream; removed when the proxy is turned off.\n")
+	write := func(key, value string) {
+		if value == "" {
+			return
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, value)
+		fmt.Fprintf(&b, "%s=%s\n", strings.ToUpper(key), value)
+	}
+	switch s.Mode {
+	case ModeManual:
+		if s.HTTPPort != 0 {
+			write("http_proxy", fmt.Sprintf("http://%s:%d", s.Host, s.HTTPPort))
+		}
+		if s.HTTPSPort != 0 {
+			write("https_proxy", fmt.Sprintf("http://%s:%d", s.Host, s.HTTPSPort))
+		}
+		if s.SocksPort != 0 {
+			write("all_proxy", fmt.Sprintf("socks5://%s:%d", s.Host, s.SocksPort))
+		}
+		write("no_proxy", strings.Join(s.Bypass, ","))
+	case ModeAuto:
+		// environment variables have no PAC equivalent.
+	}
+	return writeFile(envdPath(), []byte(b.String()), 0644)
+}
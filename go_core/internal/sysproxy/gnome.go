@@ -0,0 +1,162 @@
+//go:build linux
+
+package sysproxy
+
+import (
+	"strconv"
+	"strings"
+)
+
+type gnomeKey struct {
+	schema string
+	key    string
+}
+
+// gnomeKeys lists every key Apply may touch, in the order it restores them.
+var gnomeKeys = []gnomeKey{
+	{"org.gnome.system.proxy", "mode"},
+	{"org.gnome.system.proxy", "autoconfig-url"},
+	{"org.gnome.system.proxy", "ignore-hosts"},
+	{"org.gnome.system.proxy.http", "host"},
+	{"org.gnome.system.proxy.http", "port"},
+	{"org.gnome.system.proxy.https", "host"},
+	{"org.gnome.system.proxy.https", "port"},
+	{"org.gnome.system.proxy.socks", "host"},
+	{"org.gnome.system.proxy.socks", "port"},
+}
+
+func (k gnomeKey) id() string { return k.schema + " " + k.key }
+
+// dconfPath maps a schema key onto its dconf location, e.g.
+// org.gnome.system.proxy.http host -> /system/proxy/http/host.
+func (k gnomeKey) dconfPath() string {
+	rel := strings.TrimPrefix(k.schema, "org.gnome")
+	return strings.ReplaceAll(rel, ".", "/") + "/" + k.key
+}
+
+// gnomeTool returns the command used to reach the GNOME proxy settings:
+// gsettings when the schema is installed, dconf otherwise.
+func gnomeTool() string {
+	if hasCommand("gsettings") {
+		if _, err := query("gsettings", "list-keys", "org.gnome.system.proxy"); err == nil {
+			return "gsettings"
+		}
+	}
+	if hasCommand("dconf") {
+		return "dconf"
+	}
+	return ""
+}
+
+func gnomeGet(via string, k gnomeKey) (string, error) {
+	if via == "dconf" {
+		out, err := query("dconf", "read", k.dconfPath())
+		return strings.TrimSpace(out), err
+	}
+	out, err := query("gsettings", "get", k.schema, k.key)
+	return strings.TrimSpace(out), err
+}
+
+// gnomeSet writes a GVariant literal. An empty value under dconf means the
+// key was unset before, so it is reset rather than written.
+func gnomeSet(via string, k gnomeKey, value string) error {
+	if via == "dconf" {
+		if value == "" {
+			_, err := run("dconf", "reset", k.dconfPath())
+			return err
+		}
+		_, err := run("dconf", "write", k.dconfPath(), value)
+		return err
+	}
+	_, err := run("gsettings", "set", k.schema, k.key, value)
+	return err
+}
+
+// gnomeSnapshot reads the current GNOME proxy keys. Without either tool
+// there is nothing to save; a key that cannot be read fails the snapshot,
+// since applying over it would lose the user's setting for good.
+func gnomeSnapshot() (map[string]string, string, error) {
+	via := gnomeTool()
+	if via == "" {
+		return nil, "", nil
+	}
+	saved := make(map[string]string, len(gnomeKeys))
+	for _, k := range gnomeKeys {
+		v, err := gnomeGet(via, k)
+		if err != nil {
+			return nil, "", err
+		}
+		saved[k.id()] = v
+	}
+	return saved, via, nil
+}
+
+func gnomeApply(s Settings) error {
+	via := gnomeTool()
+	if via == "" {
+		return nil
+	}
+	values := map[string]string{
+		"org.gnome.system.proxy mode": gvString(string(s.Mode)),
+	}
+	switch s.Mode {
+	case ModeManual:
+		values["org.gnome.system.proxy ignore-hosts"] = gvStringArray(s.Bypass)
+		setEndpoint := func(schema string, port int) {
+			host := s.Host
+			if port == 0 {
+				host = ""
+			}
+			values[schema+" host"] = gvString(host)
+			values[schema+" port"] = strconv.Itoa(port)
+		}
+		setEndpoint("org.gnome.system.proxy.http", s.HTTPPort)
+		setEndpoint("org.gnome.system.proxy.https", s.HTTPSPort)
+		setEndpoint("org.gnome.system.proxy.socks", s.SocksPort)
+	case ModeAuto:
+		values["org.gnome.system.proxy autoconfig-url"] = gvString(s.Host)
+	}
+	for _, k := range gnomeKeys {
+		v, ok := values[k.id()]
+		if !ok {
+			continue
+		}
+		if err := gnomeSet(via, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gnomeRestore(saved map[string]string, via string) error {
+	if len(saved) == 0 || via == "" {
+		return nil
+	}
+	for _, k := range gnomeKeys {
+		v, ok := saved[k.id()]
+		if !ok {
+			continue
+		}
+		if err := gnomeSet(via, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gvString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+func gvStringArray(items []string) string {
+	if len(items) == 0 {
+		return "@as []"
+	}
+	quoted := make([]string, len(items))
+	for i, it := range items {
+		quoted[i] = gvString(it)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
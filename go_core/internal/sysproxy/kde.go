@@ -0,0 +1,126 @@
+//go:build linux
+
+package sysproxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const kdeSection = "Proxy Settings"
+
+func kdeConfigPath() string {
+	return filepath.Join(configHome(), "kioslaverc")
+}
+
+func kdeApply(s Settings) error {
+	path := kdeConfigPath()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	values := map[string]string{}
+	switch s.Mode {
+	case ModeNone:
+		values["ProxyType"] = "0"
+	case ModeManual:
+		values["ProxyType"] = "1"
+		values["httpProxy"] = kdeEndpoint("http", s.Host, s.HTTPPort)
+		values["httpsProxy"] = kdeEndpoint("http", s.Host, s.HTTPSPort)
+		values["socksProxy"] = kdeEndpoint("socks", s.Host, s.SocksPort)
+		values["NoProxyFor"] = strings.Join(s.Bypass, ",")
+		values["ReversedException"] = "false"
+	case ModeAuto:
+		values["ProxyType"] = "2"
+		values["Proxy Config Script"] = s.Host
+	}
+	updated := setINIValues(string(data), kdeSection, values)
+	if err := writeFile(path, []byte(updated), 0644); err != nil {
+		return err
+	}
+	kdeNotify()
+	return nil
+}
+
+// kdeEndpoint uses KIO's "scheme://host port" notation.
+func kdeEndpoint(scheme, host string, port int) string {
+	if port == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s %d", scheme, host, port)
+}
+
+// kdeNotify asks running KIO workers to re-read kioslaverc. It is best
+// effort: outside a KDE session nobody is listening.
+func kdeNotify() {
+	if hasCommand("dbus-send") {
+		run("dbus-send", "--type=signal", "/KIO/Scheduler",
+			"org.kde.KIO.Scheduler.reparseSlaveConfiguration", "string:")
+	}
+}
+
+// setINIValues rewrites keys inside section, appending the section or any
+// missing keys, and leaves every other line untouched.
+func setINIValues(content, section string, values map[string]string) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+	header := "[" + section + "]"
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if start < 0 {
+			if trimmed == header {
+				start = i
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			end = i
+			break
+		}
+	}
+	done := map[string]bool{}
+	if start >= 0 {
+		for i := start + 1; i < end; i++ {
+			key, _, ok := strings.Cut(lines[i], "=")
+			if !ok {
+				continue
+			}
+			key = strings.TrimSpace(key)
+			if v, found := values[key]; found {
+				lines[i] = key + "=" + v
+				done[key] = true
+			}
+		}
+	} else {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, header)
+		start, end = len(lines)-1, len(lines)
+	}
+	var missing []string
+	for _, key := range sortedKeys(values) {
+		if !done[key] {
+			missing = append(missing, key+"="+values[key])
+		}
+	}
+	out := append([]string{}, lines[:end]...)
+	out = append(out, missing...)
+	out = append(out, lines[end:]...)
+	return strings.Join(out, "\n") + "\n"
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,284 @@
+//go:build linux
+
+// Package sysproxy points the Linux desktop proxy settings at the local xray
+// inbounds and puts the user's previous settings back afterwards.
+package sysproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go_core/internal/platform"
+	"go_core/internal/settings"
+)
+
+// Sys applies the setting changes. The bridge swaps it for a dry-run
+// plan's System.
+var Sys platform.System = platform.Live{}
+
+// Mode selects how desktop applications should reach the proxy.
+type Mode string
+
+const (
+	ModeNone   Mode = "none"
+	ModeManual Mode = "manual"
+	// ModeAuto hands applications a PAC URL instead of fixed endpoints.
+	ModeAuto Mode = "auto"
+)
+
+// Settings describes the proxy configuration to apply.
+type Settings struct {
+	Mode Mode
+	// Host is the proxy address for ModeManual and the PAC URL for ModeAuto.
+	Host      string
+	HTTPPort  int
+	HTTPSPort int
+	SocksPort int
+	Bypass    []string
+}
+
+// backup holds everything needed to undo Apply exactly.
+type backup struct {
+	Gnome    map[string]string `json:"gnome,omitempty"`
+	GnomeVia string            `json:"gnomeVia,omitempty"`
+	KDE      *fileBackup       `json:"kde,omitempty"`
+	EnvD     *fileBackup       `json:"envd,omitempty"`
+}
+
+type fileBackup struct {
+	Existed bool   `json:"existed"`
+	Content string `json:"content"`
+}
+
+var mu sync.Mutex
+
+// ParsePorts reads a list such as "http=1081,https=1081,socks=1080" into s.
+// A bare number is taken as the HTTP port.
+func (s *Settings) ParsePorts(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, val, found := strings.Cut(part, "=")
+		if !found {
+			key, val = "http", part
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %q", part)
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "http":
+			s.HTTPPort = port
+		case "https":
+			s.HTTPSPort = port
+		case "socks", "socks5":
+			s.SocksPort = port
+		default:
+			return fmt.Errorf("unknown proxy type %q", key)
+		}
+	}
+	if s.HTTPSPort == 0 {
+		s.HTTPSPort = s.HTTPPort
+	}
+	return nil
+}
+
+// ParseBypass splits a comma or newline separated host list.
+func ParseBypass(spec string) []string {
+	var out []string
+	for _, h := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if h = strings.TrimSpace(h); h != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func (s Settings) validate() error {
+	switch s.Mode {
+	case ModeNone:
+		return nil
+	case ModeManual:
+		if s.Host == "" {
+			return errors.New("proxy host is empty")
+		}
+		if s.HTTPPort == 0 && s.SocksPort == 0 {
+			return errors.New("no proxy port configured")
+		}
+	case ModeAuto:
+		if s.Host == "" {
+			return errors.New("PAC URL is empty")
+		}
+	default:
+		return fmt.Errorf("unknown proxy mode %q", s.Mode)
+	}
+	return nil
+}
+
+// Apply saves the current desktop proxy settings, unless a backup from an
+// earlier Apply is still pending, and then writes s to every backend.
+func Apply(s Settings) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	b, err := loadBackup()
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		b = &backup{}
+		if b.Gnome, b.GnomeVia, err = gnomeSnapshot(); err != nil {
+			return fmt.Errorf("gnome: save current settings: %w", err)
+		}
+		if b.KDE, err = snapshotFile(kdeConfigPath()); err != nil {
+			return err
+		}
+		if b.EnvD, err = snapshotFile(envdPath()); err != nil {
+			return err
+		}
+		if err := saveBackup(b); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	if err := gnomeApply(s); err != nil {
+		errs = append(errs, fmt.Errorf("gnome: %w", err))
+	}
+	if err := kdeApply(s); err != nil {
+		errs = append(errs, fmt.Errorf("kde: %w", err))
+	}
+	if err := envdApply(s); err != nil {
+		errs = append(errs, fmt.Errorf("environment.d: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Restore puts back the settings saved by Apply. It is a no-op when nothing
+// has been applied, so it is safe to call on every node stop.
+func Restore() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	b, err := loadBackup()
+	if err != nil || b == nil {
+		return err
+	}
+	var errs []error
+	if err := gnomeRestore(b.Gnome, b.GnomeVia); err != nil {
+		errs = append(errs, fmt.Errorf("gnome: %w", err))
+	}
+	if b.KDE != nil {
+		if err := restoreFile(kdeConfigPath(), b.KDE); err != nil {
+			errs = append(errs, fmt.Errorf("kde: %w", err))
+		}
+		kdeNotify()
+	}
+	if b.EnvD != nil {
+		if err := restoreFile(envdPath(), b.EnvD); err != nil {
+			errs = append(errs, fmt.Errorf("environment.d: %w", err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return Sys.Remove(backupPath())
+}
+
+// Active reports whether a proxy applied by Apply is still in place.
+func Active() bool {
+	_, err := os.Stat(backupPath())
+	return err == nil
+}
+
+func configHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config")
+}
+
+func backupPath() string {
+	return settings.Path("sysproxy-backup.json")
+}
+
+func loadBackup() (*backup, error) {
+	data, err := os.ReadFile(backupPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var b backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("corrupt proxy backup: %w", err)
+	}
+	return &b, nil
+}
+
+func saveBackup(b *backup) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(backupPath(), data, 0600)
+}
+
+func snapshotFile(path string) (*fileBackup, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &fileBackup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileBackup{Existed: true, Content: string(data)}, nil
+}
+
+func restoreFile(path string, fb *fileBackup) error {
+	if !fb.Existed {
+		return Sys.Remove(path)
+	}
+	return writeFile(path, []byte(fb.Content), 0644)
+}
+
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	return Sys.WriteFile(path, data, perm)
+}
+
+// run changes a desktop setting; query only reads one and so also runs
+// while a dry-run plan is recording.
+func run(name string, args ...string) (string, error) {
+	return command(platform.Cmd{Name: name, Args: args})
+}
+
+func query(name string, args ...string) (string, error) {
+	return command(platform.Cmd{Name: name, Args: args, Query: true})
+}
+
+func command(c platform.Cmd) (string, error) {
+	out, err := Sys.Run(c)
+	if err != nil {
+		return out, fmt.Errorf("%s %s: %w", c.Name, strings.Join(c.Args, " "), err)
+	}
+	return out, nil
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
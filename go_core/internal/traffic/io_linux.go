@@ -0,0 +1,22 @@
+package traffic
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readBytes returns rchar from /proc/<pid>/io, which counts socket reads.
+func readBytes(pid int) (uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "rchar:"); ok {
+			return strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("/proc/%d/io: no rchar", pid)
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !windows
+
+package traffic
+
+func readBytes(pid int) (uint64, error) {
+	return 0, ErrUnsupported
+}
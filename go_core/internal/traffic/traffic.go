@@ -0,0 +1,59 @@
+// Package traffic estimates the throughput of the xray process from its
+// I/O counters. A proxy reads every byte it relays once, from the client
+// or from the server, so the read rate approximates upload plus download
+// without needing the xray stats API.
+package traffic
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnsupported is returned where per-process counters are unavailable.
+var ErrUnsupported = errors.New("process I/O counters not supported")
+
+// Meter turns successive readings of one process into a rate.
+type Meter struct {
+	pid   int
+	bytes uint64
+	at    time.Time
+}
+
+// Sample reads pid's counters and returns bytes per second since the last
+// sample. The first sample of a process returns 0.
+func (m *Meter) Sample(pid int) (float64, error) {
+	n, err := readBytes(pid)
+	if err != nil {
+		m.pid = 0
+		return 0, err
+	}
+	now := time.Now()
+	var rate float64
+	if m.pid == pid && n >= m.bytes {
+		if dt := now.Sub(m.at).Seconds(); dt > 0 {
+			rate = float64(n-m.bytes) / dt
+		}
+	}
+	m.pid, m.bytes, m.at = pid, n, now
+	return rate, nil
+}
+
+// Reset forgets the last sample.
+func (m *Meter) Reset() {
+	m.pid = 0
+}
+
+// Format renders a rate like "1.2 MB/s".
+func Format(rate float64) string {
+	units := []string{"B/s", "KB/s", "MB/s", "GB/s"}
+	i := 0
+	for rate >= 1024 && i < len(units)-1 {
+		rate /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", rate, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", rate, units[i])
+}
@@ -0,0 +1,146 @@
+// Package xrayconf reads and rewrites the parts of an xray JSON config that
+// go_core needs to reason about, leaving everything else untouched.
+package xrayconf
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+)
+
+// Config is a decoded xray config. Sections go_core does not manage are kept
+// as raw JSON so a round trip does not lose fields.
+type Config map[string]json.RawMessage
+
+// Load reads an xray config from disk.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes an xray config.
+func Parse(data []byte) (Config, error) {
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Marshal encodes the config with the indentation the Dart templates use.
+func (c Config) Marshal() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+type server struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+type outbound struct {
+	Protocol string `json:"protocol"`
+	Tag      string `json:"tag"`
+	Settings struct {
+		Vnext   []server `json:"vnext"`
+		Servers []server `json:"servers"`
+	} `json:"settings"`
+}
+
+// ServerAddresses lists the remote proxy servers the outbounds dial, in
+// config order and without duplicates. DNS and freedom outbounds are skipped.
+func (c Config) ServerAddresses() []string {
+	return c.servers(func(s server) string { return s.Address })
+}
+
+// ServerEndpoints is ServerAddresses with ports, as "host:port".
+func (c Config) ServerEndpoints() []string {
+	return c.servers(func(s server) string {
+		if s.Address == "" {
+			return ""
+		}
+		return net.JoinHostPort(s.Address, strconv.Itoa(s.Port))
+	})
+}
+
+func (c Config) servers(key func(server) string) []string {
+	var outs []outbound
+	if raw, ok := c["outbounds"]; ok {
+		json.Unmarshal(raw, &outs)
+	}
+	seen := map[string]bool{}
+	var addrs []string
+	add := func(a string) {
+		if a != "" && !seen[a] {
+			seen[a] = true
+			addrs = append(addrs, a)
+		}
+	}
+	for _, o := range outs {
+		if o.Protocol == "dns" || o.Protocol == "freedom" || o.Protocol == "blackhole" {
+			continue
+		}
+		for _, v := range o.Settings.Vnext {
+			add(key(v))
+		}
+		for _, s := range o.Settings.Servers {
+			add(key(s))
+		}
+	}
+	return addrs
+}
+
+// Section decodes the named top-level section into v. A missing section
+// leaves v untouched.
+func (c Config) Section(name string, v any) error {
+	raw, ok := c[name]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// SetSection replaces the named top-level section with v.
+func (c Config) SetSection(name string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c[name] = raw
+	return nil
+}
+
+// Inbound is the part of an xray inbound go_core inspects.
+type Inbound struct {
+	Tag      string `json:"tag,omitempty"`
+	Listen   string `json:"listen,omitempty"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// Inbounds lists the configured inbounds.
+func (c Config) Inbounds() []Inbound {
+	var ins []Inbound
+	c.Section("inbounds", &ins)
+	return ins
+}
+
+// RemapPorts changes the port of every inbound listening on a key of m to
+// the mapped value.
+func (c Config) RemapPorts(m map[int]int) error {
+	var ins []map[string]any
+	if err := c.Section("inbounds", &ins); err != nil {
+		return err
+	}
+	for _, in := range ins {
+		if p, ok := in["port"].(float64); ok {
+			if to, ok := m[int(p)]; ok {
+				in["port"] = to
+			}
+		}
+	}
+	return c.SetSection("inbounds", ins)
+}
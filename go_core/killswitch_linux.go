@@ -0,0 +1,134 @@
+//go:build linux
+
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+
+	"go_core/internal/killswitch"
+	"go_core/internal/platform"
+	"go_core/internal/xrayconf"
+)
+
+func init() {
+	killswitch.Sys = system{}
+	register("killswitch.set", func(p json.RawMessage) (any, error) {
+		var o killswitch.Options
+		if err := decode(p, &o); err != nil {
+			return nil, err
+		}
+		return nil, setKillSwitch(o)
+	})
+	register("killswitch.get", func(json.RawMessage) (any, error) {
+		return getKillSwitch()
+	})
+	register("killswitch.recover", func(json.RawMessage) (any, error) {
+		return recoverKillSwitch()
+	})
+}
+
+//export SetKillSwitch
+func SetKillSwitch(optionsC *C.char) *C.char {
+	var o killswitch.Options
+	if err := json.Unmarshal([]byte(C.GoString(optionsC)), &o); err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(nil, setKillSwitch(o))
+}
+
+func setKillSwitch(o killswitch.Options) error {
+	if err := killswitch.SaveOptions(o); err != nil {
+		return err
+	}
+	if !o.Enabled {
+		if err := killswitch.Release(o); err != nil {
+			return fail(codeKillSwitch, err)
+		}
+	}
+	return nil
+}
+
+//export GetKillSwitch
+func GetKillSwitch() *C.char {
+	return legacy(getKillSwitch())
+}
+
+func getKillSwitch() (any, error) {
+	o, err := killswitch.LoadOptions()
+	if err != nil {
+		return nil, err
+	}
+	engaged, err := killswitch.Engaged(o)
+	if err != nil {
+		return nil, fail(codeKillSwitch, err)
+	}
+	return struct {
+		killswitch.Options
+		Engaged bool   `json:"engaged"`
+		Owner   string `json:"owner,omitempty"`
+	}{o, engaged, killswitch.Owner()}, nil
+}
+
+// RecoverKillSwitch lifts a table left behind by a previous crash. The app
+// calls it on startup before offering to connect.
+//
+//export RecoverKillSwitch
+func RecoverKillSwitch() *C.char {
+	return legacy(recoverKillSwitch())
+}
+
+func recoverKillSwitch() (any, error) {
+	o, err := killswitch.LoadOptions()
+	if err != nil {
+		return nil, err
+	}
+	released, err := killswitch.Recover(o, serviceActive)
+	if err != nil {
+		return nil, fail(codeKillSwitch, err)
+	}
+	if released {
+		return notice("kill switch released"), nil
+	}
+	return nil, nil
+}
+
+func engageKillSwitch(service string) error {
+	o, err := killswitch.LoadOptions()
+	if err != nil || !o.Enabled {
+		return err
+	}
+	cfgPath, err := serviceManager.ConfigPath(service)
+	if err != nil {
+		return err
+	}
+	cfg, err := xrayconf.Load(cfgPath)
+	if err != nil {
+		return err
+	}
+	servers, err := killswitch.Resolve(cfg.ServerAddresses())
+	if err != nil {
+		return err
+	}
+	// Without systemd there is no unit cgroup; the server rules still
+	// let xray through.
+	var cgroup string
+	if s, ok := serviceManager.(platform.Systemd); ok {
+		cgroup = s.Cgroup(service)
+	}
+	return killswitch.Engage(o, service, killswitch.Rules{
+		Servers: servers,
+		Cgroup:  cgroup,
+	})
+}
+
+func releaseKillSwitch() {
+	o, err := killswitch.LoadOptions()
+	if err == nil {
+		err = killswitch.Release(o)
+	}
+	if err != nil {
+		fmt.Println("Release kill switch failed:", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go_core/internal/host"
+	"go_core/internal/netrules"
+	"go_core/internal/nodelist"
+)
+
+// netRulesTick is how often schedule rules are checked.
+const netRulesTick = time.Minute
+
+// netRules holds the rule that was last acted on. Rules act when the
+// matching rule changes, not on every check, so a node the user stops on
+// an untrusted network stays stopped until the network or time changes.
+var netRules struct {
+	sync.Mutex
+	once    sync.Once
+	applied string
+	// applying serialises applyNetRules, which the ticker, network
+	// changes and netrules.set all call, so two checks cannot both
+	// start or stop nodes.
+	applying sync.Mutex
+}
+
+func init() {
+	register("netrules.get", func(json.RawMessage) (any, error) {
+		return netrules.Load()
+	})
+	register("netrules.set", func(p json.RawMessage) (any, error) {
+		var c netrules.Config
+		if err := decode(p, &c); err != nil {
+			return nil, err
+		}
+		if err := c.Validate(); err != nil {
+			return nil, fail(codeInvalidParams, err)
+		}
+		if err := netrules.Save(c); err != nil {
+			return nil, err
+		}
+		netRules.Lock()
+		netRules.applied = ""
+		netRules.Unlock()
+		startNetRules()
+		return nil, nil
+	})
+	// The network as rules see it, e.g. to fill a rule from the current
+	// Wi-Fi.
+	register("netrules.state", func(json.RawMessage) (any, error) {
+		return netrules.Current(), nil
+	})
+}
+
+// startNetRules evaluates the rules now and, once, starts checking them on
+// network changes and, while a rule has a schedule, every minute. Only the
+// running instance does this.
+func startNetRules() {
+	c, err := netrules.Load()
+	if err != nil {
+		fmt.Println("Load network rules failed:", err)
+		return
+	}
+	if !c.Enabled {
+		return
+	}
+	startNetworkMonitor()
+	netRules.once.Do(func() {
+		go func() {
+			for range time.Tick(netRulesTick) {
+				// Without a schedule only the network changes a result,
+				// and the monitor reports that.
+				if c, err := netrules.Load(); err == nil && c.HasSchedule() {
+					applyNetRules()
+				}
+			}
+		}()
+	})
+	go applyNetRules()
+}
+
+// applyNetRules acts on the first matching rule if it is not the one last
+// acted on. A rule that failed to act is tried again on the next check.
+// Nothing is done in dry-run mode.
+func applyNetRules() {
+	netRules.applying.Lock()
+	defer netRules.applying.Unlock()
+	c, err := netrules.Load()
+	if err != nil || !c.Enabled || activePlan() != nil {
+		return
+	}
+	rule := c.Evaluate(netrules.Current(), time.Now())
+	key := ""
+	if rule != nil {
+		key = rule.Name
+	}
+	netRules.Lock()
+	changed := key != netRules.applied
+	netRules.Unlock()
+	if !changed {
+		return
+	}
+	if rule == nil {
+		setNetRuleApplied(key)
+		return
+	}
+	active := runningNode()
+	switch {
+	case rule.Action == netrules.ActionDisconnect && active != "":
+		err = stopNode(active)
+	case rule.Action == netrules.ActionConnect && active != rule.Node:
+		if active != "" {
+			err = stopNode(active)
+		}
+		if err == nil {
+			_, err = startNode(rule.Node)
+		}
+	default:
+		setNetRuleApplied(key)
+		return
+	}
+	if err != nil {
+		fmt.Println("Apply network rule failed:", err)
+		emit("netrules.failed", map[string]string{"rule": rule.Name, "action": rule.Action, "node": rule.Node, "error": err.Error()})
+		return
+	}
+	setNetRuleApplied(key)
+	emit("netrules.applied", map[string]string{"rule": rule.Name, "action": rule.Action, "node": rule.Node})
+}
+
+func setNetRuleApplied(key string) {
+	netRules.Lock()
+	netRules.applied = key
+	netRules.Unlock()
+}
+
+// runningNode is the node that is running, checking the one startNode last
+// started first.
+func runningNode() string {
+	nodeWatch.Lock()
+	service := nodeWatch.service
+	nodeWatch.Unlock()
+	if service != "" && serviceActive(service) {
+		return service
+	}
+	nodes, _ := nodelist.Load(host.NodesFile())
+	for _, n := range nodes {
+		if serviceActive(n.ServiceName) {
+			return n.ServiceName
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go_core/internal/netmon"
+	"go_core/internal/platform"
+)
+
+const (
+	// netDebounce is how long the network must be quiet before a change
+	// is acted on.
+	netDebounce = 3 * time.Second
+	// netSettle is how long after a node (re)starts route changes are
+	// taken as its own, e.g. the kill switch or TUN mode setting up.
+	netSettle = 10 * time.Second
+)
+
+var netWatch struct {
+	sync.Mutex
+	once    sync.Once
+	route   netmon.Route
+	settled time.Time
+}
+
+// startNetworkMonitor starts watching for network changes once a node
+// has been started or network rules are on, and marks the routes the
+// start sets up as expected.
+func startNetworkMonitor() {
+	netWatch.Lock()
+	netWatch.settled = time.Now().Add(netSettle)
+	netWatch.Unlock()
+	netWatch.once.Do(func() {
+		netWatch.route, _ = netmon.DefaultRoute()
+		if err := netmon.Watch(netDebounce, onNetworkChange); err != nil {
+			fmt.Println("Watch network failed:", err)
+		}
+	})
+}
+
+// onNetworkChange checks the network rules, then restarts the running node
+// when the default route moved or the machine resumed, so xray drops
+// connections over the old link.
+func onNetworkChange(c netmon.Change) {
+	applyNetRules()
+	netWatch.Lock()
+	moved := c.Route != netWatch.route
+	netWatch.route = c.Route
+	settling := time.Now().Before(netWatch.settled)
+	netWatch.Unlock()
+	if settling || (!moved && c.Reason != netmon.ReasonResume) {
+		return
+	}
+	emit("network.changed", c)
+	nodeWatch.Lock()
+	service := nodeWatch.service
+	nodeWatch.Unlock()
+	if service == "" || c.Interface == "" || activePlan() != nil || !serviceActive(service) {
+		return
+	}
+	netWatch.Lock()
+	netWatch.settled = time.Now().Add(netSettle)
+	netWatch.Unlock()
+	if err := serviceManager.(platform.Restarter).TryRestart(service); err != nil {
+		fmt.Println("Restart node after network change failed:", err)
+	}
+}
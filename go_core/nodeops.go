@@ -0,0 +1,183 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go_core/internal/host"
+	"go_core/internal/nodelist"
+	"go_core/internal/platform"
+	"go_core/internal/traffic"
+)
+
+// nodeInfo is a node of the list with its service's state.
+type nodeInfo struct {
+	Name        string `json:"name"`
+	CountryCode string `json:"countryCode"`
+	Service     string `json:"service"`
+	ConfigPath  string `json:"configPath"`
+	Status      string `json:"status"`
+}
+
+// importParams is a node to add from a ready xray config. CountryCode
+// defaults to the name's first dash-separated part, as in the app.
+type importParams struct {
+	Name        string          `json:"name"`
+	CountryCode string          `json:"countryCode"`
+	Config      json.RawMessage `json:"config"`
+}
+
+// nodeStats samples the throughput of the running node between calls.
+var nodeStats struct {
+	sync.Mutex
+	service string
+	meter   traffic.Meter
+}
+
+func init() {
+	register("node.list", func(json.RawMessage) (any, error) {
+		return listNodes()
+	})
+	register("node.import", func(p json.RawMessage) (any, error) {
+		var args importParams
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return importNode(args)
+	})
+	register("node.remove", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Name string `json:"name"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return nil, removeNode(args.Name)
+	})
+	register("node.logs", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Service string `json:"service"`
+			Lines   int    `json:"lines"`
+			Cursor  string `json:"cursor"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		logs, ok := serviceManager.(platform.LogReader)
+		if !ok {
+			return nil, fail(codeUnsupported, fmt.Errorf("%s keeps no service logs", serviceManager.Name()))
+		}
+		if args.Lines <= 0 {
+			args.Lines = 100
+		}
+		entries, cursor, err := logs.Logs(args.Service, args.Lines, args.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"entries": entries, "cursor": cursor}, nil
+	})
+	register("node.stats", func(json.RawMessage) (any, error) {
+		return sampleNodeStats(), nil
+	})
+}
+
+func listNodes() ([]nodeInfo, error) {
+	nodes, err := nodelist.Load(host.NodesFile())
+	if err != nil {
+		return nil, err
+	}
+	list := make([]nodeInfo, 0, len(nodes))
+	for _, n := range nodes {
+		list = append(list, nodeInfo{
+			Name:        n.Name,
+			CountryCode: n.CountryCode,
+			Service:     n.ServiceName,
+			ConfigPath:  n.ConfigPath,
+			Status:      services().Status(n.ServiceName).String(),
+		})
+	}
+	return list, nil
+}
+
+// sampleNodeStats reports the running node and its throughput since the
+// last call; the first call after a node starts has no rate yet.
+func sampleNodeStats() map[string]any {
+	service := runningNode()
+	stats := map[string]any{"service": service, "connected": service != ""}
+	nodeStats.Lock()
+	defer nodeStats.Unlock()
+	if service != nodeStats.service {
+		nodeStats.service = service
+		nodeStats.meter.Reset()
+	}
+	p, ok := serviceManager.(platform.PIDer)
+	if !ok || service == "" {
+		return stats
+	}
+	if pid, err := p.MainPID(service); err == nil {
+		if rate, err := nodeStats.meter.Sample(pid); err == nil {
+			stats["rate"] = rate
+			stats["rateText"] = traffic.Format(rate)
+		}
+	}
+	return stats
+}
+
+// importNode validates the config, applies the routing and inbound
+// settings as config.write does and adds the node.
+func importNode(args importParams) (any, error) {
+	if args.Name == "" {
+		return nil, fail(codeInvalidParams, fmt.Errorf("name is required"))
+	}
+	code := strings.ToLower(args.CountryCode)
+	if code == "" {
+		code = host.NodeCode(args.Name)
+	}
+	if !host.ValidCode(code) {
+		return nil, fail(codeInvalidParams, fmt.Errorf("invalid country code %q", code))
+	}
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(args.Config, &cfg); err != nil || cfg == nil {
+		return nil, fail(codeInvalidParams, fmt.Errorf("config must be an xray JSON object"))
+	}
+	content, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	xrayContent, err := applyRouting(string(content))
+	if err == nil {
+		xrayContent, err = applyInbounds(xrayContent)
+	}
+	if err != nil {
+		return nil, err
+	}
+	n, err := host.ImportNode(services(), writer(nodeWriter), args.Name, code, []byte(xrayContent))
+	if err != nil {
+		return nil, err
+	}
+	updateTray()
+	return map[string]string{"service": n.ServiceName, "configPath": n.ConfigPath}, nil
+}
+
+// removeNode stops the node if it runs and drops it from the list.
+func removeNode(name string) error {
+	nodes, err := nodelist.Load(host.NodesFile())
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if n.Name == name && serviceActive(n.ServiceName) {
+			if err := stopNode(n.ServiceName); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := host.RemoveNode(writer(nodeWriter), name); err != nil {
+		return err
+	}
+	updateTray()
+	return nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"go_core/internal/host"
+	"go_core/internal/notify"
+	"go_core/internal/platform"
+)
+
+// configFiles is what WriteConfigFiles receives: the generated xray config,
+// the service definition and the node list entry to append.
+type configFiles struct {
+	XrayPath       string `json:"xrayPath"`
+	XrayContent    string `json:"xrayContent"`
+	ServicePath    string `json:"servicePath"`
+	ServiceContent string `json:"serviceContent"`
+	VpnPath        string `json:"vpnPath"`
+	VpnContent     string `json:"vpnContent"`
+	Password       string `json:"password"`
+}
+
+// serviceParams names the node service a method acts on.
+type serviceParams struct {
+	Service string `json:"service"`
+}
+
+// nodeHook is a feature that follows the node lifecycle. prepare runs
+// before the service starts, for what xray needs in place when it comes
+// up, and start after it has started; both run in order and may fail the
+// start. stop runs after the service has stopped, in reverse order. In
+// dry-run mode each stage is recorded by name and then runs against the
+// plan, which records the commands and file changes it makes.
+type nodeHook struct {
+	name    string
+	prepare func(service, cfgPath string) error
+	start   func(service, cfgPath string) error
+	stop    func()
+}
+
+// commonHooks follow platformHooks.
+var commonHooks = []nodeHook{
+	{name: "inbound firewall", start: func(string, string) error { return openInboundFirewall() }, stop: closeInboundFirewall},
+	{name: "pac", start: func(_, cfgPath string) error {
+		if cfgPath != "" {
+			startPac(cfgPath)
+		}
+		return nil
+	}, stop: stopPac},
+}
+
+func nodeHooks() []nodeHook {
+	return append(append([]nodeHook(nil), platformHooks...), commonHooks...)
+}
+
+// installs serialises core downloads.
+var installs platform.Background
+
+// The platform files set serviceManager, coreInstaller, nodeWriter,
+// trayIcon and platformHooks, and implement configWriter and
+// resetXrayAndConfig.
+func init() {
+	register("config.write", func(p json.RawMessage) (any, error) {
+		var f configFiles
+		if err := decode(p, &f); err != nil {
+			return nil, err
+		}
+		return nil, writeConfigFiles(f)
+	})
+	register("service.create", func(p json.RawMessage) (any, error) {
+		var s platform.Service
+		if err := decode(p, &s); err != nil {
+			return nil, err
+		}
+		return nil, services().Create(s)
+	})
+	register("node.start", func(p json.RawMessage) (any, error) {
+		var args serviceParams
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return startNode(args.Service)
+	})
+	register("node.stop", func(p json.RawMessage) (any, error) {
+		var args serviceParams
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return nil, stopNode(args.Service)
+	})
+	register("node.status", func(p json.RawMessage) (any, error) {
+		var args serviceParams
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return services().Status(args.Service).String(), nil
+	})
+	register("xray.init", func(json.RawMessage) (any, error) {
+		return initXray()
+	})
+	register("xray.update", func(json.RawMessage) (any, error) {
+		return updateXrayCore()
+	})
+	register("xray.downloading", func(json.RawMessage) (any, error) {
+		return installs.Busy(), nil
+	})
+	register("xray.reset", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Password string `json:"password"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return nil, resetXrayAndConfig(args.Password)
+	})
+	register("xray.start", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Config string `json:"config"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return nil, startXray(args.Config)
+	})
+	register("xray.stop", func(json.RawMessage) (any, error) {
+		return nil, stopXray()
+	})
+}
+
+//export WriteConfigFiles
+func WriteConfigFiles(xrayPathC, xrayContentC, servicePathC, serviceContentC, vpnPathC, vpnContentC, passwordC *C.char) *C.char {
+	return legacy(nil, writeConfigFiles(configFiles{
+		XrayPath:       C.GoString(xrayPathC),
+		XrayContent:    C.GoString(xrayContentC),
+		ServicePath:    C.GoString(servicePathC),
+		ServiceContent: C.GoString(serviceContentC),
+		VpnPath:        C.GoString(vpnPathC),
+		VpnContent:     C.GoString(vpnContentC),
+		Password:       C.GoString(passwordC),
+	}))
+}
+
+func writeConfigFiles(f configFiles) error {
+	xrayContent, err := applyRouting(f.XrayContent)
+	if err == nil {
+		xrayContent, err = applyInbounds(xrayContent)
+	}
+	if err != nil {
+		return err
+	}
+	w := writer(configWriter(f.Password))
+	if err := w.WriteFile(f.XrayPath, []byte(xrayContent)); err != nil {
+		return err
+	}
+	if err := w.WriteFile(f.ServicePath, []byte(f.ServiceContent)); err != nil {
+		return err
+	}
+	var nodes []map[string]interface{}
+	if data, err := os.ReadFile(f.VpnPath); err == nil {
+		json.Unmarshal(data, &nodes)
+	}
+	var newNodes []map[string]interface{}
+	if err := json.Unmarshal([]byte(f.VpnContent), &newNodes); err != nil {
+		return fail(codeInvalidParams, fmt.Errorf("invalid vpn node content: %w", err))
+	}
+	updated, _ := json.MarshalIndent(append(nodes, newNodes...), "", "  ")
+	if err := w.WriteFile(f.VpnPath, updated); err != nil {
+		return err
+	}
+	updateTray()
+	return nil
+}
+
+//export StartNodeService
+func StartNodeService(serviceC *C.char) *C.char {
+	return legacy(startNode(C.GoString(serviceC)))
+}
+
+func startNode(service string) (any, error) {
+	sm := services()
+	cfgPath, err := sm.ConfigPath(service)
+	if err != nil {
+		cfgPath = ""
+	}
+	plan := activePlan()
+	hooks := nodeHooks()
+	// engaged marks the hooks whose prepare or start succeeded, so a
+	// failed start stops exactly those.
+	engaged := make([]bool, len(hooks))
+	for i, h := range hooks {
+		if h.prepare == nil {
+			continue
+		}
+		if plan != nil {
+			plan.Record(platform.Step{Kind: "hook", Op: "prepare", Name: h.name})
+		}
+		if err := h.prepare(service, cfgPath); err != nil {
+			undoHooks(hooks, engaged)
+			return nil, err
+		}
+		engaged[i] = true
+	}
+	// Ports are probed on the addresses xray listens on, which the prepare
+	// hooks may have created.
+	var note string
+	if cfgPath != "" {
+		if note, err = preparePorts(service, cfgPath, writer(nodeWriter)); err != nil {
+			undoHooks(hooks, engaged)
+			return nil, err
+		}
+	}
+	if err := sm.Start(service); err != nil {
+		undoHooks(hooks, engaged)
+		releasePorts(service)
+		return nil, err
+	}
+	for i, h := range hooks {
+		if h.start == nil {
+			continue
+		}
+		if plan != nil {
+			plan.Record(platform.Step{Kind: "hook", Op: "start", Name: h.name})
+		}
+		if err := h.start(service, cfgPath); err != nil {
+			undoHooks(hooks, engaged)
+			if stopErr := sm.Stop(service); stopErr != nil {
+				fmt.Println("Stop node failed:", stopErr)
+			}
+			releasePorts(service)
+			return nil, err
+		}
+		engaged[i] = true
+	}
+	if plan == nil {
+		emit("node.started", serviceParams{service})
+		watchNode(service)
+		startNetworkMonitor()
+		sendNotification(notify.Notification{
+			Event:   notify.NodeConnected,
+			Tag:     "node",
+			Summary: "Connected",
+			Body:    "Connected to " + nodeDisplayName(service) + ".",
+		}, service)
+	}
+	if note != "" {
+		return notice(note), nil
+	}
+	return nil, nil
+}
+
+// undoHooks stops the engaged hooks in reverse order, after a start that
+// failed part-way.
+func undoHooks(hooks []nodeHook, engaged []bool) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if engaged[i] && hooks[i].stop != nil {
+			hooks[i].stop()
+		}
+	}
+}
+
+//export StopNodeService
+func StopNodeService(serviceC *C.char) *C.char {
+	return legacy(nil, stopNode(C.GoString(serviceC)))
+}
+
+func stopNode(service string) error {
+	wasRunning := serviceActive(service)
+	if err := services().Stop(service); err != nil {
+		return err
+	}
+	unwatchNode(service)
+	plan := activePlan()
+	// Stopping a node that is not running must not take down the kill
+	// switch, proxy or firewall another node engaged.
+	var hooks []nodeHook
+	if plan != nil || releaseHooks(service, wasRunning) {
+		hooks = nodeHooks()
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if hooks[i].stop == nil {
+			continue
+		}
+		if plan != nil {
+			plan.Record(platform.Step{Kind: "hook", Op: "stop", Name: hooks[i].name})
+		}
+		hooks[i].stop()
+	}
+	releasePorts(service)
+	if plan == nil {
+		emit("node.stopped", serviceParams{service})
+		sendNotification(notify.Notification{
+			Event:   notify.NodeDisconnected,
+			Tag:     "node",
+			Summary: "Disconnected",
+			Body:    "Disconnected from " + nodeDisplayName(service) + ".",
+			Actions: []notify.Action{actionReconnect},
+		}, service)
+	}
+	return nil
+}
+
+// releaseHooks reports whether the hooks are engaged for service, and
+// forgets them if so. When this process started no node, e.g. after the
+// app restarted with a node running, a node that was running has them.
+func releaseHooks(service string, wasRunning bool) bool {
+	nodeWatch.Lock()
+	defer nodeWatch.Unlock()
+	switch nodeWatch.hooked {
+	case service:
+		nodeWatch.hooked = ""
+		return true
+	case "":
+		return wasRunning
+	}
+	return false
+}
+
+//export CheckNodeStatus
+func CheckNodeStatus(serviceC *C.char) C.int {
+	return C.int(serviceManager.Status(C.GoString(serviceC)))
+}
+
+func serviceActive(service string) bool {
+	return serviceManager.Status(service) == platform.StatusRunning
+}
+
+//export InitXray
+func InitXray() *C.char {
+	return legacy(initXray())
+}
+
+func initXray() (any, error) {
+	geoOnce.Do(startGeoDataUpdates)
+	if host.ResolveCore().Found {
+		return nil, nil
+	}
+	return updateXrayCore()
+}
+
+//export UpdateXrayCore
+func UpdateXrayCore() *C.char {
+	return legacy(updateXrayCore())
+}
+
+func updateXrayCore() (any, error) {
+	started := installs.Start(installer(), func(err error) {
+		if err != nil {
+			fmt.Println("Download failed:", err)
+			sendNotification(notify.Notification{
+				Event:   notify.CoreUpdateFailed,
+				Tag:     "core",
+				Summary: "Xray core update failed",
+				Body:    err.Error(),
+				Urgent:  true,
+				Actions: []notify.Action{actionLogs},
+			}, "")
+			return
+		}
+		sendNotification(notify.Notification{
+			Event:   notify.CoreUpdated,
+			Tag:     "core",
+			Summary: "Xray core updated",
+			Body:    "The xray core is installed at " + coreInstaller.Path() + ".",
+		}, "")
+	})
+	if !started {
+		return notice("downloading in background"), nil
+	}
+	return notice("download started"), nil
+}
+
+//export IsXrayDownloading
+func IsXrayDownloading() C.int {
+	if installs.Busy() {
+		return 1
+	}
+	return 0
+}
+
+//export ResetXrayAndConfig
+func ResetXrayAndConfig(passwordC *C.char) *C.char {
+	return legacy(nil, resetXrayAndConfig(C.GoString(passwordC)))
+}
+
+//export StartXray
+func StartXray(configC *C.char) *C.char {
+	return legacy(nil, startXray(C.GoString(configC)))
+}
+
+// startXray and stopXray drive an embedded xray instance, which only the
+// iOS build has.
+func startXray(config string) error {
+	return fail(codeUnsupported, errors.New("not supported"))
+}
+
+//export StopXray
+func StopXray() *C.char {
+	return legacy(nil, stopXray())
+}
+
+func stopXray() error {
+	return fail(codeUnsupported, errors.New("not supported"))
+}
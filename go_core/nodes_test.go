@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go_core/internal/inbound"
+	"go_core/internal/notify"
+	"go_core/internal/platform"
+	"go_core/internal/ports"
+	"go_core/internal/xrayconf"
+)
+
+// calls is the order of everything the fakes and test hooks were asked to
+// do.
+type calls []string
+
+func (c *calls) add(format string, args ...any) {
+	*c = append(*c, fmt.Sprintf(format, args...))
+}
+
+type fakeServices struct {
+	calls    *calls
+	config   string
+	startErr error
+	running  map[string]bool
+}
+
+func (f *fakeServices) Name() string { return "fake" }
+
+func (f *fakeServices) Create(s platform.Service) error {
+	f.calls.add("create %s", s.Name)
+	return nil
+}
+
+func (f *fakeServices) Start(name string) error {
+	f.calls.add("start %s", name)
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.running[name] = true
+	return nil
+}
+
+func (f *fakeServices) Stop(name string) error {
+	f.calls.add("stop %s", name)
+	delete(f.running, name)
+	return nil
+}
+
+func (f *fakeServices) Status(name string) platform.Status {
+	if f.running[name] {
+		return platform.StatusRunning
+	}
+	return platform.StatusStopped
+}
+
+func (f *fakeServices) ConfigPath(string) (string, error) {
+	return f.config, nil
+}
+
+type fakeWriter struct {
+	calls *calls
+	files map[string][]byte
+}
+
+func (w *fakeWriter) WriteFile(path string, data []byte) error {
+	w.calls.add("write %s", filepath.Base(path))
+	w.files[path] = data
+	return nil
+}
+
+type fakeInstaller struct {
+	calls *calls
+	done  chan struct{}
+}
+
+func (i *fakeInstaller) Path() string { return "/fake/xray" }
+
+func (i *fakeInstaller) Install() error {
+	i.calls.add("install")
+	close(i.done)
+	return nil
+}
+
+type fakeNotifier struct{ sent chan notify.Notification }
+
+func (n fakeNotifier) Send(msg notify.Notification, _ func(string)) error {
+	n.sent <- msg
+	return nil
+}
+
+// testHook records its stages; prepareErr and startErr fail them.
+func testHook(c *calls, name string, prepareErr, startErr error) nodeHook {
+	return nodeHook{
+		name: name,
+		prepare: func(string, string) error {
+			c.add("prepare %s", name)
+			return prepareErr
+		},
+		start: func(string, string) error {
+			c.add("start hook %s", name)
+			return startErr
+		},
+		stop: func() { c.add("stop hook %s", name) },
+	}
+}
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+type testNode struct {
+	calls    *calls
+	services *fakeServices
+	writer   *fakeWriter
+	notes    chan notify.Notification
+	port     int
+}
+
+// setupNode swaps the backends for fakes and clears the hooks, with a node
+// config in a temporary directory listening on a free port.
+func setupNode(t *testing.T) *testNode {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	c := &calls{}
+	n := &testNode{
+		calls:  c,
+		writer: &fakeWriter{calls: c, files: map[string][]byte{}},
+		notes:  make(chan notify.Notification, 16),
+		port:   freePort(t),
+	}
+	cfg := filepath.Join(home, "xray-us.json")
+	data := fmt.Sprintf(`{"inbounds": [{"listen": "127.0.0.1", "port": %d, "protocol": "socks"}]}`, n.port)
+	if err := os.WriteFile(cfg, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n.services = &fakeServices{calls: c, config: cfg, running: map[string]bool{}}
+
+	savedServices, savedWriter, savedNotifier := serviceManager, nodeWriter, notifier
+	savedPlatform, savedCommon := platformHooks, commonHooks
+	t.Cleanup(func() {
+		serviceManager, nodeWriter, notifier = savedServices, savedWriter, savedNotifier
+		platformHooks, commonHooks = savedPlatform, savedCommon
+		unwatchNode("xray-node-us.service")
+		releaseHooks("xray-node-us.service", false)
+	})
+	serviceManager, nodeWriter, notifier = n.services, n.writer, fakeNotifier{n.notes}
+	platformHooks, commonHooks = nil, nil
+	return n
+}
+
+func (n *testNode) claimed() bool {
+	for _, p := range ports.Claims()["xray-node-us.service"] {
+		if p == n.port {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStartNode(t *testing.T) {
+	const svc = "xray-node-us.service"
+	errHook := errors.New("hook failed")
+	tests := []struct {
+		name     string
+		hooks    func(c *calls) []nodeHook
+		startErr error
+		wantErr  error
+		want     calls
+		claimed  bool
+	}{
+		{
+			name: "started",
+			hooks: func(c *calls) []nodeHook {
+				return []nodeHook{testHook(c, "a", nil, nil), testHook(c, "b", nil, nil)}
+			},
+			want: calls{
+				"prepare a", "prepare b",
+				"start " + svc,
+				"start hook a", "start hook b",
+			},
+			claimed: true,
+		},
+		{
+			name: "start hook fails",
+			hooks: func(c *calls) []nodeHook {
+				return []nodeHook{
+					testHook(c, "a", nil, nil),
+					{name: "b", start: func(string, string) error { c.add("start hook b"); return nil }, stop: func() { c.add("stop hook b") }},
+					testHook(c, "c", nil, errHook),
+					testHook(c, "d", nil, nil),
+				}
+			},
+			wantErr: errHook,
+			want: calls{
+				"prepare a", "prepare c", "prepare d",
+				"start " + svc,
+				"start hook a", "start hook b", "start hook c",
+				"stop hook d", "stop hook c", "stop hook b", "stop hook a",
+				"stop " + svc,
+			},
+		},
+		{
+			name: "prepare fails",
+			hooks: func(c *calls) []nodeHook {
+				return []nodeHook{testHook(c, "a", nil, nil), testHook(c, "b", errHook, nil), testHook(c, "c", nil, nil)}
+			},
+			wantErr: errHook,
+			want:    calls{"prepare a", "prepare b", "stop hook a"},
+		},
+		{
+			name: "service fails",
+			hooks: func(c *calls) []nodeHook {
+				return []nodeHook{testHook(c, "a", nil, nil), {name: "b", stop: func() { c.add("stop hook b") }}}
+			},
+			startErr: errHook,
+			wantErr:  errHook,
+			want:     calls{"prepare a", "start " + svc, "stop hook a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := setupNode(t)
+			c := n.calls
+			platformHooks = tt.hooks(c)
+			n.services.startErr = tt.startErr
+			_, err := startNode(svc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("startNode() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(*c, tt.want) {
+				t.Errorf("calls =\n%s\nwant:\n%s", strings.Join(*c, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if n.claimed() != tt.claimed {
+				t.Errorf("port claimed = %v, want %v", n.claimed(), tt.claimed)
+			}
+			if got := serviceActive(svc); got != (tt.wantErr == nil) {
+				t.Errorf("service active = %v after start", got)
+			}
+		})
+	}
+}
+
+func TestStopNode(t *testing.T) {
+	const svc = "xray-node-us.service"
+	n := setupNode(t)
+	c := n.calls
+	platformHooks = []nodeHook{testHook(c, "a", nil, nil), {name: "b"}, testHook(c, "c", nil, nil)}
+	if _, err := startNode(svc); err != nil {
+		t.Fatal(err)
+	}
+	if !n.claimed() {
+		t.Fatal("port not claimed after start")
+	}
+	*c = nil
+	if err := stopNode(svc); err != nil {
+		t.Fatal(err)
+	}
+	want := calls{"stop " + svc, "stop hook c", "stop hook a"}
+	if !reflect.DeepEqual(*c, want) {
+		t.Errorf("calls = %q, want %q", *c, want)
+	}
+	if n.claimed() {
+		t.Error("port still claimed after stop")
+	}
+}
+
+func TestStopNodeKeepsOtherNodesHooks(t *testing.T) {
+	const svc = "xray-node-us.service"
+	n := setupNode(t)
+	c := n.calls
+	platformHooks = []nodeHook{testHook(c, "a", nil, nil)}
+	if _, err := startNode(svc); err != nil {
+		t.Fatal(err)
+	}
+	*c = nil
+	// Neither a node that is not running nor a second stop of the same
+	// node disengages the hooks again.
+	if err := stopNode("xray-node-jp.service"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopNode(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopNode(svc); err != nil {
+		t.Fatal(err)
+	}
+	want := calls{"stop xray-node-jp.service", "stop " + svc, "stop hook a", "stop " + svc}
+	if !reflect.DeepEqual(*c, want) {
+		t.Errorf("calls = %q, want %q", *c, want)
+	}
+}
+
+func TestStartNodeDryRun(t *testing.T) {
+	const svc = "xray-node-us.service"
+	n := setupNode(t)
+	c := n.calls
+	platformHooks = []nodeHook{testHook(c, "a", nil, nil)}
+	setDryRun(true)
+	t.Cleanup(func() { setDryRun(false) })
+
+	if _, err := startNode(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopNode(svc); err != nil {
+		t.Fatal(err)
+	}
+	// The hooks run so the plan records what they change; the service
+	// itself is only recorded.
+	want := calls{"prepare a", "start hook a", "stop hook a"}
+	if !reflect.DeepEqual(*c, want) {
+		t.Errorf("calls = %q, want %q", *c, want)
+	}
+	var got []string
+	for _, s := range activePlan().Steps() {
+		got = append(got, strings.TrimSpace(s.Kind+" "+s.Op+" "+s.Name+s.Service))
+	}
+	wantSteps := []string{
+		"hook prepare a",
+		"service start " + svc,
+		"hook start a",
+		"service stop " + svc,
+		"hook stop a",
+	}
+	if !reflect.DeepEqual(got, wantSteps) {
+		t.Errorf("steps = %q, want %q", got, wantSteps)
+	}
+}
+
+func TestStartNodeMovesPorts(t *testing.T) {
+	const svc = "xray-node-us.service"
+	n := setupNode(t)
+	s, err := inbound.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AutoPorts = true
+	if err := inbound.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	held, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", n.port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	res, err := startNode(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil {
+		t.Error("no note about the moved port")
+	}
+	data, ok := n.writer.files[n.services.config]
+	if !ok {
+		t.Fatalf("config not rewritten through the node writer; calls %q", *n.calls)
+	}
+	cfg, err := xrayconf.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins := cfg.Inbounds()
+	if len(ins) != 1 || ins[0].Port == n.port {
+		t.Fatalf("inbounds = %+v, want moved off %d", ins, n.port)
+	}
+	if got := ports.Claims()[svc]; !reflect.DeepEqual(got, []int{ins[0].Port}) {
+		t.Errorf("claims = %v, want [%d]", got, ins[0].Port)
+	}
+}
+
+func TestUpdateXrayCore(t *testing.T) {
+	n := setupNode(t)
+	in := &fakeInstaller{calls: n.calls, done: make(chan struct{})}
+	saved := coreInstaller
+	coreInstaller = in
+	t.Cleanup(func() { coreInstaller = saved })
+
+	if _, err := updateXrayCore(); err != nil {
+		t.Fatal(err)
+	}
+	<-in.done
+	if msg := <-n.notes; msg.Event != notify.CoreUpdated || !strings.Contains(msg.Body, in.Path()) {
+		t.Errorf("notification = %+v", msg)
+	}
+	if !reflect.DeepEqual(*n.calls, calls{"install"}) {
+		t.Errorf("calls = %q", *n.calls)
+	}
+}
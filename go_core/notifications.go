@@ -0,0 +1,179 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go_core/internal/host"
+	"go_core/internal/nodelist"
+	"go_core/internal/notify"
+)
+
+var notifier = notify.New()
+
+func init() {
+	register("notify.get", func(json.RawMessage) (any, error) {
+		c, err := notify.Load()
+		if err != nil {
+			return nil, err
+		}
+		return c.Complete(), nil
+	})
+	register("notify.set", func(p json.RawMessage) (any, error) {
+		var c notify.Config
+		if err := decode(p, &c); err != nil {
+			return nil, err
+		}
+		if err := c.Validate(); err != nil {
+			return nil, fail(codeInvalidParams, err)
+		}
+		return nil, notify.Save(c)
+	})
+	// The subscription and its expiry are only known to the app.
+	register("notify.subscriptionExpiring", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Name    string `json:"name"`
+			Expires string `json:"expires"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		expires, err := time.Parse(time.RFC3339, args.Expires)
+		if err != nil {
+			return nil, fail(codeInvalidParams, err)
+		}
+		sendNotification(notify.Notification{
+			Event:   notify.SubscriptionExpiring,
+			Tag:     "subscription:" + args.Name,
+			Summary: "Subscription expiring",
+			Body:    fmt.Sprintf("%s expires on %s", args.Name, expires.Local().Format("2006-01-02 15:04")),
+		}, "")
+		return nil, nil
+	})
+}
+
+// Actions notifications offer.
+var (
+	actionReconnect = notify.Action{Key: "reconnect", Label: "Reconnect"}
+	actionLogs      = notify.Action{Key: "logs", Label: "Open logs"}
+)
+
+// sendNotification shows n unless its event is turned off or dry-run mode
+// is on. service is the node that reconnect acts on.
+func sendNotification(n notify.Notification, service string) {
+	if activePlan() != nil {
+		return
+	}
+	c, err := notify.Load()
+	if err != nil {
+		fmt.Println("Load notification settings failed:", err)
+	}
+	if !c.Enabled(n.Event) {
+		return
+	}
+	err = notifier.Send(n, func(key string) { notificationAction(n.Event, key, service) })
+	if err != nil && !errors.Is(err, notify.ErrUnsupported) {
+		fmt.Println("Send notification failed:", err)
+	}
+}
+
+// notificationAction routes a clicked notification back into the app:
+// reconnect is handled here, anything else raises the window and is passed
+// on as an event, e.g. to open the logs page.
+func notificationAction(event, key, service string) {
+	if key == actionReconnect.Key && service != "" {
+		if _, err := startNode(service); err != nil {
+			fmt.Println("Reconnect failed:", err)
+		}
+		return
+	}
+	showMainWindow()
+	emit("notification.action", map[string]string{"event": event, "action": key, "service": service})
+}
+
+// nodeWatchPoll is how often the running node is checked for having
+// stopped on its own.
+const nodeWatchPoll = 5 * time.Second
+
+// nodeWatch follows the node startNode last started, to notice it
+// stopping without stopNode, e.g. xray crashing. hooked is the node the
+// hooks were engaged for; it outlives a crash, since the kill switch
+// stays up until the node is stopped.
+var nodeWatch struct {
+	sync.Mutex
+	service string
+	hooked  string
+	down    bool
+	once    sync.Once
+}
+
+func watchNode(service string) {
+	nodeWatch.Lock()
+	nodeWatch.service = service
+	nodeWatch.hooked = service
+	nodeWatch.down = false
+	nodeWatch.Unlock()
+	nodeWatch.once.Do(func() {
+		go func() {
+			for {
+				time.Sleep(nodeWatchPoll)
+				checkWatchedNode()
+			}
+		}()
+	})
+}
+
+func unwatchNode(service string) {
+	nodeWatch.Lock()
+	defer nodeWatch.Unlock()
+	if nodeWatch.service == service {
+		nodeWatch.service = ""
+	}
+}
+
+// checkWatchedNode reports the watched node going down once, until it runs
+// again.
+func checkWatchedNode() {
+	nodeWatch.Lock()
+	service := nodeWatch.service
+	nodeWatch.Unlock()
+	if service == "" {
+		return
+	}
+	active := serviceActive(service)
+	nodeWatch.Lock()
+	if nodeWatch.service != service {
+		nodeWatch.Unlock()
+		return
+	}
+	wentDown := !active && !nodeWatch.down
+	nodeWatch.down = !active
+	nodeWatch.Unlock()
+	if !wentDown {
+		return
+	}
+	emit("node.failed", serviceParams{service})
+	sendNotification(notify.Notification{
+		Event:   notify.NodeFailed,
+		Tag:     "node",
+		Summary: "Connection lost",
+		Body:    nodeDisplayName(service) + " stopped unexpectedly.",
+		Urgent:  true,
+		Actions: []notify.Action{actionReconnect, actionLogs},
+	}, service)
+}
+
+// nodeDisplayName is the node's name from vpn_nodes.json, or service.
+func nodeDisplayName(service string) string {
+	nodes, _ := nodelist.Load(host.NodesFile())
+	for _, n := range nodes {
+		if n.ServiceName == service {
+			return n.Name
+		}
+	}
+	return service
+}
@@ -0,0 +1,130 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"go_core/internal/geodata"
+	"go_core/internal/pac"
+	"go_core/internal/routing"
+	"go_core/internal/xrayconf"
+)
+
+var (
+	pacServer pac.Server
+	pacMu     sync.Mutex
+	pacOpts   pac.Options
+)
+
+// startPac serves a PAC file for the node whose xray config is at cfgPath.
+// The server runs in this process and changes nothing on the system, so
+// dry-run mode leaves it alone.
+func startPac(cfgPath string) {
+	if activePlan() != nil {
+		return
+	}
+	s, err := pac.LoadSettings()
+	if err != nil || !s.Enabled {
+		return
+	}
+	cfg, err := xrayconf.Load(cfgPath)
+	if err != nil {
+		fmt.Println("Start PAC server failed:", err)
+		return
+	}
+	var o pac.Options
+	for _, in := range cfg.Inbounds() {
+		host := in.Listen
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(in.Port))
+		switch in.Protocol {
+		case "socks":
+			if o.SocksAddr == "" {
+				o.SocksAddr = addr
+			}
+		case "http":
+			if o.HTTPAddr == "" {
+				o.HTTPAddr = addr
+			}
+		}
+	}
+	if geo, ok := routing.Geo.(*geodata.Lookup); ok {
+		o.ExpandSite = func(code string) ([]string, []string, error) {
+			suffix, full, _, err := geo.SiteDomains(code)
+			return suffix, full, err
+		}
+	}
+	pacMu.Lock()
+	pacOpts = o
+	pacMu.Unlock()
+	regeneratePac()
+	if err := pacServer.Start(s.Listen); err != nil {
+		fmt.Println("Start PAC server failed:", err)
+	}
+}
+
+func stopPac() {
+	if activePlan() != nil {
+		return
+	}
+	pacServer.Stop()
+}
+
+// regeneratePac rebuilds the served script from the current routing rules.
+func regeneratePac() {
+	c, err := routing.Load()
+	if err != nil {
+		fmt.Println("Regenerate PAC failed:", err)
+		return
+	}
+	pacMu.Lock()
+	o := pacOpts
+	pacMu.Unlock()
+	pacServer.Set(pac.Generate(c, o))
+}
+
+func init() {
+	register("pac.set", func(p json.RawMessage) (any, error) {
+		var s pac.Settings
+		if err := decode(p, &s); err != nil {
+			return nil, err
+		}
+		return nil, setPacServer(s)
+	})
+	register("pac.url", func(json.RawMessage) (any, error) {
+		return pacServer.URL(), nil
+	})
+}
+
+//export SetPacServer
+func SetPacServer(settingsC *C.char) *C.char {
+	var s pac.Settings
+	if err := json.Unmarshal([]byte(C.GoString(settingsC)), &s); err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(nil, setPacServer(s))
+}
+
+func setPacServer(s pac.Settings) error {
+	if err := pac.SaveSettings(s); err != nil {
+		return err
+	}
+	if !s.Enabled {
+		stopPac()
+	}
+	return nil
+}
+
+// GetPacUrl returns the URL of the running PAC server, or an empty string
+// when no node is active.
+//
+//export GetPacUrl
+func GetPacUrl() *C.char {
+	return C.CString(pacServer.URL())
+}
@@ -0,0 +1,177 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"go_core/internal/inbound"
+	"go_core/internal/platform"
+	"go_core/internal/ports"
+	"go_core/internal/xrayconf"
+)
+
+func init() {
+	register("ports.check", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Service string `json:"service"`
+			Config  string `json:"config"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return checkNodePorts(args.Service, args.Config)
+	})
+	register("ports.claims", func(json.RawMessage) (any, error) {
+		return portClaims(), nil
+	})
+}
+
+// CheckNodePorts reports the inbound ports of a node config that are held
+// by other processes or nodes, as a JSON list of conflicts.
+//
+//export CheckNodePorts
+func CheckNodePorts(serviceC, cfgPathC *C.char) *C.char {
+	return legacy(checkNodePorts(C.GoString(serviceC), C.GoString(cfgPathC)))
+}
+
+func checkNodePorts(service, cfgPath string) (any, error) {
+	cfg, err := xrayconf.Load(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	ports.Prune(serviceActive)
+	conflicts := ports.Check(service, nodePID(service), wantedPorts(cfg))
+	if conflicts == nil {
+		conflicts = []ports.Conflict{}
+	}
+	return conflicts, nil
+}
+
+// GetPortClaims returns the registry of ports claimed by running nodes.
+//
+//export GetPortClaims
+func GetPortClaims() *C.char {
+	return legacy(portClaims(), nil)
+}
+
+func portClaims() map[string][]int {
+	ports.Prune(serviceActive)
+	return ports.Claims()
+}
+
+// preparePorts runs before a node starts. Conflicting ports either fail
+// the start or, with inbound autoPorts set, are moved to free ports and the
+// config at cfgPath is rewritten through w. On success the ports are
+// claimed for service, except in dry-run mode; the returned note lists any
+// moves.
+func preparePorts(service, cfgPath string, w platform.FileWriter) (string, error) {
+	cfg, err := xrayconf.Load(cfgPath)
+	if err != nil {
+		return "", err
+	}
+	ports.Prune(serviceActive)
+	conflicts := ports.Check(service, nodePID(service), wantedPorts(cfg))
+	var note string
+	if len(conflicts) > 0 {
+		s, _ := inbound.Load()
+		if !s.AutoPorts {
+			errs := make([]error, len(conflicts))
+			for i, c := range conflicts {
+				errs[i] = c
+			}
+			return "", errors.Join(errs...)
+		}
+		moved := map[int]int{}
+		var taken, msgs []string
+		var skip []int
+		for _, in := range cfg.Inbounds() {
+			skip = append(skip, in.Port)
+		}
+		for _, c := range conflicts {
+			if _, ok := moved[c.Port]; ok {
+				continue
+			}
+			to, err := ports.Free(c.Port, listenAddrs(cfg, c.Port), skip)
+			if err != nil {
+				return "", fmt.Errorf("%v: %w", c, err)
+			}
+			moved[c.Port] = to
+			skip = append(skip, to)
+			taken = append(taken, c.Error())
+			msgs = append(msgs, fmt.Sprintf("%d->%d", c.Port, to))
+		}
+		if err := cfg.RemapPorts(moved); err != nil {
+			return "", err
+		}
+		data, err := cfg.Marshal()
+		if err != nil {
+			return "", err
+		}
+		if err := w.WriteFile(cfgPath, data); err != nil {
+			return "", err
+		}
+		sort.Strings(msgs)
+		note = fmt.Sprintf("%s; moved %s", strings.Join(taken, ", "), strings.Join(msgs, ", "))
+	}
+	if activePlan() != nil {
+		return note, nil
+	}
+	var claimed []int
+	for _, in := range cfg.Inbounds() {
+		claimed = append(claimed, in.Port)
+	}
+	return note, ports.Claim(service, claimed)
+}
+
+// nodePID is the pid of service's xray process, or 0 when it is not running
+// or the service manager cannot tell.
+func nodePID(service string) int {
+	if p, ok := serviceManager.(platform.PIDer); ok {
+		if pid, err := p.MainPID(service); err == nil {
+			return pid
+		}
+	}
+	return 0
+}
+
+// listenAddrs lists the addresses the inbounds on port listen on. Unix
+// socket inbounds have no port to probe and are left out.
+func listenAddrs(cfg xrayconf.Config, port int) []string {
+	var addrs []string
+	for _, in := range cfg.Inbounds() {
+		if in.Port == port && (in.Listen == "" || net.ParseIP(in.Listen) != nil) {
+			addrs = append(addrs, in.Listen)
+		}
+	}
+	return addrs
+}
+
+func releasePorts(service string) {
+	if activePlan() != nil {
+		return
+	}
+	if err := ports.Release(service); err != nil {
+		fmt.Println("Release ports failed:", err)
+	}
+}
+
+// wantedPorts lists the ports an xray config listens on. Socks inbounds
+// relay UDP on the same port.
+func wantedPorts(cfg xrayconf.Config) []ports.Want {
+	var want []ports.Want
+	for _, in := range cfg.Inbounds() {
+		if in.Port <= 0 {
+			continue
+		}
+		want = append(want, ports.Want{Proto: "tcp", Port: in.Port})
+		if in.Protocol == "socks" {
+			want = append(want, ports.Want{Proto: "udp", Port: in.Port})
+		}
+	}
+	return want
+}
@@ -0,0 +1,120 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	"go_core/internal/routing"
+)
+
+func init() {
+	register("routing.set", func(p json.RawMessage) (any, error) {
+		var c routing.Config
+		if err := decode(p, &c); err != nil {
+			return nil, err
+		}
+		return nil, setRoutingRules(c)
+	})
+	register("routing.get", func(json.RawMessage) (any, error) {
+		return getRoutingRules()
+	})
+	register("routing.match", func(p json.RawMessage) (any, error) {
+		var q routing.Query
+		if err := decode(p, &q); err != nil {
+			return nil, err
+		}
+		return matchRoutingRule(q)
+	})
+}
+
+//export SetRoutingRules
+func SetRoutingRules(configC *C.char) *C.char {
+	var c routing.Config
+	if err := json.Unmarshal([]byte(C.GoString(configC)), &c); err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(nil, setRoutingRules(c))
+}
+
+func setRoutingRules(c routing.Config) error {
+	if err := c.Validate(); err != nil {
+		return fail(codeInvalidParams, err)
+	}
+	if err := routing.Save(c); err != nil {
+		return err
+	}
+	regeneratePac()
+	return nil
+}
+
+// GetRoutingRules returns the saved rules together with the available
+// presets.
+//
+//export GetRoutingRules
+func GetRoutingRules() *C.char {
+	return legacy(getRoutingRules())
+}
+
+func getRoutingRules() (any, error) {
+	c, err := routing.Load()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		routing.Config
+		Available []routing.Preset `json:"availablePresets"`
+	}{c, routing.Presets}, nil
+}
+
+// MatchRoutingRule reports which rule a connection would hit. The query is
+// either "host", "host:port" or a JSON object {"host","port","process"}.
+//
+//export MatchRoutingRule
+func MatchRoutingRule(queryC *C.char) *C.char {
+	q, err := parseRouteQuery(C.GoString(queryC))
+	if err != nil {
+		return C.CString("error:" + err.Error())
+	}
+	return legacy(matchRoutingRule(q))
+}
+
+func matchRoutingRule(q routing.Query) (any, error) {
+	c, err := routing.Load()
+	if err != nil {
+		return nil, err
+	}
+	return routing.Match(c, q), nil
+}
+
+func parseRouteQuery(s string) (routing.Query, error) {
+	var q routing.Query
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") {
+		err := json.Unmarshal([]byte(s), &q)
+		return q, err
+	}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		q.Host = host
+		q.Port, err = strconv.Atoi(port)
+		return q, err
+	}
+	q.Host = s
+	return q, nil
+}
+
+// applyRouting compiles the saved routing rules into a generated xray
+// config before it is written to disk.
+func applyRouting(content string) (string, error) {
+	c, err := routing.Load()
+	if err != nil {
+		return "", err
+	}
+	out, err := routing.ApplyJSON([]byte(content), c)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
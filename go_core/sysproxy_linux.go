@@ -0,0 +1,60 @@
+//go:build linux
+
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+
+	"go_core/internal/sysproxy"
+)
+
+func init() {
+	sysproxy.Sys = system{}
+	register("sysproxy.set", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Mode   string `json:"mode"`
+			Host   string `json:"host"`
+			Ports  string `json:"ports"`
+			Bypass string `json:"bypass"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return nil, setSystemProxy(args.Mode, args.Host, args.Ports, args.Bypass)
+	})
+	register("sysproxy.restore", func(json.RawMessage) (any, error) {
+		return nil, sysproxy.Restore()
+	})
+}
+
+//export SetSystemProxy
+func SetSystemProxy(modeC, hostC, portsC, bypassC *C.char) *C.char {
+	return legacy(nil, setSystemProxy(C.GoString(modeC), C.GoString(hostC), C.GoString(portsC), C.GoString(bypassC)))
+}
+
+func setSystemProxy(mode, host, ports, bypass string) error {
+	s := sysproxy.Settings{
+		Mode:   sysproxy.Mode(mode),
+		Host:   host,
+		Bypass: sysproxy.ParseBypass(bypass),
+	}
+	if err := s.ParsePorts(ports); err != nil {
+		return fail(codeInvalidParams, err)
+	}
+	return sysproxy.Apply(s)
+}
+
+//export RestoreSystemProxy
+func RestoreSystemProxy() *C.char {
+	return legacy(nil, sysproxy.Restore())
+}
+
+// restoreSystemProxy undoes SetSystemProxy when a node stops or the app
+// quits, so desktop applications are never left pointing at a dead proxy.
+func restoreSystemProxy() {
+	if err := sysproxy.Restore(); err != nil {
+		fmt.Println("Restore system proxy failed:", err)
+	}
+}
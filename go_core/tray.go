@@ -0,0 +1,295 @@
+package main
+
+import "C"
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"go_core/internal/host"
+	"go_core/internal/nodelist"
+	"go_core/internal/platform"
+	"go_core/internal/platform/statusicon"
+	"go_core/internal/traffic"
+)
+
+// trayPoll is how often the tray samples the running node's throughput.
+// The connection state follows node events instead.
+const trayPoll = 2 * time.Second
+
+var (
+	trayOnce sync.Once
+	trayIcon platform.Tray
+)
+
+// tray is the state behind the tray menu. Node actions from the menu go
+// through startNode and stopNode, like those of the UI.
+var tray struct {
+	sync.Mutex
+	logo   []byte
+	nodes  []nodelist.Node
+	active string // service of the running node
+	busy   bool   // a menu action is in progress
+	err    error  // last failed menu action
+	shown  bool   // InitTray has run
+	menu   string // key of the menu last set
+	state  string // icon last set
+	// tooltip is the last tooltip set, without the throughput that
+	// trayMeter appends.
+	tooltip string
+	// meterStop stops the trayMeter of the running node.
+	meterStop chan struct{}
+}
+
+// InitTray shows the tray icon. Its menu lists the nodes of vpn_nodes.json
+// with the running one checked, and offers disconnect, show and quit; the
+// tooltip and icon show the connection state and throughput. It also
+// starts hiding the main window when it is minimized. The platform files
+// provide newTray, showMainWindow, monitorMinimize and trayExit.
+//
+//export InitTray
+func InitTray() {
+	trayOnce.Do(func() {
+		trayIcon = newTray()
+		tray.Lock()
+		tray.logo, _ = os.ReadFile("data/flutter_assets/assets/logo.png")
+		tray.shown = true
+		tray.Unlock()
+		refreshTray()
+		// Nodes started or stopped by any caller, and the node watcher
+		// noticing one going down, all come through as events.
+		listen(func(typ string) {
+			switch typ {
+			case "node.started", "node.stopped", "node.failed":
+				go refreshTray()
+			}
+		})
+		go func() {
+			runtime.LockOSThread()
+			trayIcon.Run(func() {
+				go monitorMinimize()
+			}, trayExit)
+		}()
+	})
+}
+
+// updateTray refreshes the tray after the node list changed. It does
+// nothing before InitTray.
+func updateTray() {
+	tray.Lock()
+	shown := tray.shown
+	tray.Unlock()
+	if shown {
+		go refreshTray()
+	}
+}
+
+// refreshTray updates the menu, icon and tooltip from the node list and
+// the services' state.
+func refreshTray() {
+	nodes, err := nodelist.Load(host.NodesFile())
+	if err != nil {
+		fmt.Println("Load nodes failed:", err)
+	}
+	tray.Lock()
+	defer tray.Unlock()
+	tray.nodes = nodes
+	// Only one node runs at a time; check the last active one first.
+	active := ""
+	if tray.active != "" && serviceActive(tray.active) {
+		active = tray.active
+	} else {
+		for _, n := range nodes {
+			if serviceActive(n.ServiceName) {
+				active = n.ServiceName
+				break
+			}
+		}
+	}
+	if active != tray.active {
+		if tray.meterStop != nil {
+			close(tray.meterStop)
+			tray.meterStop = nil
+		}
+		if active != "" {
+			tray.meterStop = make(chan struct{})
+			go trayMeter(active, tray.meterStop)
+		}
+	}
+	tray.active = active
+	if active != "" {
+		tray.err = nil
+	}
+
+	title, state := "Disconnected", "disconnected"
+	switch {
+	case tray.busy:
+		title = "Connecting…"
+	case active != "":
+		title, state = "Connected: "+trayNodeName(active), "connected"
+	case tray.err != nil:
+		title, state = "Error: "+tray.err.Error(), "error"
+	}
+	tray.tooltip = "XStream – " + title
+	trayIcon.SetTooltip(tray.tooltip)
+	if state != tray.state {
+		tray.state = state
+		trayIcon.SetIcon(trayStateIcon(state))
+	}
+	if key := fmt.Sprint(title, nodes, tray.busy); key != tray.menu {
+		tray.menu = key
+		trayIcon.SetMenu(trayMenu(title))
+	}
+}
+
+// trayMeter shows the throughput of service in the tooltip every trayPoll
+// until stop is closed.
+func trayMeter(service string, stop chan struct{}) {
+	p, ok := serviceManager.(platform.PIDer)
+	if !ok {
+		return
+	}
+	var meter traffic.Meter
+	t := time.NewTicker(trayPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		pid, err := p.MainPID(service)
+		if err != nil {
+			continue
+		}
+		rate, err := meter.Sample(pid)
+		if err != nil {
+			continue
+		}
+		tray.Lock()
+		select {
+		case <-stop:
+		default:
+			trayIcon.SetTooltip(tray.tooltip + " · " + traffic.Format(rate))
+		}
+		tray.Unlock()
+	}
+}
+
+// trayMenu builds the menu; tray is locked.
+func trayMenu(status string) []platform.MenuItem {
+	var nodes []platform.MenuItem
+	for _, n := range tray.nodes {
+		service := n.ServiceName
+		nodes = append(nodes, platform.MenuItem{
+			Title:     n.Name,
+			Tooltip:   "Connect to " + n.Name,
+			Checkable: true,
+			Checked:   service == tray.active,
+			Disabled:  tray.busy,
+			Click:     func() { go trayConnect(service) },
+		})
+	}
+	if len(nodes) == 0 {
+		nodes = []platform.MenuItem{{Title: "No nodes", Disabled: true}}
+	}
+	return []platform.MenuItem{
+		{Title: status, Disabled: true},
+		{Title: "Nodes", Items: nodes},
+		{Title: "Disconnect", Tooltip: "Stop the running node", Disabled: tray.active == "" || tray.busy, Click: func() { go trayDisconnect() }},
+		{Title: "Show", Tooltip: "Show window", Click: showMainWindow},
+		{Title: "Quit", Tooltip: "Disconnect and quit", Click: func() { go trayQuit() }},
+	}
+}
+
+func trayNodeName(service string) string {
+	for _, n := range tray.nodes {
+		if n.ServiceName == service {
+			return n.Name
+		}
+	}
+	return service
+}
+
+var trayColors = map[string]color.Color{
+	"connected":    color.NRGBA{0x2e, 0x7d, 0x32, 0xff},
+	"disconnected": color.NRGBA{0x9e, 0x9e, 0x9e, 0xff},
+	"error":        color.NRGBA{0xc6, 0x28, 0x28, 0xff},
+}
+
+func trayStateIcon(state string) []byte {
+	return statusicon.Badge(tray.logo, trayColors[state])
+}
+
+// trayAction runs fn with the menu marked busy and records its error.
+func trayAction(fn func() error) {
+	tray.Lock()
+	if tray.busy {
+		tray.Unlock()
+		return
+	}
+	tray.busy = true
+	tray.Unlock()
+	refreshTray()
+	err := fn()
+	tray.Lock()
+	tray.busy = false
+	tray.err = err
+	tray.Unlock()
+	refreshTray()
+}
+
+// trayConnect switches to service, stopping the running node first.
+func trayConnect(service string) {
+	trayAction(func() error {
+		tray.Lock()
+		active := tray.active
+		tray.Unlock()
+		if active == service {
+			return nil
+		}
+		if active != "" {
+			if err := stopNode(active); err != nil {
+				return err
+			}
+		}
+		_, err := startNode(service)
+		return err
+	})
+}
+
+func trayDisconnect() {
+	trayAction(func() error {
+		tray.Lock()
+		active := tray.active
+		tray.Unlock()
+		if active == "" {
+			return nil
+		}
+		return stopNode(active)
+	})
+}
+
+// trayQuit stops the running node and asks the app to quit. When the app
+// does not poll for events within a grace period, the runner is asked to
+// end its main loop instead, so the app still shuts down in order.
+func trayQuit() {
+	tray.Lock()
+	active := tray.active
+	tray.Unlock()
+	if active != "" {
+		if err := stopNode(active); err != nil {
+			fmt.Println("Stop node on quit failed:", err)
+		}
+	}
+	emit("app.quit", nil)
+	trayIcon.Quit()
+	if !waitPolled(3 * time.Second) {
+		if err := quitApp(); err != nil {
+			fmt.Println("Quit app failed:", err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "C"
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Window behaviours: what minimizing and closing the main window do.
+const (
+	// behaviorHide hides a minimized window; the tray brings it back.
+	behaviorHide = "hide"
+	// behaviorMinimize leaves minimizing and closing alone.
+	behaviorMinimize = "minimize"
+	// behaviorClose hides the window instead of closing it; minimizing
+	// works as usual.
+	behaviorClose = "close"
+)
+
+var windowBehavior = struct {
+	sync.Mutex
+	value string
+}{value: behaviorHide}
+
+func init() {
+	register("window.behavior", func(json.RawMessage) (any, error) {
+		return map[string]string{"behavior": currentWindowBehavior()}, nil
+	})
+	register("window.setBehavior", func(p json.RawMessage) (any, error) {
+		var args struct {
+			Behavior string `json:"behavior"`
+		}
+		if err := decode(p, &args); err != nil {
+			return nil, err
+		}
+		return nil, setWindowBehavior(args.Behavior)
+	})
+}
+
+// SetWindowBehavior sets what minimizing and closing the main window do:
+// "hide" (minimize to tray, the default), "minimize" or "close" (close to
+// tray).
+//
+//export SetWindowBehavior
+func SetWindowBehavior(behavior *C.char) *C.char {
+	return legacy(nil, setWindowBehavior(C.GoString(behavior)))
+}
+
+func setWindowBehavior(behavior string) error {
+	switch behavior {
+	case behaviorHide, behaviorMinimize, behaviorClose:
+	default:
+		return fail(codeInvalidParams, fmt.Errorf("unknown window behavior %q", behavior))
+	}
+	// The platform files pass it on to the runner, which handles the
+	// window's own minimize and close events.
+	if err := applyWindowBehavior(behavior); err != nil {
+		return err
+	}
+	windowBehavior.Lock()
+	windowBehavior.value = behavior
+	windowBehavior.Unlock()
+	return nil
+}
+
+func currentWindowBehavior() string {
+	windowBehavior.Lock()
+	defer windowBehavior.Unlock()
+	return windowBehavior.value
+}
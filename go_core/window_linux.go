@@ -0,0 +1,206 @@
+//go:build linux
+
+package main
+
+/*
+#cgo LDFLAGS: -lX11
+#include <stdlib.h>
+#include <string.h>
+#include <X11/Xlib.h>
+#include <X11/Xatom.h>
+#include <X11/Xutil.h>
+
+// The window may go away between finding it and using it; the default
+// handler would exit the process on the resulting BadWindow.
+static int ignoreError(Display* d, XErrorEvent* e) {
+    return 0;
+}
+
+// Each user opens its own connection: Xlib is not thread safe.
+static Display* openDisplay() {
+    XSetErrorHandler(ignoreError);
+    return XOpenDisplay(NULL);
+}
+
+static Window findWindow(Display* disp, const char* name) {
+    Atom clientList = XInternAtom(disp, "_NET_CLIENT_LIST", True);
+    Atom type;
+    int format;
+    unsigned long nitems, bytes;
+    unsigned char* data = NULL;
+    Window found = 0;
+    if (XGetWindowProperty(disp, DefaultRootWindow(disp), clientList, 0, 1024, False, XA_WINDOW, &type, &format, &nitems, &bytes, &data) == Success && data) {
+        Window* list = (Window*)data;
+        for (unsigned long i=0; i<nitems && found==0; i++) {
+            char* wname = NULL;
+            if (XFetchName(disp, list[i], &wname) > 0) {
+                if (wname && strcmp(wname, name)==0) {
+                    found = list[i];
+                }
+                if (wname) XFree(wname);
+            }
+        }
+        XFree(data);
+    }
+    return found;
+}
+
+static int isIconic(Display* disp, Window win) {
+    Atom WM_STATE = XInternAtom(disp, "WM_STATE", True);
+    Atom type; int format; unsigned long items, bytes; unsigned char* prop=NULL;
+    if (XGetWindowProperty(disp, win, WM_STATE, 0, 2, False, WM_STATE, &type, &format, &items, &bytes, &prop) == Success && prop) {
+        long state = *(long*)prop;
+        XFree(prop);
+        return state == IconicState;
+    }
+    return 0;
+}
+
+static void hideWindow(Display* disp, Window win) {
+    XUnmapWindow(disp, win);
+    XFlush(disp);
+}
+
+static void showWindow(Display* disp, Window win) {
+    XMapRaised(disp, win);
+    XFlush(disp);
+}
+
+// Events waitEvent reports.
+enum { eventOther, eventClientList, eventState, eventDestroyed };
+
+static void selectRoot(Display* disp) {
+    XSelectInput(disp, DefaultRootWindow(disp), PropertyChangeMask);
+}
+
+static void selectWindow(Display* disp, Window win) {
+    XSelectInput(disp, win, PropertyChangeMask | StructureNotifyMask);
+}
+
+// waitEvent blocks for the next event: a change of the root's client list,
+// of win's WM_STATE, or win being destroyed.
+static int waitEvent(Display* disp, Window win) {
+    XEvent ev;
+    XNextEvent(disp, &ev);
+    switch (ev.type) {
+    case PropertyNotify:
+        if (ev.xproperty.window == DefaultRootWindow(disp) &&
+            ev.xproperty.atom == XInternAtom(disp, "_NET_CLIENT_LIST", False)) {
+            return eventClientList;
+        }
+        if (win != 0 && ev.xproperty.window == win &&
+            ev.xproperty.atom == XInternAtom(disp, "WM_STATE", False)) {
+            return eventState;
+        }
+        break;
+    case DestroyNotify:
+        if (win != 0 && ev.xdestroywindow.window == win) {
+            return eventDestroyed;
+        }
+        break;
+    }
+    return eventOther;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"go_core/internal/platform/appwindow"
+)
+
+// The runner's D-Bus window interface is used when it is on the bus, which
+// also covers Wayland. Otherwise the window is looked up through X11, which
+// needs DISPLAY.
+
+func findMainWindow(disp *C.Display) C.Window {
+	cname := C.CString("xstream")
+	defer C.free(unsafe.Pointer(cname))
+	return C.findWindow(disp, cname)
+}
+
+func showMainWindow() {
+	if appwindow.Available() {
+		err := appwindow.Show()
+		if err == nil {
+			return
+		}
+		fmt.Println("Show window over D-Bus failed:", err)
+	}
+	if os.Getenv("DISPLAY") == "" {
+		return
+	}
+	disp := C.openDisplay()
+	if disp == nil {
+		return
+	}
+	defer C.XCloseDisplay(disp)
+	if win := findMainWindow(disp); win != 0 {
+		C.showWindow(disp, win)
+	}
+}
+
+// monitorMinimize hides the main window when it is minimized, if the
+// behaviour is "hide". A runner with the window interface handles its own
+// window, so this only watches X11 for older runners. It blocks on X
+// events: the window's WM_STATE changes, and the root's client list so a
+// recreated window is picked up.
+func monitorMinimize() {
+	if appwindow.Available() || os.Getenv("DISPLAY") == "" {
+		return
+	}
+	runtime.LockOSThread()
+	disp := C.openDisplay()
+	if disp == nil {
+		return
+	}
+	C.selectRoot(disp)
+	var win C.Window
+	track := func() {
+		if win == 0 {
+			if win = findMainWindow(disp); win != 0 {
+				C.selectWindow(disp, win)
+			}
+		}
+	}
+	track()
+	for {
+		switch C.waitEvent(disp, win) {
+		case C.eventClientList:
+			track()
+		case C.eventDestroyed:
+			win = 0
+			track()
+		case C.eventState:
+			// The runner may have come onto the bus since; it then hides
+			// the window itself.
+			if currentWindowBehavior() == behaviorHide && C.isIconic(disp, win) != 0 && !appwindow.Available() {
+				C.hideWindow(disp, win)
+			}
+		}
+	}
+}
+
+// quitApp asks the runner to end its main loop.
+func quitApp() error {
+	if !appwindow.Available() {
+		return fmt.Errorf("the runner's window interface is not on the bus")
+	}
+	return appwindow.Quit()
+}
+
+// applyWindowBehavior passes the behaviour to the runner. Without the
+// window interface, monitorMinimize applies "hide"; closing cannot be
+// intercepted from outside the runner.
+func applyWindowBehavior(behavior string) error {
+	if appwindow.Available() {
+		return appwindow.SetBehavior(behavior)
+	}
+	if behavior == behaviorClose {
+		return fail(codeUnsupported, fmt.Errorf("close to tray needs the runner's window interface"))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                  = windows.NewLazySystemDLL("user32.dll")
+	procFindWindowW         = user32.NewProc("FindWindowW")
+	procIsWindow            = user32.NewProc("IsWindow")
+	procShowWindow          = user32.NewProc("ShowWindow")
+	procSetForegroundWindow = user32.NewProc("SetForegroundWindow")
+	procSetPropW            = user32.NewProc("SetPropW")
+
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	procPostThreadMessageW       = user32.NewProc("PostThreadMessageW")
+)
+
+// behaviorProp is the window property the runner reads on minimize and
+// close (windows/runner/flutter_window.cpp); its value is the index into
+// windowBehaviors.
+const behaviorProp = "XStreamWindowBehavior"
+
+var windowBehaviors = []string{behaviorHide, behaviorMinimize, behaviorClose}
+
+// findMainWindow looks the window up on every use, so a recreated window
+// is found too.
+func findMainWindow() windows.Handle {
+	title, _ := windows.UTF16PtrFromString("xstream")
+	h, _, _ := procFindWindowW.Call(0, uintptr(unsafe.Pointer(title)))
+	if h != 0 {
+		if ok, _, _ := procIsWindow.Call(h); ok == 0 {
+			return 0
+		}
+	}
+	return windows.Handle(h)
+}
+
+func showWindow(h windows.Handle, cmd int32) {
+	procShowWindow.Call(uintptr(h), uintptr(cmd))
+}
+
+// monitorMinimize has nothing to do: the runner hides the window itself,
+// as set with SetWindowBehavior.
+func monitorMinimize() {}
+
+func showMainWindow() {
+	if h := findMainWindow(); h != 0 {
+		showWindow(h, windows.SW_RESTORE)
+		procSetForegroundWindow.Call(uintptr(h))
+	}
+}
+
+// quitApp posts WM_QUIT to the runner's UI thread, which ends its message
+// loop (windows/runner/main.cpp) as closing the window does.
+func quitApp() error {
+	h := findMainWindow()
+	if h == 0 {
+		return fmt.Errorf("main window not found")
+	}
+	tid, _, _ := procGetWindowThreadProcessId.Call(uintptr(h), 0)
+	const wmQuit = 0x0012
+	if ok, _, err := procPostThreadMessageW.Call(tid, wmQuit, 0, 0); ok == 0 {
+		return err
+	}
+	return nil
+}
+
+func applyWindowBehavior(behavior string) error {
+	h := findMainWindow()
+	if h == 0 {
+		return fail(codeNotFound, fmt.Errorf("main window not found"))
+	}
+	name, _ := windows.UTF16PtrFromString(behaviorProp)
+	for i, b := range windowBehaviors {
+		if b == behavior {
+			procSetPropW.Call(uintptr(h), uintptr(unsafe.Pointer(name)), uintptr(i))
+		}
+	}
+	return nil
+}
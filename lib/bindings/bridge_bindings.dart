@@ -39,6 +39,14 @@ typedef StartXrayNative = ffi.Pointer<ffi.Char> Function(ffi.Pointer<ffi.Char>);
 typedef StartXrayDart = ffi.Pointer<ffi.Char> Function(ffi.Pointer<ffi.Char>);
 typedef StopXrayNative = ffi.Pointer<ffi.Char> Function();
 typedef StopXrayDart = ffi.Pointer<ffi.Char> Function();
+typedef GetBridgeInfoNative = ffi.Pointer<ffi.Char> Function();
+typedef GetBridgeInfoDart = ffi.Pointer<ffi.Char> Function();
+typedef InitTrayNative = ffi.Void Function();
+typedef InitTrayDart = void Function();
+typedef CallNative = ffi.Pointer<ffi.Char> Function(
+  ffi.Pointer<ffi.Char>, ffi.Pointer<ffi.Char>);
+typedef CallDart = ffi.Pointer<ffi.Char> Function(
+  ffi.Pointer<ffi.Char>, ffi.Pointer<ffi.Char>);
 
 class BridgeBindings {
   BridgeBindings(ffi.DynamicLibrary lib)
@@ -61,7 +69,18 @@ class BridgeBindings {
         startXray =
             lib.lookupFunction<StartXrayNative, StartXrayDart>('StartXray'),
         stopXray =
-            lib.lookupFunction<StopXrayNative, StopXrayDart>('StopXray');
+            lib.lookupFunction<StopXrayNative, StopXrayDart>('StopXray'),
+        // Libraries built before ABI 2 lack Call and GetBridgeInfo.
+        call = lib.providesSymbol('Call')
+            ? lib.lookupFunction<CallNative, CallDart>('Call')
+            : null,
+        getBridgeInfo = lib.providesSymbol('GetBridgeInfo')
+            ? lib.lookupFunction<GetBridgeInfoNative, GetBridgeInfoDart>('GetBridgeInfo')
+            : null,
+        // The iOS library has no tray.
+        initTray = lib.providesSymbol('InitTray')
+            ? lib.lookupFunction<InitTrayNative, InitTrayDart>('InitTray')
+            : null;
 
   final StartNodeServiceDart startNodeService;
   final CreateWindowsServiceDart createWindowsService;
@@ -73,4 +92,7 @@ class BridgeBindings {
   final IsXrayDownloadingDart isXrayDownloading;
   final StartXrayDart startXray;
   final StopXrayDart stopXray;
+  final CallDart? call;
+  final GetBridgeInfoDart? getBridgeInfo;
+  final InitTrayDart? initTray;
 }
@@ -53,6 +53,17 @@ class AppLocalizations {
       'primaryDns': 'Primary DNS',
       'secondaryDns': 'Secondary DNS',
       'globalProxy': 'Global Proxy',
+      'windowBehavior': 'When Minimized or Closed',
+      'windowHide': 'Minimize to tray',
+      'windowMinimize': 'Minimize normally',
+      'windowClose': 'Close to tray',
+      'notifications': 'Notifications',
+      'notify.node.connected': 'Connected',
+      'notify.node.disconnected': 'Disconnected',
+      'notify.node.failed': 'Connection lost',
+      'notify.core.updated': 'Core updated',
+      'notify.core.updateFailed': 'Core update failed',
+      'notify.subscription.expiring': 'Subscription expiring',
       'experimentalFeatures': 'Experimental Features',
       'tunnelProxyMode': 'Tunnel Mode',
       'modeSwitch': 'Switch Connection Mode',
@@ -114,6 +125,17 @@ class AppLocalizations {
       'primaryDns': '主 DNS',
       'secondaryDns': '备用 DNS',
       'globalProxy': '全局代理',
+      'windowBehavior': '最小化/关闭窗口时',
+      'windowHide': '最小化到托盘',
+      'windowMinimize': '正常最小化',
+      'windowClose': '关闭到托盘',
+      'notifications': '通知',
+      'notify.node.connected': '已连接',
+      'notify.node.disconnected': '已断开',
+      'notify.node.failed': '连接意外中断',
+      'notify.core.updated': '核心更新完成',
+      'notify.core.updateFailed': '核心更新失败',
+      'notify.subscription.expiring': '订阅即将到期',
       'experimentalFeatures': '实验特性',
       'tunnelProxyMode': '隧道模式',
       'modeSwitch': '切换连接模式',
@@ -1,3 +1,4 @@
+import 'dart:async';
 import 'dart:io';
 import 'package:flutter/material.dart';
 import 'screens/home_screen.dart';
@@ -10,9 +11,11 @@ import 'package:flutter_localizations/flutter_localizations.dart';
 import 'l10n/app_localizations.dart';
 import 'utils/app_theme.dart';
 import 'utils/native_bridge.dart';
-import 'utils/global_config.dart' show GlobalState, DnsConfig;
+import 'utils/global_config.dart'
+    show GlobalState, DnsConfig, WindowBehaviorConfig;
 import 'services/experimental/experimental_features.dart';
 import 'utils/app_logger.dart';
+import 'widgets/log_console.dart' show LogLevel;
 import 'services/telemetry/telemetry_service.dart';
 import 'services/vpn_config_service.dart';
 import 'services/global_proxy_service.dart';
@@ -20,8 +23,14 @@ import 'services/permission_guide_service.dart';
 
 void main(List<String> args) async {
   WidgetsFlutterBinding.ensureInitialized();
+  // A second launch hands its arguments to the running instance and exits.
+  if ((Platform.isLinux || Platform.isWindows) &&
+      !NativeBridge.acquireInstance(args)) {
+    exit(0);
+  }
   await TelemetryService.init();
   await DnsConfig.init();
+  await WindowBehaviorConfig.init();
   await GlobalProxyService.init();
   await PermissionGuideService.init();
   await ExperimentalFeatures.init();
@@ -83,12 +92,56 @@ class _MainPageState extends State<MainPage> with WidgetsBindingObserver {
     });
 
     GlobalState.connectionMode.addListener(_onConnectionModeChanged);
+
+    if (Platform.isLinux || Platform.isWindows) {
+      NativeBridge.initTray();
+      _events = NativeBridge.events.listen(_onBridgeEvent);
+      _applyWindowBehavior();
+      WindowBehaviorConfig.behavior.addListener(_applyWindowBehavior);
+    }
+  }
+
+  StreamSubscription<Map<String, dynamic>>? _events;
+
+  Future<void> _onBridgeEvent(Map<String, dynamic> event) async {
+    if (event['type'] == 'app.quit') {
+      // The tray has already stopped the running node.
+      await VpnConfig.saveToFile();
+      exit(0);
+    }
+    if (event['type'] == 'notification.action' &&
+        event['data']?['action'] == 'logs') {
+      setState(() => _currentIndex = 3);
+    }
+    if (event['type'] == 'network.changed') {
+      final data = event['data'] as Map<String, dynamic>;
+      addAppLog('网络变化 (${data['reason']}): 默认出口 ${data['interface']}');
+    }
+    if (event['type'] == 'netrules.applied') {
+      final data = event['data'] as Map<String, dynamic>;
+      addAppLog('网络规则 ${data['rule']}: ${data['action']} ${data['node']}');
+    }
+    if (event['type'] == 'instance.args') {
+      // The window is already raised; links such as xstream:// arrive here.
+      final args = (event['data']?['args'] as List<dynamic>?) ?? const [];
+      addAppLog('再次启动，参数: ${args.join(' ')}');
+    }
+  }
+
+  void _applyWindowBehavior() {
+    final res =
+        NativeBridge.setWindowBehavior(WindowBehaviorConfig.behavior.value);
+    if (!res.ok) {
+      addAppLog('设置窗口行为失败: ${res.message}', level: LogLevel.warning);
+    }
   }
 
   @override
   void dispose() {
     WidgetsBinding.instance.removeObserver(this); // ✅ 注销生命周期观察器
     GlobalState.connectionMode.removeListener(_onConnectionModeChanged);
+    WindowBehaviorConfig.behavior.removeListener(_applyWindowBehavior);
+    _events?.cancel();
     super.dispose();
   }
 
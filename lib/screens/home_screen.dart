@@ -1,5 +1,6 @@
 // lib/screens/home_screen.dart
 
+import 'dart:async';
 import 'dart:io';
 
 import 'package:flutter/material.dart';
@@ -32,10 +33,34 @@ class _HomeScreenState extends State<HomeScreen> {
     ).showSnackBar(SnackBar(content: Text(msg), backgroundColor: bgColor));
   }
 
+  StreamSubscription<Map<String, dynamic>>? _events;
+
   @override
   void initState() {
     super.initState();
     _initializeConfig();
+    if (Platform.isLinux || Platform.isWindows) {
+      _events = NativeBridge.events.listen(_onBridgeEvent);
+    }
+  }
+
+  @override
+  void dispose() {
+    _events?.cancel();
+    super.dispose();
+  }
+
+  /// Follow nodes started or stopped outside this screen, e.g. from the tray.
+  void _onBridgeEvent(Map<String, dynamic> event) {
+    final service = (event['data'] as Map<String, dynamic>?)?['service'];
+    final node = vpnNodes.where((n) => n.serviceName == service).firstOrNull;
+    if (node == null || !mounted) return;
+    switch (event['type']) {
+      case 'node.started':
+        setState(() => _activeNode = node.name);
+      case 'node.stopped':
+        if (_activeNode == node.name) setState(() => _activeNode = '');
+    }
   }
 
   Future<void> _initializeConfig() async {
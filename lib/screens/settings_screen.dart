@@ -3,7 +3,7 @@ import 'dart:convert';
 import 'dart:io';
 import 'package:flutter/material.dart';
 import '../../utils/global_config.dart'
-    show GlobalState, buildVersion, DnsConfig;
+    show GlobalState, buildVersion, DnsConfig, WindowBehaviorConfig;
 import '../../utils/native_bridge.dart';
 import '../l10n/app_localizations.dart';
 import '../../services/vpn_config_service.dart';
@@ -263,6 +263,38 @@ class _SettingsScreenState extends State<SettingsScreen> {
                           ),
                         ),
                       ),
+                      if (Platform.isLinux)
+                        _buildButton(
+                          icon: Icons.notifications,
+                          label: context.l10n.get('notifications'),
+                          onPressed: _showNotificationsDialog,
+                        ),
+                      if (Platform.isLinux || Platform.isWindows)
+                        ListTile(
+                          leading: const Icon(Icons.minimize),
+                          title: Text(context.l10n.get('windowBehavior'),
+                              style: _menuTextStyle),
+                          trailing: DropdownButton<String>(
+                            value: WindowBehaviorConfig.behavior.value,
+                            items: [
+                              for (final b in const [
+                                ['hide', 'windowHide'],
+                                ['minimize', 'windowMinimize'],
+                                ['close', 'windowClose'],
+                              ])
+                                DropdownMenuItem(
+                                  value: b[0],
+                                  child: Text(context.l10n.get(b[1]),
+                                      style: _menuTextStyle),
+                                ),
+                            ],
+                            onChanged: (v) {
+                              if (v == null) return;
+                              setState(
+                                  () => WindowBehaviorConfig.behavior.value = v);
+                            },
+                          ),
+                        ),
                     ]),
                     _buildSection(context.l10n.get('experimentalFeatures'), [
                       SizedBox(
@@ -375,6 +407,53 @@ class _SettingsScreenState extends State<SettingsScreen> {
     );
   }
 
+  void _showNotificationsDialog() {
+    final res = NativeBridge.call('notify.get');
+    if (!res.ok) {
+      addAppLog('读取通知设置失败: ${res.message}', level: LogLevel.error);
+      return;
+    }
+    final events = Map<String, bool>.from(
+        (res.data as Map<String, dynamic>)['events'] as Map<String, dynamic>);
+    showDialog(
+      context: context,
+      builder: (context) => StatefulBuilder(
+        builder: (context, setDialogState) => AlertDialog(
+          title: Text(context.l10n.get('notifications')),
+          content: Column(
+            mainAxisSize: MainAxisSize.min,
+            children: [
+              for (final name in events.keys)
+                SwitchListTile(
+                  title: Text(context.l10n.get('notify.$name'),
+                      style: _menuTextStyle),
+                  value: events[name]!,
+                  onChanged: (v) => setDialogState(() => events[name] = v),
+                ),
+            ],
+          ),
+          actions: [
+            TextButton(
+              onPressed: () => Navigator.pop(context),
+              child: Text(context.l10n.get('cancel')),
+            ),
+            TextButton(
+              onPressed: () {
+                final res = NativeBridge.call('notify.set', {'events': events});
+                if (!res.ok) {
+                  addAppLog('保存通知设置失败: ${res.message}',
+                      level: LogLevel.error);
+                }
+                Navigator.pop(context);
+              },
+              child: Text(context.l10n.get('confirm')),
+            ),
+          ],
+        ),
+      ),
+    );
+  }
+
   void _showTelemetryData() {
     final data = TelemetryService.collectData(appVersion: buildVersion);
     final json = const JsonEncoder.withIndent('  ').convert(data);
@@ -333,7 +333,12 @@ class VpnConfig {
           );
         case 'linux':
           final xrayPath = await GlobalApplicationConfig.getXrayExePath();
-          return renderXrayService(xrayPath: xrayPath, configPath: configPath);
+          final assetPath = await GlobalApplicationConfig.getXrayAssetPath();
+          return renderXrayService(
+            xrayPath: xrayPath,
+            assetPath: assetPath,
+            configPath: configPath,
+          );
         case 'windows':
           final xrayPath = await GlobalApplicationConfig.getXrayExePath();
           return renderXrayServiceWindows(
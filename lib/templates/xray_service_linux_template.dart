@@ -5,6 +5,7 @@ Description=Xray Service
 After=network.target
 
 [Service]
+Environment=XRAY_LOCATION_ASSET=<ASSET_PATH>
 ExecStart=<XRAY_PATH> run -c <CONFIG_PATH>
 Restart=on-failure
 
@@ -14,9 +15,11 @@ WantedBy=default.target
 
 String renderXrayService({
   required String xrayPath,
+  required String assetPath,
   required String configPath,
 }) {
   return defaultXrayServiceTemplate
       .replaceAll('<XRAY_PATH>', xrayPath)
+      .replaceAll('<ASSET_PATH>', assetPath)
       .replaceAll('<CONFIG_PATH>', configPath);
 }
@@ -4,6 +4,7 @@ import 'package:path_provider/path_provider.dart';
 import 'package:flutter/material.dart';
 import 'package:shared_preferences/shared_preferences.dart';
 import '../widgets/log_console.dart';
+import 'native_bridge.dart';
 
 const String kUpdateBaseUrl = 'https://artifact.onwalk.net/';
 
@@ -93,6 +94,20 @@ class DnsConfig {
   }
 }
 
+/// 管理窗口最小化/关闭行为（hide、minimize、close），支持保存到本地
+class WindowBehaviorConfig {
+  static const _behaviorKey = 'windowBehavior';
+
+  static final ValueNotifier<String> behavior = ValueNotifier<String>('hide');
+
+  static Future<void> init() async {
+    final prefs = await SharedPreferences.getInstance();
+    behavior.value = prefs.getString(_behaviorKey) ?? behavior.value;
+
+    behavior.addListener(() => prefs.setString(_behaviorKey, behavior.value));
+  }
+}
+
 /// 用于获取应用相关的配置信息
 class GlobalApplicationConfig {
   /// 沙盒化应用目录结构管理
@@ -200,8 +215,11 @@ class GlobalApplicationConfig {
       case 'windows':
         return '$windowsBasePath\\xray.exe';
       case 'linux':
+        // go_core 解析核心位置：已有的安装，否则为按用户安装的目录
+        final path = _linuxXrayCore()?['path'] as String?;
+        if (path != null && path.isNotEmpty) return path;
         final home = Platform.environment['HOME'] ?? '~';
-        return '$home/.local/bin/xray';
+        return '$home/.local/share/xstream/bin/xray';
       default:
         final baseDir = await getApplicationSupportDirectory();
         final binDir = Directory('${baseDir.path}/bin');
@@ -209,6 +227,22 @@ class GlobalApplicationConfig {
         return '${binDir.path}/xray';
     }
   }
+
+  /// Linux 下 geo 数据目录，核心所在目录不可写时与其不同，由服务传给 xray
+  static Future<String> getXrayAssetPath() async {
+    final assets = _linuxXrayCore()?['assets'] as String?;
+    if (assets != null && assets.isNotEmpty) return assets;
+    final exe = await getXrayExePath();
+    return File(exe).parent.path;
+  }
+
+  static Map<String, dynamic>? _linuxXrayCore() {
+    try {
+      return NativeBridge.bridgeInfo()?['xrayCore'] as Map<String, dynamic>?;
+    } catch (_) {
+      return null;
+    }
+  }
   /// 从配置文件或默认值中获取 PRODUCT_BUNDLE_IDENTIFIER
   static Future<String> getBundleId() async {
     if (Platform.isMacOS) {
@@ -1,3 +1,5 @@
+import 'dart:async';
+import 'dart:convert';
 import 'dart:io';
 import 'dart:ffi' as ffi;
 import 'package:flutter/services.dart';
@@ -391,4 +393,108 @@ class NativeBridge {
     _ffi.freeCString(resPtr);
     return result;
   }
+
+  /// Describe the loaded native library: `abi`, `goVersion`, `commit`,
+  /// `platform`, `xrayCore` and `capabilities`. Returns null when the
+  /// library predates GetBridgeInfo, i.e. it is stale.
+  static Map<String, dynamic>? bridgeInfo() {
+    if (!_useFfi) return null;
+    final fn = _ffi.getBridgeInfo;
+    if (fn == null) return null;
+    final resPtr = fn();
+    final result = resPtr.cast<Utf8>().toDartString();
+    _ffi.freeCString(resPtr);
+    return jsonDecode(result) as Map<String, dynamic>;
+  }
+
+  /// Whether the native library advertises [capability], e.g. `killswitch`.
+  static bool hasCapability(String capability) {
+    final caps = bridgeInfo()?['capabilities'] as List<dynamic>?;
+    return caps?.contains(capability) ?? false;
+  }
+
+  /// Invoke a go_core method through the generic `Call` entrypoint.
+  /// Operations added on the Go side need no new FFI typedefs.
+  static BridgeResponse call(String method, [Map<String, dynamic>? params]) {
+    if (!_useFfi) {
+      throw UnsupportedError('FFI not available');
+    }
+    final fn = _ffi.call;
+    if (fn == null) {
+      return const BridgeResponse(
+          ok: false, code: 'unsupported', message: 'native library too old');
+    }
+    final methodPtr = method.toNativeUtf8();
+    final paramsPtr = jsonEncode(params ?? const {}).toNativeUtf8();
+    final resPtr = fn(methodPtr.cast(), paramsPtr.cast());
+    final result = resPtr.cast<Utf8>().toDartString();
+    _ffi.freeCString(resPtr);
+    malloc.free(methodPtr);
+    malloc.free(paramsPtr);
+    return BridgeResponse.fromJson(jsonDecode(result) as Map<String, dynamic>);
+  }
+
+  /// Show the tray icon with the node menu (Linux and Windows).
+  static void initTray() {
+    if (!_useFfi) return;
+    _ffi.initTray?.call();
+  }
+
+  /// Take the per-user instance lock, or hand [args] to the instance that
+  /// already holds it. Returns false when this process should exit. A
+  /// library without the lock always lets the app start.
+  static bool acquireInstance(List<String> args) {
+    if (!_useFfi) return true;
+    final res = call('instance.acquire', {'args': args});
+    if (!res.ok) return true;
+    return (res.data as Map<String, dynamic>)['primary'] as bool;
+  }
+
+  /// Set what minimizing and closing the main window do: `hide` (minimize
+  /// to tray), `minimize` or `close` (close to tray). Linux and Windows.
+  static BridgeResponse setWindowBehavior(String behavior) =>
+      call('window.setBehavior', {'behavior': behavior});
+
+  /// Events from the Go side, e.g. `node.started` and `node.stopped` with
+  /// `{"service": ...}`, or `app.quit` from the tray. Polled once a second
+  /// while anyone listens.
+  static Stream<Map<String, dynamic>> get events => _events.stream;
+
+  static Timer? _eventTimer;
+  static final StreamController<Map<String, dynamic>> _events =
+      StreamController<Map<String, dynamic>>.broadcast(
+    onListen: () {
+      _eventTimer = Timer.periodic(const Duration(seconds: 1), (_) {
+        final res = call('events.poll');
+        if (!res.ok) return;
+        for (final e in res.data as List<dynamic>) {
+          _events.add(e as Map<String, dynamic>);
+        }
+      });
+    },
+    onCancel: () => _eventTimer?.cancel(),
+  );
+}
+
+/// Envelope returned by [NativeBridge.call]. [code] is stable across
+/// releases, e.g. `ok`, `invalid_params`, `unsupported`, `port_conflict`.
+class BridgeResponse {
+  final bool ok;
+  final String code;
+  final String message;
+  final dynamic data;
+
+  const BridgeResponse({
+    required this.ok,
+    required this.code,
+    this.message = '',
+    this.data,
+  });
+
+  factory BridgeResponse.fromJson(Map<String, dynamic> json) => BridgeResponse(
+        ok: json['ok'] as bool? ?? false,
+        code: json['code'] as String? ?? 'failed',
+        message: json['message'] as String? ?? '',
+        data: json['data'],
+      );
 }
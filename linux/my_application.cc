@@ -7,31 +7,136 @@
 
 #include "flutter/generated_plugin_registrant.h"
 
+// The window interface the Go library uses to show and hide the window from
+// the tray. Unlike looking the window up through X11 it works on Wayland.
+// The names must match go_core/internal/platform/appwindow.
+static const char kWindowBusName[] = "com.xstream.Window";
+static const char kWindowObjectPath[] = "/com/xstream/Window";
+static const char kWindowIntrospection[] =
+    "<node>"
+    "  <interface name='com.xstream.Window'>"
+    "    <method name='Show'/>"
+    "    <method name='Hide'/>"
+    "    <method name='Toggle'/>"
+    "    <method name='Quit'/>"
+    "    <method name='SetBehavior'>"
+    "      <arg name='behavior' type='s' direction='in'/>"
+    "    </method>"
+    "    <property name='Visible' type='b' access='read'/>"
+    "  </interface>"
+    "</node>";
+
+// What minimizing and closing the window do, as set by the app through the
+// Go library (SetWindowBehavior).
+typedef enum {
+  WINDOW_BEHAVIOR_HIDE,      // minimizing hides the window to the tray
+  WINDOW_BEHAVIOR_MINIMIZE,  // minimizing and closing work as usual
+  WINDOW_BEHAVIOR_CLOSE,     // closing hides the window to the tray
+} WindowBehavior;
+
 struct _MyApplication {
   GtkApplication parent_instance;
   char** dart_entrypoint_arguments;
-  GtkStatusIcon* tray_icon;
   GtkWindow* main_window;
+  WindowBehavior behavior;
+  GDBusNodeInfo* window_info;
+  guint window_bus_id;
 };
 
-static void tray_icon_activate(GtkStatusIcon* status_icon, gpointer user_data) {
+static void show_main_window(MyApplication* self) {
+  gtk_widget_show(GTK_WIDGET(self->main_window));
+  gtk_window_deiconify(self->main_window);
+  gtk_window_present(self->main_window);
+}
+
+static void window_method_call(GDBusConnection* connection, const gchar* sender,
+                               const gchar* object_path, const gchar* interface_name,
+                               const gchar* method_name, GVariant* parameters,
+                               GDBusMethodInvocation* invocation, gpointer user_data) {
+  MyApplication* self = MY_APPLICATION(user_data);
+  if (g_strcmp0(method_name, "SetBehavior") == 0) {
+    const gchar* behavior = nullptr;
+    g_variant_get(parameters, "(&s)", &behavior);
+    if (g_strcmp0(behavior, "hide") == 0) {
+      self->behavior = WINDOW_BEHAVIOR_HIDE;
+    } else if (g_strcmp0(behavior, "minimize") == 0) {
+      self->behavior = WINDOW_BEHAVIOR_MINIMIZE;
+    } else if (g_strcmp0(behavior, "close") == 0) {
+      self->behavior = WINDOW_BEHAVIOR_CLOSE;
+    } else {
+      g_dbus_method_invocation_return_error(invocation, G_DBUS_ERROR, G_DBUS_ERROR_INVALID_ARGS,
+                                            "unknown behavior %s", behavior);
+      return;
+    }
+    g_dbus_method_invocation_return_value(invocation, nullptr);
+    return;
+  }
+  if (g_strcmp0(method_name, "Quit") == 0) {
+    // Used by the tray when Dart does not handle app.quit; the main loop
+    // ends and the app shuts down as if its last window had closed.
+    g_dbus_method_invocation_return_value(invocation, nullptr);
+    g_application_quit(G_APPLICATION(self));
+    return;
+  }
+  if (self->main_window == nullptr) {
+    g_dbus_method_invocation_return_dbus_error(
+        invocation, "com.xstream.Window.Error.NoWindow", "window not created yet");
+    return;
+  }
+  gboolean visible = gtk_widget_get_visible(GTK_WIDGET(self->main_window));
+  if (g_strcmp0(method_name, "Show") == 0 ||
+      (g_strcmp0(method_name, "Toggle") == 0 && !visible)) {
+    show_main_window(self);
+  } else {
+    gtk_widget_hide(GTK_WIDGET(self->main_window));
+  }
+  g_dbus_method_invocation_return_value(invocation, nullptr);
+}
+
+static GVariant* window_get_property(GDBusConnection* connection, const gchar* sender,
+                                     const gchar* object_path, const gchar* interface_name,
+                                     const gchar* property_name, GError** error,
+                                     gpointer user_data) {
+  MyApplication* self = MY_APPLICATION(user_data);
+  return g_variant_new_boolean(self->main_window != nullptr &&
+                               gtk_widget_get_visible(GTK_WIDGET(self->main_window)));
+}
+
+static const GDBusInterfaceVTable window_vtable = {
+    window_method_call, window_get_property, nullptr, {nullptr}};
+
+static void window_bus_acquired(GDBusConnection* connection, const gchar* name,
+                                gpointer user_data) {
   MyApplication* self = MY_APPLICATION(user_data);
-  if (self->main_window) {
-    gtk_widget_show(GTK_WIDGET(self->main_window));
-    gtk_window_deiconify(self->main_window);
-    gtk_window_present(self->main_window);
+  g_autoptr(GError) error = nullptr;
+  if (g_dbus_connection_register_object(connection, kWindowObjectPath,
+                                        self->window_info->interfaces[0],
+                                        &window_vtable, self, nullptr, &error) == 0) {
+    g_warning("Failed to export window interface: %s", error->message);
   }
 }
 
 static gboolean window_state_event(GtkWidget* widget, GdkEventWindowState* event,
                                    gpointer user_data) {
-  if (event->changed_mask & GDK_WINDOW_STATE_ICONIFIED &&
+  MyApplication* self = MY_APPLICATION(user_data);
+  if (self->behavior == WINDOW_BEHAVIOR_HIDE &&
+      event->changed_mask & GDK_WINDOW_STATE_ICONIFIED &&
       (event->new_window_state & GDK_WINDOW_STATE_ICONIFIED)) {
     gtk_widget_hide(widget);
   }
   return FALSE;
 }
 
+static gboolean window_delete_event(GtkWidget* widget, GdkEvent* event,
+                                    gpointer user_data) {
+  MyApplication* self = MY_APPLICATION(user_data);
+  if (self->behavior == WINDOW_BEHAVIOR_CLOSE) {
+    gtk_widget_hide(widget);
+    return TRUE;
+  }
+  return FALSE;
+}
+
 G_DEFINE_TYPE(MyApplication, my_application, GTK_TYPE_APPLICATION)
 
 // Implements GApplication::activate.
@@ -71,17 +176,9 @@ static void my_application_activate(GApplication* application) {
   gtk_window_set_default_size(window, 1280, 720);
   gtk_widget_show(GTK_WIDGET(window));
 
-  gchar* icon_path = g_build_filename(g_get_current_dir(),
-                                      "data/flutter_assets/assets/logo.png",
-                                      NULL);
-#pragma GCC diagnostic push
-#pragma GCC diagnostic ignored "-Wdeprecated-declarations"
-  self->tray_icon = gtk_status_icon_new_from_file(icon_path);
-  g_signal_connect(self->tray_icon, "activate", G_CALLBACK(tray_icon_activate), self);
-  gtk_status_icon_set_visible(self->tray_icon, TRUE);
-#pragma GCC diagnostic pop
-  g_free(icon_path);
-  g_signal_connect(window, "window-state-event", G_CALLBACK(window_state_event), NULL);
+  // The tray icon comes from the Go library (InitTray).
+  g_signal_connect(window, "window-state-event", G_CALLBACK(window_state_event), self);
+  g_signal_connect(window, "delete-event", G_CALLBACK(window_delete_event), self);
 
   g_autoptr(FlDartProject) project = fl_dart_project_new();
   fl_dart_project_set_dart_entrypoint_arguments(project, self->dart_entrypoint_arguments);
@@ -116,18 +213,26 @@ static gboolean my_application_local_command_line(GApplication* application, gch
 
 // Implements GApplication::startup.
 static void my_application_startup(GApplication* application) {
-  //MyApplication* self = MY_APPLICATION(object);
+  MyApplication* self = MY_APPLICATION(application);
 
-  // Perform any actions required at application startup.
+  self->window_info = g_dbus_node_info_new_for_xml(kWindowIntrospection, nullptr);
+  self->window_bus_id = g_bus_own_name(G_BUS_TYPE_SESSION, kWindowBusName,
+                                       G_BUS_NAME_OWNER_FLAGS_NONE,
+                                       window_bus_acquired, nullptr, nullptr,
+                                       self, nullptr);
 
   G_APPLICATION_CLASS(my_application_parent_class)->startup(application);
 }
 
 // Implements GApplication::shutdown.
 static void my_application_shutdown(GApplication* application) {
-  //MyApplication* self = MY_APPLICATION(object);
+  MyApplication* self = MY_APPLICATION(application);
 
-  // Perform any actions required at application shutdown.
+  if (self->window_bus_id != 0) {
+    g_bus_unown_name(self->window_bus_id);
+    self->window_bus_id = 0;
+  }
+  g_clear_pointer(&self->window_info, g_dbus_node_info_unref);
 
   G_APPLICATION_CLASS(my_application_parent_class)->shutdown(application);
 }
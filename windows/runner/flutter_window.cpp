@@ -5,6 +5,21 @@
 #include "flutter/generated_plugin_registrant.h"
 #include "resource.h"
 
+namespace {
+
+// Set on the window by the Go library (SetWindowBehavior); the values follow
+// windowBehaviors in go_core/window_windows.go. Without it minimizing hides
+// the window.
+constexpr wchar_t kBehaviorProp[] = L"XStreamWindowBehavior";
+constexpr UINT_PTR kBehaviorHide = 0;
+constexpr UINT_PTR kBehaviorClose = 2;
+
+UINT_PTR WindowBehavior(HWND hwnd) {
+  return reinterpret_cast<UINT_PTR>(GetProp(hwnd, kBehaviorProp));
+}
+
+}  // namespace
+
 FlutterWindow::FlutterWindow(const flutter::DartProject& project)
     : project_(project) {}
 
@@ -15,16 +30,7 @@ bool FlutterWindow::OnCreate() {
     return false;
   }
 
-  // Initialize system tray icon
-  nid_ = {};
-  nid_.cbSize = sizeof(NOTIFYICONDATA);
-  nid_.hWnd = GetHandle();
-  nid_.uID = 1;
-  nid_.uFlags = NIF_ICON | NIF_MESSAGE | NIF_TIP;
-  nid_.uCallbackMessage = kTrayMessage;
-  nid_.hIcon = LoadIcon(GetModuleHandle(nullptr), MAKEINTRESOURCE(IDI_APP_ICON));
-  lstrcpyW(nid_.szTip, L"xstream");
-  Shell_NotifyIcon(NIM_ADD, &nid_);
+  // The tray icon comes from the Go library (InitTray).
 
   RECT frame = GetClientArea();
 
@@ -56,8 +62,6 @@ void FlutterWindow::OnDestroy() {
     flutter_controller_ = nullptr;
   }
 
-  Shell_NotifyIcon(NIM_DELETE, &nid_);
-
   Win32Window::OnDestroy();
 }
 
@@ -76,14 +80,14 @@ FlutterWindow::MessageHandler(HWND hwnd, UINT const message,
   }
 
   switch (message) {
-    case kTrayMessage:
-      if (LOWORD(lparam) == WM_LBUTTONUP) {
-        Show();
-        SetForegroundWindow(hwnd);
-      }
-      return 0;
     case WM_SIZE:
-      if (wparam == SIZE_MINIMIZED) {
+      if (wparam == SIZE_MINIMIZED && WindowBehavior(hwnd) == kBehaviorHide) {
+        ShowWindow(hwnd, SW_HIDE);
+        return 0;
+      }
+      break;
+    case WM_CLOSE:
+      if (WindowBehavior(hwnd) == kBehaviorClose) {
         ShowWindow(hwnd, SW_HIDE);
         return 0;
       }
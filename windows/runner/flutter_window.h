@@ -5,7 +5,6 @@
 #include <flutter/flutter_view_controller.h>
 
 #include <memory>
-#include <shellapi.h>
 
 #include "win32_window.h"
 
@@ -29,10 +28,6 @@ class FlutterWindow : public Win32Window {
 
   // The Flutter instance hosted by this window.
   std::unique_ptr<flutter::FlutterViewController> flutter_controller_;
-
-  NOTIFYICONDATA nid_{};
-
-  static constexpr UINT kTrayMessage = WM_APP + 1;
 };
 
 #endif  // RUNNER_FLUTTER_WINDOW_H_